@@ -0,0 +1,455 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const noShowDefaultDays = 30
+
+func handleAdminCommand(bot Sender, message *tgbotapi.Message) bool {
+	chatID := message.Chat.ID
+	now := clock.Now()
+
+	switch message.Command() {
+	case "today":
+		sendReservationsForDate(bot, chatID, now.Format("02.01.2006"))
+	case "tomorrow":
+		sendReservationsForDate(bot, chatID, now.AddDate(0, 0, 1).Format("02.01.2006"))
+	case "date":
+		date := strings.TrimSpace(message.CommandArguments())
+		if _, err := time.ParseInLocation("02.01.2006", date, loc); err != nil {
+			sendMessage(bot, chatID, "Использование: /date ДД.ММ.ГГГГ", false)
+			return true
+		}
+		sendReservationsForDate(bot, chatID, date)
+	case "find":
+		findReservationsByPhone(bot, chatID, message.CommandArguments())
+	case "noshows":
+		from, to, err := parseDateRange(message.CommandArguments(), now.AddDate(0, 0, -noShowDefaultDays), now)
+		if err != nil {
+			sendMessage(bot, chatID, "Использование: /noshows [ДД.ММ.ГГГГ ДД.ММ.ГГГГ]", false)
+			return true
+		}
+		sendNoShows(bot, chatID, from, to)
+	case "export":
+		exportReservations(bot, chatID, message.CommandArguments())
+	case "stats":
+		// По умолчанию — текущая неделя с понедельника
+		weekStart := now.AddDate(0, 0, -(int(now.Weekday())+6)%7)
+		from, to, err := parseDateRange(message.CommandArguments(), weekStart, weekStart.AddDate(0, 0, 6))
+		if err != nil {
+			sendMessage(bot, chatID, "Использование: /stats [ДД.ММ.ГГГГ ДД.ММ.ГГГГ]", false)
+			return true
+		}
+		sendStats(bot, chatID, from, to)
+	case "broadcast":
+		askBroadcastConfirmation(bot, chatID, message.CommandArguments())
+	case "new":
+		clearUserState(chatID)
+		state := userStates[chatID]
+		state.StaffBooking = true
+		userStates[chatID] = state
+		sendMessage(bot, chatID, "Новая бронь за гостя. Укажите имя и телефон гостя — бронь сохранится с отметкой «внесена администратором».", false)
+		startBooking(bot, chatID)
+	case "block":
+		blockUser(bot, chatID, message.CommandArguments())
+	case "unblock":
+		unblockUser(bot, chatID, message.CommandArguments())
+	case "edit":
+		ref := strings.TrimSpace(message.CommandArguments())
+		if ref == "" {
+			sendMessage(bot, chatID, "Использование: /edit <код брони>", false)
+			return true
+		}
+		reservation, exists := findReservation(ref)
+		if !exists || !canSeeReservation(chatID, reservation) {
+			sendMessage(bot, chatID, fmt.Sprintf("Бронь %s не найдена.", ref), false)
+			return true
+		}
+		if !reservation.Status.isActive() {
+			sendMessage(bot, chatID, fmt.Sprintf("Бронь #%s уже не активна: %s.", reservation.Code, statusTitles[reservation.Status]), false)
+			return true
+		}
+		startEditing(bot, chatID, reservation)
+	case "table":
+		handleTableCommand(bot, chatID, message.CommandArguments())
+	default:
+		return false
+	}
+	return true
+}
+
+func getReservationsForDate(adminID int64, date string) []Reservation {
+	var result []Reservation
+	for _, r := range reservations {
+		if r.Status.isActive() && r.Date == date && canSeeReservation(adminID, r) {
+			result = append(result, r)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Time < result[j].Time
+	})
+	return result
+}
+
+func sendReservationsForDate(bot Sender, chatID int64, date string) {
+	sendReservationsForDatePage(bot, chatID, 0, date, 0)
+}
+
+func sendReservationsForDatePage(bot Sender, chatID int64, messageID int, date string, page int) {
+	list := getReservationsForDate(chatID, date)
+	if len(list) == 0 {
+		sendPage(bot, chatID, messageID, fmt.Sprintf("На %s бронирований нет.", date), nil)
+		return
+	}
+
+	start, end, page, pages := pageBounds(len(list), page, adminListPageSize)
+
+	var sb strings.Builder
+	var buttons [][]tgbotapi.InlineKeyboardButton
+	sb.WriteString(fmt.Sprintf("Бронирования на %s (%d)", date, len(list)))
+	if pages > 1 {
+		sb.WriteString(fmt.Sprintf(", страница %d из %d", page+1, pages))
+	}
+	sb.WriteString(":\n")
+	for _, r := range list[start:end] {
+		if r.Status != statusSeated {
+			buttons = append(buttons, tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("🚫 Не пришёл: %s %s", r.Time, adminField(r.Name, adminNameLimit)), "status_"+string(statusNoShow)+"_"+r.ID),
+			))
+		}
+		sb.WriteString(fmt.Sprintf("\n%s — %s, гостей: %d, тел.: %s", r.Time, adminField(r.Name, adminNameLimit), r.Guests, formatPhone(r.Phone)))
+		if r.Status != statusConfirmed {
+			sb.WriteString(fmt.Sprintf(" [%s]", statusTitles[r.Status]))
+		}
+		if r.Comment != "" && r.Comment != "-" {
+			sb.WriteString(fmt.Sprintf("\n   Комментарий: %s", adminField(r.Comment, adminCommentLimit)))
+		}
+		sb.WriteString(strings.ReplaceAll(preferencesLines(r), "\n", "\n   "))
+	}
+	if nav := pageNavRow("date", date, page, pages); nav != nil {
+		buttons = append(buttons, nav)
+	}
+
+	sendPage(bot, chatID, messageID, sb.String(), buttons)
+}
+
+func findReservationsByPhone(bot Sender, chatID int64, query string) {
+	digits := nonDigits.ReplaceAllString(query, "")
+	if normalized, err := normalizePhone(query); err == nil {
+		digits = nonDigits.ReplaceAllString(normalized, "")
+	}
+	if len(digits) < 4 {
+		sendMessage(bot, chatID, "Использование: /find <телефон или последние 4+ цифры>", false)
+		return
+	}
+
+	findReservationsByPhonePage(bot, chatID, 0, digits, 0)
+}
+
+func findReservationsByPhonePage(bot Sender, chatID int64, messageID int, digits string, page int) {
+	var found []Reservation
+	for _, r := range reservations {
+		if strings.HasSuffix(nonDigits.ReplaceAllString(r.Phone, ""), digits) && canSeeReservation(chatID, r) {
+			found = append(found, r)
+		}
+	}
+
+	if len(found) == 0 {
+		sendPage(bot, chatID, messageID, "По этому номеру ничего не найдено.", nil)
+		return
+	}
+
+	sortReservationsByTime(found)
+	start, end, page, pages := pageBounds(len(found), page, adminListPageSize)
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("Найдено бронирований: %d", len(found)))
+	if pages > 1 {
+		sb.WriteString(fmt.Sprintf(", страница %d из %d", page+1, pages))
+	}
+	sb.WriteString("\n")
+	for _, r := range found[start:end] {
+		sb.WriteString(fmt.Sprintf("\n#%s\n%s %s — %s, гостей: %d, тел.: %s\n", r.Code, r.Date, r.Time, adminField(r.Name, adminNameLimit), r.Guests, formatPhone(r.Phone)))
+	}
+
+	var rows [][]tgbotapi.InlineKeyboardButton
+	if nav := pageNavRow("find", digits, page, pages); nav != nil {
+		rows = append(rows, nav)
+	}
+	sendPage(bot, chatID, messageID, sb.String(), rows)
+}
+
+func adminStatusKeyboard(reservationID string) tgbotapi.InlineKeyboardMarkup {
+	return tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🪑 Гости пришли", "status_"+string(statusSeated)+"_"+reservationID),
+			tgbotapi.NewInlineKeyboardButtonData("🚫 Не пришли", "status_"+string(statusNoShow)+"_"+reservationID),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🍽 Стол", "table_"+reservationID),
+		),
+	)
+}
+
+func handleStatusAction(bot Sender, chatID int64, action string) {
+	parts := strings.SplitN(action, "_", 2)
+	if len(parts) != 2 {
+		return
+	}
+	status, reservationID := ReservationStatus(parts[0]), parts[1]
+
+	if status != statusSeated && status != statusNoShow {
+		return
+	}
+
+	// Завершенную или отмененную бронь кнопка из старого уведомления не возвращает в работу
+	reservation, exists := findReservation(reservationID)
+	if !exists || !canSeeReservation(chatID, reservation) || !reservation.Status.isActive() {
+		sendMessage(bot, chatID, "Бронь не найдена.", false)
+		return
+	}
+
+	reservation.Status = status
+	reservation.StatusChangedAt = clock.Now()
+	if err := updateReservationsInFile(reservation); err != nil {
+		slog.Error("Статус брони не сохранен", "adminID", chatID, "reservationID", reservation.ID, "err", err)
+		storageErrors.Inc()
+		sendMessage(bot, chatID, fmt.Sprintf("⚠️ Не удалось сохранить статус брони #%s: %v", reservation.Code, err), false)
+		return
+	}
+	reservations[reservation.ID] = reservation
+	publishReservationEvent(eventUpdated, reservation)
+
+	sendMessage(bot, chatID, fmt.Sprintf("Бронь #%s (%s, %s %s): %s", reservation.Code, adminField(reservation.Name, adminNameLimit),
+		reservation.Date, reservation.Time, statusTitles[status]), false)
+}
+
+// Диапазон дат из аргументов команды; без аргументов используется период по умолчанию
+func parseDateRange(args string, defaultFrom, defaultTo time.Time) (time.Time, time.Time, error) {
+	fields := strings.Fields(args)
+	if len(fields) == 0 {
+		return truncateToDay(defaultFrom), truncateToDay(defaultTo), nil
+	}
+	if len(fields) != 2 {
+		return time.Time{}, time.Time{}, fmt.Errorf("ожидалось две даты, получено %d", len(fields))
+	}
+
+	from, err := time.ParseInLocation("02.01.2006", fields[0], loc)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	to, err := time.ParseInLocation("02.01.2006", fields[1], loc)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	if to.Before(from) {
+		from, to = to, from
+	}
+	return from, to, nil
+}
+
+func truncateToDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+}
+
+func sendNoShows(bot Sender, chatID int64, from, to time.Time) {
+	var list []Reservation
+	countByPhone := make(map[string]int)
+	namesByPhone := make(map[string]string)
+
+	for _, r := range reservations {
+		if r.Status != statusNoShow || !canSeeReservation(chatID, r) {
+			continue
+		}
+		day, err := time.ParseInLocation("02.01.2006", r.Date, loc)
+		if err != nil || day.Before(from) || day.After(to) {
+			continue
+		}
+		list = append(list, r)
+		countByPhone[r.Phone]++
+		namesByPhone[r.Phone] = adminField(r.Name, adminNameLimit)
+	}
+
+	period := fmt.Sprintf("%s — %s", from.Format("02.01.2006"), to.Format("02.01.2006"))
+	if len(list) == 0 {
+		sendMessage(bot, chatID, fmt.Sprintf("За период %s неявок нет.", period), false)
+		return
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		ti, _ := reservationDateTime(list[i])
+		tj, _ := reservationDateTime(list[j])
+		return ti.Before(tj)
+	})
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("Неявки за период %s: %d\n", period, len(list)))
+	for _, r := range list {
+		sb.WriteString(fmt.Sprintf("\n%s %s — %s, гостей: %d, тел.: %s", r.Date, r.Time, adminField(r.Name, adminNameLimit), r.Guests, formatPhone(r.Phone)))
+	}
+
+	phones := make([]string, 0, len(countByPhone))
+	for phone := range countByPhone {
+		phones = append(phones, phone)
+	}
+	sort.Slice(phones, func(i, j int) bool {
+		if countByPhone[phones[i]] != countByPhone[phones[j]] {
+			return countByPhone[phones[i]] > countByPhone[phones[j]]
+		}
+		return phones[i] < phones[j]
+	})
+
+	sb.WriteString("\n\nПо гостям:")
+	for _, phone := range phones {
+		sb.WriteString(fmt.Sprintf("\n%s (%s): %d", formatPhone(phone), namesByPhone[phone], countByPhone[phone]))
+	}
+	sendLong(bot, chatID, sb.String())
+}
+
+func exportReservations(bot Sender, chatID int64, args string) {
+	var list []Reservation
+	fileName := "reservations.csv"
+
+	if strings.TrimSpace(args) == "" {
+		for _, r := range reservations {
+			if canSeeReservation(chatID, r) {
+				list = append(list, r)
+			}
+		}
+	} else {
+		from, to, err := parseDateRange(args, time.Time{}, time.Time{})
+		if err != nil {
+			sendMessage(bot, chatID, "Использование: /export [ДД.ММ.ГГГГ ДД.ММ.ГГГГ]", false)
+			return
+		}
+		for _, r := range reservations {
+			day, err := time.ParseInLocation("02.01.2006", r.Date, loc)
+			if err != nil || day.Before(from) || day.After(to) || !canSeeReservation(chatID, r) {
+				continue
+			}
+			list = append(list, r)
+		}
+		fileName = fmt.Sprintf("reservations_%s_%s.csv", from.Format("2006-01-02"), to.Format("2006-01-02"))
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		ti, _ := reservationDateTime(list[i])
+		tj, _ := reservationDateTime(list[j])
+		return ti.Before(tj)
+	})
+
+	// Файл собирается в памяти, чтобы не держать открытым рабочий reservations.csv
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	writer.Write(reservationHeaders)
+	for _, r := range list {
+		writer.Write(reservationRecord(r))
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		sendMessage(bot, chatID, "Не удалось сформировать файл выгрузки.", false)
+		return
+	}
+
+	doc := tgbotapi.NewDocument(chatID, tgbotapi.FileBytes{Name: fileName, Bytes: buf.Bytes()})
+	doc.Caption = fmt.Sprintf("Бронирований в выгрузке: %d", len(list))
+	// Если файл не прошёл, отдаём ту же выгрузку текстом
+	if err := deliver(bot, chatID, "выгрузка", doc); err != nil && !isBlockedError(err) {
+		sendLong(bot, chatID, buf.String())
+	}
+}
+
+func sendStats(bot Sender, chatID int64, from, to time.Time) {
+	today := clock.Now().Format("02.01.2006")
+	todayCount := 0
+	total, guests, cancelled, noShows := 0, 0, 0, 0
+	guestsBySlot := make(map[string]int)
+	bySource := make(map[string]int)
+	ratings, ratingSum := 0, 0
+
+	for _, r := range reservations {
+		if !canSeeReservation(chatID, r) {
+			continue
+		}
+		if r.Date == today && r.Status.isActive() {
+			todayCount++
+		}
+
+		day, err := time.ParseInLocation("02.01.2006", r.Date, loc)
+		if err != nil || day.Before(from) || day.After(to) {
+			continue
+		}
+		total++
+		if r.Source != "" {
+			bySource[r.Source]++
+		}
+		if r.Feedback > 0 {
+			ratings++
+			ratingSum += r.Feedback
+		}
+		switch r.Status {
+		case statusCancelled:
+			cancelled++
+			continue
+		case statusNoShow:
+			noShows++
+		}
+		guests += r.Guests
+		guestsBySlot[r.Time] += r.Guests
+	}
+
+	period := fmt.Sprintf("%s — %s", from.Format("02.01.2006"), to.Format("02.01.2006"))
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("📊 Статистика\nСегодня активных броней: %d\n\nЗа период %s:\nБронирований: %d", todayCount, period, total))
+	if total == 0 {
+		sendMessage(bot, chatID, sb.String(), false)
+		return
+	}
+
+	if visits := total - cancelled; visits > 0 {
+		sb.WriteString(fmt.Sprintf("\nСредний размер компании: %.1f", float64(guests)/float64(visits)))
+	}
+
+	busiest := ""
+	for slot, count := range guestsBySlot {
+		if busiest == "" || count > guestsBySlot[busiest] || (count == guestsBySlot[busiest] && slot < busiest) {
+			busiest = slot
+		}
+	}
+	if busiest != "" {
+		sb.WriteString(fmt.Sprintf("\nСамое загруженное время: %s (гостей: %d)", busiest, guestsBySlot[busiest]))
+	}
+
+	sb.WriteString(fmt.Sprintf("\nОтмены: %d (%.0f%%)", cancelled, 100*float64(cancelled)/float64(total)))
+	sb.WriteString(fmt.Sprintf("\nНеявки: %d (%.0f%%)", noShows, 100*float64(noShows)/float64(total)))
+	if ratings > 0 {
+		sb.WriteString(fmt.Sprintf("\nСредняя оценка: %.1f ⭐ (отзывов: %d)", float64(ratingSum)/float64(ratings), ratings))
+	}
+
+	if len(bySource) > 0 {
+		sources := make([]string, 0, len(bySource))
+		for source := range bySource {
+			sources = append(sources, source)
+		}
+		sort.Slice(sources, func(i, j int) bool {
+			if bySource[sources[i]] != bySource[sources[j]] {
+				return bySource[sources[i]] > bySource[sources[j]]
+			}
+			return sources[i] < sources[j]
+		})
+		sb.WriteString("\n\nИсточники:")
+		for _, source := range sources {
+			sb.WriteString(fmt.Sprintf("\n%s: %d", source, bySource[source]))
+		}
+	}
+	sendLong(bot, chatID, sb.String())
+}
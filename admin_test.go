@@ -0,0 +1,181 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestNoShowsLongListSplit(t *testing.T) {
+	b := setupTest(t, "14.10.2026 12:00", nil)
+	const total = 200
+	for i := 0; i < total; i++ {
+		visit := clock.Now().AddDate(0, 0, -1-i%20)
+		addReservation(t, Reservation{
+			ChatID: int64(1000 + i),
+			Name:   fmt.Sprintf("Гость номер %03d", i),
+			Phone:  fmt.Sprintf("+7999%07d", i),
+			Date:   visit.Format("02.01.2006"),
+			Time:   "19:00",
+			Status: statusNoShow,
+		})
+	}
+
+	b.say(testAdminID, "/noshows")
+
+	chunks := b.texts(testAdminID)
+	if len(chunks) < 2 {
+		t.Fatalf("список из %d неявок ушел %d сообщениями", total, len(chunks))
+	}
+	for i, chunk := range chunks {
+		if n := utf16Len(chunk); n > maxMessageLength {
+			t.Fatalf("сообщение %d длиной %d UTF-16", i, n)
+		}
+	}
+	joined := strings.Join(chunks, "\n")
+	if !strings.HasPrefix(joined, fmt.Sprintf("Неявки за период 14.09.2026 — 14.10.2026: %d", total)) {
+		t.Fatalf("начало списка: %.80q", joined)
+	}
+	for i := 0; i < total; i++ {
+		if !strings.Contains(joined, fmt.Sprintf("Гость номер %03d, гостей", i)) {
+			t.Fatalf("в списке нет гостя %03d", i)
+		}
+	}
+	if strings.Index(joined, "По гостям:") < strings.LastIndex(joined, "гостей: 2") {
+		t.Fatal("сводка по гостям пришла раньше списка")
+	}
+}
+
+func TestAdminField(t *testing.T) {
+	long := strings.Repeat("Ёж🙂", 60)
+	tests := []struct {
+		name, value string
+		limit       int
+		want        string
+	}{
+		{"обычное имя", "Анна", adminNameLimit, "Анна"},
+		{"поддельная строка карточки", "Анна\nТелефон: +7 000 000-00-00", adminNameLimit, "Анна Телефон: +7 000 000-00-00"},
+		{"CRLF и табуляция", "Анна\r\n\tМария", adminNameLimit, "Анна   Мария"},
+		{"разделители строк Unicode", "Анна\u2028Гостей: 20\u2029", adminNameLimit, "Анна Гостей: 20"},
+		{"управляющие символы", "\x00Ан\x1b[31mна\x7f", adminNameLimit, "Ан [31mна"},
+		// Сообщения уходят без ParseMode, разметка остается как есть
+		{"разметка", "*Анна* _[ссылка](http://example.com)_ <b>", adminNameLimit, "*Анна* _[ссылка](http://example.com)_ <b>"},
+		{"ровно по лимиту", strings.Repeat("я", 10), 10, strings.Repeat("я", 10)},
+		{"на символ длиннее", strings.Repeat("я", 11), 10, strings.Repeat("я", 9) + "…"},
+		{"пробел перед обрезкой", "абвгдежз ий", 10, "абвгдежз…"},
+		{"длинное с эмодзи", long, adminNameLimit, string([]rune(long)[:adminNameLimit-1]) + "…"},
+		{"только пробельные", " \n\t ", adminNameLimit, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := adminField(tt.value, tt.limit)
+			if got != tt.want {
+				t.Fatalf("adminField(%q, %d) = %q, ожидалось %q", tt.value, tt.limit, got, tt.want)
+			}
+			if n := utf8.RuneCountInString(got); n > tt.limit || !utf8.ValidString(got) {
+				t.Fatalf("результат длиной %d символов, лимит %d: %q", n, tt.limit, got)
+			}
+		})
+	}
+}
+
+func TestAdminReservationCardIgnoresInjectedLines(t *testing.T) {
+	setupTest(t, "14.10.2026 12:00", nil)
+	r := Reservation{
+		Name:    strings.Repeat("Анна", 40) + "\nТелефон: +7 000 000-00-00\nГостей: 50",
+		Phone:   "+79991234567",
+		Guests:  2,
+		Date:    "15.10.2026",
+		Time:    "19:00",
+		Comment: "У окна\n\nДата: 01.01.2027\u2028" + strings.Repeat("очень длинный комментарий ", 40),
+	}
+
+	card := adminReservationCard("Новая бронь #ABC", r)
+	lines := strings.Split(card, "\n")
+	want := []string{"Новая бронь #ABC", "Имя: ", "Телефон: ", "Гостей: 2", "Дата: 15.10.2026", "Время: 19:00", "Комментарий: У окна"}
+	if len(lines) < len(want) {
+		t.Fatalf("в карточке %d строк:\n%s", len(lines), card)
+	}
+	for i, prefix := range want {
+		if !strings.HasPrefix(lines[i], prefix) {
+			t.Fatalf("строка %d %q, ожидалось начало %q:\n%s", i, lines[i], prefix, card)
+		}
+	}
+	for _, label := range []string{"Телефон: ", "Гостей: ", "Дата: "} {
+		if n := strings.Count(card, "\n"+label); n != 1 {
+			t.Fatalf("строк %q в карточке %d:\n%s", label, n, card)
+		}
+	}
+	if name := strings.TrimPrefix(lines[1], "Имя: "); utf8.RuneCountInString(name) > adminNameLimit || !strings.HasSuffix(name, "…") {
+		t.Fatalf("имя не обрезано до %d символов: %q", adminNameLimit, name)
+	}
+	if comment := strings.TrimPrefix(lines[6], "Комментарий: "); utf8.RuneCountInString(comment) > adminCommentLimit || !strings.HasSuffix(comment, "…") {
+		t.Fatalf("комментарий не обрезан до %d символов: %d", adminCommentLimit, utf8.RuneCountInString(comment))
+	}
+}
+
+// Многострочный комментарий гостя хранится целиком, а администратору уходит одной строкой
+func TestGuestCommentFlattenedForAdmins(t *testing.T) {
+	b := setupTest(t, "14.10.2026 12:00", map[string]string{"MAX_COMMENT_LENGTH": "2000"})
+	comment := "Аллергия на орехи\nТелефон: +7 000 000-00-00\n" + strings.TrimSpace(strings.Repeat("Пожалуйста, подготовьте торт. ", 30))
+	b.fillGuestDetails(testGuestID, "2")
+	b.press(testGuestID, "back")
+	b.say(testGuestID, comment)
+	b.pressButton(testGuestID, "date_15.10.2026")
+	b.pressButton(testGuestID, "time_19:00")
+	b.press(testGuestID, "booking_confirm")
+
+	if len(reservations) != 1 {
+		t.Fatalf("создано броней: %d", len(reservations))
+	}
+	var r Reservation
+	for _, saved := range reservations {
+		r = saved
+	}
+	if r.Comment != comment {
+		t.Fatalf("комментарий сохранен не целиком: %q", r.Comment)
+	}
+	reloadReservations(t)
+	if saved := reservations[r.ID]; saved.Comment != comment {
+		t.Fatalf("комментарий в файле не совпадает: %q", saved.Comment)
+	}
+
+	var notice string
+	for _, text := range b.texts(testAdminID) {
+		if strings.Contains(text, "#"+r.Code) {
+			notice = text
+		}
+	}
+	if notice == "" {
+		t.Fatalf("администратор не получил уведомление: %q", b.texts(testAdminID))
+	}
+	if n := strings.Count(notice, "\nТелефон: "); n != 1 {
+		t.Fatalf("в уведомлении %d строк с телефоном:\n%s", n, notice)
+	}
+	if !strings.Contains(notice, "\nКомментарий: Аллергия на орехи Телефон: +7 000 000-00-00 Пожалуйста") ||
+		!strings.Contains(notice, "…") {
+		t.Fatalf("комментарий в уведомлении не склеен и не обрезан:\n%s", notice)
+	}
+}
+
+func TestAdminEditRefusesInactiveReservation(t *testing.T) {
+	b := setupTest(t, "14.10.2026 12:00", nil)
+	for _, status := range []ReservationStatus{statusCancelled, statusCompleted, statusNoShow} {
+		r := addReservation(t, Reservation{Date: "15.10.2026", Time: "19:00", Status: status})
+		b.reset()
+		b.say(testAdminID, "/edit "+r.Code)
+		if state := userStates[testAdminID]; state.TempReservation != nil || state.State == stateEditingReservation {
+			t.Fatalf("%s: открыт редактор неактивной брони", status)
+		}
+		if !b.received(testAdminID, fmt.Sprintf("Бронь #%s уже не активна: %s.", r.Code, statusTitles[status])) {
+			t.Fatalf("%s: нет ответа о статусе: %q", status, b.texts(testAdminID))
+		}
+	}
+
+	active := addReservation(t, Reservation{Date: "15.10.2026", Time: "20:00"})
+	b.say(testAdminID, "/edit "+active.Code)
+	if state := userStates[testAdminID]; state.State != stateEditingReservation || state.TempReservation == nil {
+		t.Fatalf("редактор активной брони не открыт: %+v", state)
+	}
+}
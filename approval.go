@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// AUTO_CONFIRM_AFTER=N: сразу подтверждаются брони гостей, у которых уже есть
+// N состоявшихся визитов и ни одной неявки; остальные ждут решения администратора.
+// Считаются брони рабочего файла, то есть за последние RETENTION_DAYS
+func isTrustedGuest(chatID int64, phone string) bool {
+	visits := 0
+	for _, r := range reservations {
+		if r.ChatID != chatID && (phone == "" || r.Phone != phone) {
+			continue
+		}
+		switch r.Status {
+		case statusNoShow:
+			return false
+		case statusSeated, statusCompleted:
+			visits++
+		}
+	}
+	return visits >= cfg.AutoConfirmAfter
+}
+
+func needsApproval(r Reservation) bool {
+	return cfg.AutoConfirmAfter > 0 && !r.CreatedByStaff && !isTrustedGuest(r.ChatID, r.Phone)
+}
+
+func adminApprovalKeyboard(reservationID string) tgbotapi.InlineKeyboardMarkup {
+	return tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("✅ Подтвердить", "approve_"+reservationID),
+			tgbotapi.NewInlineKeyboardButtonData("❌ Отклонить", "decline_"+reservationID),
+		),
+	)
+}
+
+func handleApprovalAction(bot Sender, adminID int64, reservationID string, approve bool) {
+	r, exists := reservations[reservationID]
+	if !exists || !canSeeReservation(adminID, r) {
+		sendMessage(bot, adminID, "Бронь не найдена.", false)
+		return
+	}
+	// Кнопки получают все администраторы заведения, решение принимает первый
+	if r.Status != statusPending {
+		sendMessage(bot, adminID, fmt.Sprintf("Бронь #%s уже обработана: %s.", r.Code, statusTitles[r.Status]), false)
+		return
+	}
+
+	r.Status = statusConfirmed
+	if !approve {
+		r.Status = statusCancelled
+	}
+	r.StatusChangedAt = clock.Now()
+	if err := updateReservationsInFile(r); err != nil {
+		slog.Error("Решение по брони не сохранено", "adminID", adminID, "reservationID", r.ID, "err", err)
+		storageErrors.Inc()
+		sendMessage(bot, adminID, fmt.Sprintf("⚠️ Не удалось сохранить решение по брони #%s: %v", r.Code, err), false)
+		return
+	}
+	reservations[r.ID] = r
+	slog.Info("Администратор рассмотрел бронь", "adminID", adminID, "reservationID", r.ID, "status", r.Status)
+
+	if !approve {
+		bookingsCancelled.Inc()
+		publishReservationEvent(eventDeleted, r)
+		text := fmt.Sprintf("❌ Бронь #%s (%s, %s %s) отклонена.", r.Code, adminField(r.Name, adminNameLimit), r.Date, r.Time)
+		guestText := tr(r.Lang, "declined", r.Code, r.Date, r.Time, cfg.ManagerPhone)
+		// Бот деньги не возвращает: возврат делают вручную у платежного провайдера
+		if r.DepositPaid {
+			amount := formatMoney(r.DepositAmount, cfg.DepositCurrency)
+			slog.Warn("Отклонена бронь с внесенной предоплатой", "reservationID", r.ID, "amount", r.DepositAmount, "chargeID", r.PaymentChargeID)
+			text += fmt.Sprintf("\n💳 Предоплата %s внесена — нужен возврат вручную.\nПлатеж: %s", amount, r.PaymentChargeID)
+			// Остальные администраторы заведения тоже должны знать, что деньги надо вернуть
+			for _, id := range venueAdmins(r.VenueID) {
+				if id != adminID {
+					sendMessage(bot, id, fmt.Sprintf("💳 Бронь #%s с предоплатой %s отклонена, нужен возврат вручную.\nПлатеж: %s", r.Code, amount, r.PaymentChargeID), false)
+				}
+			}
+			guestText += tr(r.Lang, "declined_refund", amount)
+		}
+		sendMessage(bot, adminID, text, false)
+		sendMessage(bot, r.ChatID, guestText, false)
+		return
+	}
+
+	publishReservationEvent(eventUpdated, r)
+	msg := tgbotapi.NewMessage(adminID, fmt.Sprintf("✅ Бронь #%s (%s, %s %s) подтверждена.", r.Code, adminField(r.Name, adminNameLimit), r.Date, r.Time))
+	msg.ReplyMarkup = adminStatusKeyboard(r.ID)
+	deliver(bot, adminID, "подтверждение брони администратором", msg)
+
+	deliver(bot, r.ChatID, "подтверждение брони", tgbotapi.NewMessage(r.ChatID, confirmationText(r.ChatID, r)))
+	sendReservationICS(bot, r.ChatID, r)
+}
+
+// approve_<id> и decline_<id> из уведомления о новой брони
+func handleApprovalCallback(bot Sender, adminID int64, data string) {
+	if id, ok := strings.CutPrefix(data, "approve_"); ok {
+		handleApprovalAction(bot, adminID, id, true)
+	} else if id, ok := strings.CutPrefix(data, "decline_"); ok {
+		handleApprovalAction(bot, adminID, id, false)
+	}
+}
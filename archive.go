@@ -0,0 +1,33 @@
+package main
+
+import (
+	"encoding/csv"
+	"os"
+)
+
+// Дописывает брони в архивный CSV; заголовок пишется только в новый файл
+func archiveReservations(list []Reservation) error {
+	if cfg.DryRun {
+		return nil
+	}
+	file, err := os.OpenFile(cfg.ArchiveFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	writer := csv.NewWriter(file)
+	if info.Size() == 0 {
+		writer.Write(reservationHeaders)
+	}
+	for _, r := range list {
+		writer.Write(reservationRecord(r))
+	}
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Блокировка по чату или по телефону; телефон ловит и новые аккаунты гостя
+type BlockEntry struct {
+	ChatID    int64  `json:",omitempty"`
+	Phone     string `json:",omitempty"`
+	Reason    string
+	BlockedBy int64
+	BlockedAt time.Time
+}
+
+// Доступ под statesMu, как и к броням
+var blocklist []BlockEntry
+
+func loadBlocklist() {
+	data, err := os.ReadFile(cfg.BlocklistFile)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			slog.Error("Ошибка при открытии файла блокировок", "err", err)
+		}
+		return
+	}
+	if err := json.Unmarshal(data, &blocklist); err != nil {
+		slog.Error("Ошибка чтения файла блокировок", "err", err)
+		return
+	}
+	slog.Info("Загружен список блокировок", "count", len(blocklist))
+}
+
+func saveBlocklist() {
+	if cfg.DryRun {
+		return
+	}
+	data, err := json.Marshal(blocklist)
+	if err != nil {
+		slog.Error("Ошибка сериализации блокировок", "err", err)
+		return
+	}
+	tmpFile := cfg.BlocklistFile + ".tmp"
+	if err := os.WriteFile(tmpFile, data, 0644); err != nil {
+		slog.Error("Ошибка записи файла блокировок", "err", err)
+		return
+	}
+	if err := os.Rename(tmpFile, cfg.BlocklistFile); err != nil {
+		slog.Error("Ошибка сохранения файла блокировок", "err", err)
+	}
+}
+
+func findBlock(chatID int64, phones ...string) (BlockEntry, bool) {
+	for _, entry := range blocklist {
+		if entry.ChatID != 0 && entry.ChatID == chatID {
+			return entry, true
+		}
+		for _, phone := range phones {
+			if entry.Phone != "" && entry.Phone == phone {
+				return entry, true
+			}
+		}
+	}
+	return BlockEntry{}, false
+}
+
+// Блок по телефону срабатывает на номер из профиля и из текущей брони
+func findUserBlock(chatID int64) (BlockEntry, bool) {
+	var phones []string
+	if profile, ok := getProfile(chatID); ok && profile.Phone != "" {
+		phones = append(phones, profile.Phone)
+	}
+	state := userStates[chatID]
+	for _, phone := range []string{state.PhoneContact, state.PhoneManual} {
+		if phone != "" {
+			phones = append(phones, phone)
+		}
+	}
+	return findBlock(chatID, phones...)
+}
+
+// Администраторов не блокируем, чтобы нельзя было запереть самого себя
+func refuseBlockedUser(bot Sender, chatID int64) bool {
+	if isAdmin(chatID) {
+		return false
+	}
+	entry, blocked := findUserBlock(chatID)
+	if !blocked {
+		return false
+	}
+	slog.Info("Запрос заблокированного пользователя отклонен", "chatID", chatID, "reason", entry.Reason)
+	clearUserState(chatID)
+	sendMessage(bot, chatID, t(chatID, "user_blocked", cfg.ManagerPhone), false)
+	return true
+}
+
+// Цель — chat ID или телефон с «+», чтобы их нельзя было перепутать
+func parseBlockTarget(arg string) (BlockEntry, error) {
+	if strings.HasPrefix(arg, "+") {
+		phone, err := normalizePhone(arg)
+		if err != nil {
+			return BlockEntry{}, err
+		}
+		return BlockEntry{Phone: phone}, nil
+	}
+	chatID, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil {
+		return BlockEntry{}, fmt.Errorf("ожидался chat ID или телефон в формате +79991234567, получено %q", arg)
+	}
+	return BlockEntry{ChatID: chatID}, nil
+}
+
+func blockTargetTitle(entry BlockEntry) string {
+	if entry.Phone != "" {
+		return formatPhone(entry.Phone)
+	}
+	return strconv.FormatInt(entry.ChatID, 10)
+}
+
+func blockUser(bot Sender, adminID int64, args string) {
+	target, reason, _ := strings.Cut(strings.TrimSpace(args), " ")
+	if target == "" {
+		sendBlocklist(bot, adminID)
+		return
+	}
+	entry, err := parseBlockTarget(target)
+	if err != nil {
+		sendMessage(bot, adminID, "Использование: /block <chat ID или +телефон> [причина]\n"+err.Error(), false)
+		return
+	}
+	if entry.ChatID != 0 && isAdmin(entry.ChatID) {
+		sendMessage(bot, adminID, "Администратора заблокировать нельзя.", false)
+		return
+	}
+	for _, existing := range blocklist {
+		if existing.ChatID == entry.ChatID && existing.Phone == entry.Phone {
+			sendMessage(bot, adminID, fmt.Sprintf("%s уже заблокирован. Причина: %s", blockTargetTitle(existing), blockReasonTitle(existing)), false)
+			return
+		}
+	}
+
+	entry.Reason = strings.TrimSpace(reason)
+	entry.BlockedBy = adminID
+	entry.BlockedAt = clock.Now()
+	blocklist = append(blocklist, entry)
+	saveBlocklist()
+	slog.Info("Пользователь заблокирован", "adminID", adminID, "chatID", entry.ChatID, "phone", entry.Phone, "reason", entry.Reason)
+
+	text := fmt.Sprintf("🚫 %s заблокирован. Причина: %s", blockTargetTitle(entry), blockReasonTitle(entry))
+	if cfg.CancelBlockedReservations {
+		if cancelled, err := cancelBlockedReservations(entry); err != nil {
+			text += fmt.Sprintf("\n⚠️ Не удалось отменить активные брони: %v", err)
+		} else if cancelled > 0 {
+			text += fmt.Sprintf("\nОтменено активных броней: %d", cancelled)
+		}
+	}
+	sendMessage(bot, adminID, text, false)
+}
+
+func unblockUser(bot Sender, adminID int64, args string) {
+	entry, err := parseBlockTarget(strings.TrimSpace(args))
+	if err != nil {
+		sendMessage(bot, adminID, "Использование: /unblock <chat ID или +телефон>", false)
+		return
+	}
+
+	kept := blocklist[:0]
+	removed := false
+	for _, existing := range blocklist {
+		if existing.ChatID == entry.ChatID && existing.Phone == entry.Phone {
+			removed = true
+			continue
+		}
+		kept = append(kept, existing)
+	}
+	blocklist = kept
+	if !removed {
+		sendMessage(bot, adminID, fmt.Sprintf("%s не найден в списке блокировок.", blockTargetTitle(entry)), false)
+		return
+	}
+	saveBlocklist()
+	slog.Info("Пользователь разблокирован", "adminID", adminID, "chatID", entry.ChatID, "phone", entry.Phone)
+	sendMessage(bot, adminID, fmt.Sprintf("✅ %s разблокирован.", blockTargetTitle(entry)), false)
+}
+
+func sendBlocklist(bot Sender, adminID int64) {
+	if len(blocklist) == 0 {
+		sendMessage(bot, adminID, "Список блокировок пуст.\nИспользование: /block <chat ID или +телефон> [причина]", false)
+		return
+	}
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("Заблокированы (%d):\n", len(blocklist)))
+	for _, entry := range blocklist {
+		sb.WriteString(fmt.Sprintf("\n%s — %s, с %s", blockTargetTitle(entry), blockReasonTitle(entry),
+			entry.BlockedAt.In(loc).Format("02.01.2006")))
+	}
+	sendLong(bot, adminID, sb.String())
+}
+
+func blockReasonTitle(entry BlockEntry) string {
+	if entry.Reason == "" {
+		return "не указана"
+	}
+	return entry.Reason
+}
+
+// BLOCKED_RESERVATIONS=cancel: активные брони заблокированного снимаются сразу
+func cancelBlockedReservations(entry BlockEntry) (int, error) {
+	var cancelled []Reservation
+	for _, r := range reservations {
+		if !r.Status.isActive() || r.CreatedByStaff {
+			continue
+		}
+		if (entry.ChatID != 0 && r.ChatID == entry.ChatID) || (entry.Phone != "" && r.Phone == entry.Phone) {
+			r.Status = statusCancelled
+			r.StatusChangedAt = clock.Now()
+			cancelled = append(cancelled, r)
+		}
+	}
+	if len(cancelled) == 0 {
+		return 0, nil
+	}
+	if err := updateReservationsInFile(cancelled...); err != nil {
+		slog.Error("Не удалось отменить брони заблокированного пользователя", "chatID", entry.ChatID, "phone", entry.Phone, "err", err)
+		storageErrors.Inc()
+		return 0, err
+	}
+	for _, r := range cancelled {
+		reservations[r.ID] = r
+		bookingsCancelled.Inc()
+		publishReservationEvent(eventDeleted, r)
+	}
+	return len(cancelled), nil
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Telegram допускает около 30 сообщений в секунду в разные чаты; оставляем запас
+const broadcastInterval = time.Second / 25
+
+// Текст рассылки, ожидающий подтверждения, по chatID администратора
+var pendingBroadcasts = make(map[int64]string)
+
+func askBroadcastConfirmation(bot Sender, chatID int64, text string) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		sendMessage(bot, chatID, "Использование: /broadcast <текст>", false)
+		return
+	}
+
+	recipients := broadcastRecipients()
+	if len(recipients) == 0 {
+		sendMessage(bot, chatID, "Нет гостей для рассылки.", false)
+		return
+	}
+
+	pendingBroadcasts[chatID] = text
+	msg := tgbotapi.NewMessage(chatID, fmt.Sprintf("Отправить это сообщение %d гостям?\n\n%s", len(recipients), text))
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("📣 Отправить", "broadcast_send"),
+		tgbotapi.NewInlineKeyboardButtonData("Отмена", "broadcast_cancel"),
+	))
+	deliver(bot, chatID, "подтверждение рассылки", msg)
+}
+
+func handleBroadcastAction(bot Sender, chatID int64, action string) {
+	text, ok := pendingBroadcasts[chatID]
+	delete(pendingBroadcasts, chatID)
+	if !ok {
+		sendMessage(bot, chatID, "Нет рассылки, ожидающей подтверждения.", false)
+		return
+	}
+	if action != "send" {
+		sendMessage(bot, chatID, "Рассылка отменена.", false)
+		return
+	}
+
+	recipients := broadcastRecipients()
+	sendMessage(bot, chatID, fmt.Sprintf("Рассылка запущена, получателей: %d.", len(recipients)), false)
+	// Отправка идёт без блокировки состояния, чтобы бот продолжал отвечать гостям
+	go runBroadcast(bot, chatID, text, recipients)
+}
+
+// Все гости, у которых есть бронь в базе, кроме администраторов
+func broadcastRecipients() []int64 {
+	seen := make(map[int64]bool)
+	var recipients []int64
+	for _, r := range reservations {
+		if seen[r.ChatID] || isAdmin(r.ChatID) {
+			continue
+		}
+		seen[r.ChatID] = true
+		recipients = append(recipients, r.ChatID)
+	}
+	sort.Slice(recipients, func(i, j int) bool { return recipients[i] < recipients[j] })
+	return recipients
+}
+
+func runBroadcast(bot Sender, adminID int64, text string, recipients []int64) {
+	delivered, blocked, failed := 0, 0, 0
+	throttle := time.NewTicker(broadcastInterval)
+	defer throttle.Stop()
+
+	for _, chatID := range recipients {
+		if isChatBlocked(chatID) {
+			blocked++
+			continue
+		}
+		<-throttle.C
+		err := deliver(bot, chatID, "рассылка", tgbotapi.NewMessage(chatID, text))
+		switch {
+		case err == nil:
+			delivered++
+		case isBlockedError(err):
+			blocked++
+		default:
+			failed++
+		}
+	}
+
+	slog.Info("Рассылка завершена", "adminID", adminID, "delivered", delivered, "blocked", blocked, "failed", failed)
+	deliver(bot, adminID, "итог рассылки", tgbotapi.NewMessage(adminID, fmt.Sprintf(
+		"Рассылка завершена.\nДоставлено: %d\nЗаблокировали бота: %d\nОшибки: %d", delivered, blocked, failed)))
+}
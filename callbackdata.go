@@ -0,0 +1,81 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Telegram ограничивает данные кнопки 64 байтами, длиннее их прислать может только подделанный клиент
+const maxCallbackData = 64
+
+var (
+	callbackDate  = regexp.MustCompile(`^\d{2}\.\d{2}\.\d{4}$`)
+	callbackTime  = regexp.MustCompile(`^\d{2}:\d{2}$`)
+	callbackIndex = regexp.MustCompile(`^\d{1,3}$`)
+)
+
+// Кнопки, в данных которых после префикса идет ID брони
+var reservationCallbackPrefixes = []string{"edit_select_", "edit_delete_", "edit_confirmdelete_", "approve_", "decline_", "table_"}
+
+// Проверяет значение, которое обработчик кнопки возьмет из данных как дату, время
+// или ID брони. Вызывать под statesMu: ID сверяются с загруженными бронями
+func validCallbackData(data string) bool {
+	if len(data) > maxCallbackData {
+		return false
+	}
+
+	switch {
+	case data == "time_manual":
+		// Шаг диалога, на котором кнопка действует, проверяет обработчик
+		return true
+	case strings.HasPrefix(data, "time_"):
+		value := strings.TrimPrefix(data, "time_")
+		if !callbackTime.MatchString(value) {
+			return false
+		}
+		_, err := time.ParseInLocation("15:04", value, loc)
+		return err == nil
+	case strings.HasPrefix(data, "date_"):
+		return validCallbackDate(strings.TrimPrefix(data, "date_"))
+	case strings.HasPrefix(data, "venue_"):
+		return callbackIndex.MatchString(strings.TrimPrefix(data, "venue_"))
+	case strings.HasPrefix(data, "seat_"):
+		return callbackIndex.MatchString(strings.TrimPrefix(data, "seat_"))
+	case strings.HasPrefix(data, "status_"):
+		_, id, ok := strings.Cut(strings.TrimPrefix(data, "status_"), "_")
+		return ok && knownReservationID(id)
+	case strings.HasPrefix(data, "tableset_"):
+		id, table, ok := strings.Cut(strings.TrimPrefix(data, "tableset_"), "_")
+		return ok && (table == "-" || callbackIndex.MatchString(table)) && knownReservationID(id)
+	case strings.HasPrefix(data, "feedback_"):
+		rating, id, ok := strings.Cut(strings.TrimPrefix(data, "feedback_"), "_")
+		return ok && callbackIndex.MatchString(rating) && knownReservationID(id)
+	}
+
+	for _, prefix := range reservationCallbackPrefixes {
+		if strings.HasPrefix(data, prefix) {
+			return knownReservationID(strings.TrimPrefix(data, prefix))
+		}
+	}
+	return true
+}
+
+// Дата из окна, которое показывает askForDate. Вчерашние кнопки после полуночи
+// еще висят на экране, их отклонит проверка времени с понятным гостю сообщением
+func validCallbackDate(value string) bool {
+	if !callbackDate.MatchString(value) {
+		return false
+	}
+	date, err := time.ParseInLocation("02.01.2006", value, loc)
+	if err != nil {
+		return false
+	}
+	today := truncateToDay(clock.Now())
+	return !date.Before(today.AddDate(0, 0, -1)) && date.Before(today.AddDate(0, 0, bookingDays))
+}
+
+func knownReservationID(id string) bool {
+	_, exists := reservations[id]
+	return exists
+}
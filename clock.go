@@ -0,0 +1,16 @@
+package main
+
+import "time"
+
+// Источник текущего времени; в тестах подменяется фиксированными часами
+type Clock interface {
+	Now() time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now().In(loc)
+}
+
+var clock Clock = realClock{}
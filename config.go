@@ -0,0 +1,606 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultManagerPhone     = "ТУТ НОМЕР БУДЕТ ХОСТЕС"
+	defaultAdminChat        = "5069516411"
+	defaultReservationsFile = "reservations.csv"
+	defaultUserStatesFile   = "user_states.json"
+	defaultProfilesFile     = "profiles.json"
+	defaultBlocklistFile    = "blocklist.json"
+	defaultArchiveFile      = "reservations_archive.csv"
+	defaultRetentionDays    = 365
+	defaultTimeZone         = "Europe/Moscow"
+	defaultMinBookingLead   = 2 * time.Hour
+	defaultReservationTTL   = 15 * time.Minute
+	defaultUserStateTTL     = 24 * time.Hour
+	defaultIdleTimeout      = 30 * time.Minute
+	defaultMaxGuests        = 20
+	defaultMaxComment       = 500
+	defaultBlackoutFile     = "blackout_dates.txt"
+	defaultPhoneRegion      = "RU"
+	defaultVenueName        = "Ресторан"
+	defaultMenuFile         = "menu.pdf"
+	defaultSeatingOptions   = "В зале,На террасе"
+	defaultGoogleSheetName  = "Sheet1"
+	defaultSMTPPort         = 587
+	defaultEventDuration    = 2 * time.Hour
+	defaultDepositCurrency  = "RUB"
+	defaultDepositTimeout   = time.Hour
+	defaultRateLimit        = 30
+	defaultRateBurst        = 10
+	defaultLogMaxSizeMB     = 50
+	defaultLogMaxBackups    = 5
+	defaultDailySummaryTime = "10:00"
+	defaultDailySummaryFile = "daily_summary_sent.txt"
+)
+
+// Config собирается один раз в main из переменных окружения (и .env).
+type Config struct {
+	BotToken         string
+	ManagerPhone     string
+	ManagerName      string // имя в карточке контакта; по умолчанию VENUE_NAME
+	AdminChatIDs     []int64
+	ReservationsFile string
+	UserStatesFile   string
+	ProfilesFile     string
+	BlocklistFile    string
+	ArchiveFile      string // пусто — устаревшие брони просто удаляются
+	RetentionDays    int
+	TimeZone         string
+	MinBookingLead   time.Duration
+	ReservationTTL   time.Duration // сколько бронь активна после времени визита, см. isUpcoming
+	UserStateTTL     time.Duration
+	IdleTimeout      time.Duration
+	NotifyIdle       bool
+	MaxGuests        int
+	MaxGuestsPerSlot int  // 0 — вместимость слота не ограничена
+	HideFullSlots    bool // скрывать заполненные слоты вместо показа остатка мест
+	SnapToGrid       bool // округлять время вне сетки слотов вместо отказа
+	MaxCommentLength int
+	MinGuests        int
+	AskChildSeat     bool // спрашивать про детский стул после количества гостей
+	AskFeedback      bool // просить оценку после завершения визита
+	ClosedWeekdays   map[time.Weekday]bool
+	WorkingHours     map[time.Weekday]hoursRange // дни, где часы отличаются от обычных
+	BlackoutDates    map[string]bool
+	PhoneRegion      string
+	BotCommands      string
+	VenueName        string
+	VenueAddress     string
+	MenuFile         string
+	SeatingOptions   []string
+	EventDuration    time.Duration
+
+	// Координаты для кнопки «Как добраться»; без них кнопка не показывается
+	VenueLatitude    float64
+	VenueLongitude   float64
+	VenueLocationSet bool
+
+	// Столы зала для подсказки при назначении стола; пусто — стол вводится вручную
+	Tables []tableSpec
+
+	// Предоплата через Telegram Payments; пустой PAYMENT_PROVIDER_TOKEN ее отключает
+	PaymentProviderToken string
+	DepositAmount        int // в копейках
+	DepositCurrency      string
+	DepositMinGuests     int
+	DepositDays          map[time.Weekday]bool
+	DepositTimeout       time.Duration // сколько неоплаченная бронь держит место в слоте
+
+	// Сразу подтверждать брони гостей с таким числом визитов без неявок; 0 — все брони
+	AutoConfirmAfter int
+
+	// VERIFY_PHONE: номер гостя подтверждается кодом из SMS, нужен SMS_PROVIDER
+	VerifyPhone bool
+
+	// BLOCKED_RESERVATIONS=cancel снимает активные брони при блокировке; по умолчанию keep
+	CancelBlockedReservations bool
+
+	// За сколько до визита напомнить гостю о брони; 0 — напоминания отключены
+	ReminderBefore time.Duration
+
+	// QUIET_HOURS=23:00-09:00: напоминания и сводка не уходят в это время
+	QuietHours quietHours
+
+	// Свой текст подтверждения брони вместо стандартного, см. parseConfirmationTemplate
+	ConfirmationTemplate string
+
+	// За сколько часов до визита гость уже не может отменить бронь сам; 0 — в любой момент
+	CancelDeadlineHours int
+
+	// Заведения сети из VENUES_FILE; без него — одно заведение из VENUE_*
+	Venues []Venue
+
+	// Сообщений в минуту на пользователя
+	RateLimitPerMinute int
+	RateLimitBurst     int
+
+	LogLevel      slog.Level
+	LogFile       string
+	LogMaxSizeMB  int
+	LogMaxBackups int
+	BotDebug      bool
+
+	// Только память, без записи файлов и уведомлений администраторам, см. main
+	DryRun bool
+
+	// Выгрузка броней в Google Таблицу; пустой GOOGLE_SHEET_ID ее отключает
+	GoogleSheetID         string
+	GoogleSheetName       string
+	GoogleCredentialsFile string
+
+	// Вебхук для внешней CRM; тело подписывается HMAC-SHA256, если задан секрет
+	WebhookURL    string
+	WebhookSecret string
+
+	// Почтовые уведомления персоналу; пустой SMTP_HOST их отключает
+	SMTPHost     string
+	SMTPPort     int
+	SMTPUser     string
+	SMTPPassword string
+	SMTPFrom     string
+	SMTPTo       []string
+
+	// SMS-подтверждения гостю; пустой SMS_PROVIDER их отключает
+	SMSProvider   string
+	SMSAPIURL     string
+	SMSAccountSID string
+	SMSAuthToken  string
+	SMSFrom       string
+
+	// Адрес HTTP-сервера метрик, например ":9090"; пусто — метрики отключены
+	MetricsAddr string
+
+	DailySummaryEnabled   bool
+	DailySummaryMinutes   int
+	DailySummaryStateFile string
+}
+
+var weekdayNames = map[string]time.Weekday{
+	"sun": time.Sunday, "sunday": time.Sunday, "вс": time.Sunday, "воскресенье": time.Sunday,
+	"mon": time.Monday, "monday": time.Monday, "пн": time.Monday, "понедельник": time.Monday,
+	"tue": time.Tuesday, "tuesday": time.Tuesday, "вт": time.Tuesday, "вторник": time.Tuesday,
+	"wed": time.Wednesday, "wednesday": time.Wednesday, "ср": time.Wednesday, "среда": time.Wednesday,
+	"thu": time.Thursday, "thursday": time.Thursday, "чт": time.Thursday, "четверг": time.Thursday,
+	"fri": time.Friday, "friday": time.Friday, "пт": time.Friday, "пятница": time.Friday,
+	"sat": time.Saturday, "saturday": time.Saturday, "сб": time.Saturday, "суббота": time.Saturday,
+}
+
+func loadConfig() (Config, error) {
+	var errs []error
+
+	c := Config{
+		BotToken:         os.Getenv("TELEGRAM_BOT_TOKEN"),
+		ManagerPhone:     getEnv("MANAGER_PHONE", defaultManagerPhone),
+		ManagerName:      os.Getenv("MANAGER_NAME"),
+		ReservationsFile: getEnv("RESERVATIONS_FILE", defaultReservationsFile),
+		UserStatesFile:   getEnv("USER_STATES_FILE", defaultUserStatesFile),
+		ProfilesFile:     getEnv("PROFILES_FILE", defaultProfilesFile),
+		BlocklistFile:    getEnv("BLOCKLIST_FILE", defaultBlocklistFile),
+		RetentionDays:    getEnvInt("RETENTION_DAYS", defaultRetentionDays, &errs),
+		TimeZone:         getEnv("TIMEZONE", defaultTimeZone),
+		ReservationTTL:   getEnvDuration("RESERVATION_TTL", defaultReservationTTL, &errs),
+		UserStateTTL:     getEnvDuration("USER_STATE_TTL", defaultUserStateTTL, &errs),
+		IdleTimeout:      getEnvDuration("BOOKING_IDLE_TIMEOUT", defaultIdleTimeout, &errs),
+		NotifyIdle:       getEnvBool("BOOKING_IDLE_NOTIFY", true, &errs),
+		MaxGuests:        getEnvInt("MAX_GUESTS", defaultMaxGuests, &errs),
+		MaxCommentLength: getEnvInt("MAX_COMMENT_LENGTH", defaultMaxComment, &errs),
+		MinGuests:        getEnvInt("MIN_GUESTS", 1, &errs),
+		AskChildSeat:     getEnvBool("ASK_CHILD_SEAT", false, &errs),
+		AskFeedback:      getEnvBool("ASK_FEEDBACK", false, &errs),
+		MaxGuestsPerSlot: getEnvNonNegativeInt("MAX_GUESTS_PER_SLOT", 0, &errs),
+		PhoneRegion:      strings.ToUpper(getEnv("PHONE_REGION", defaultPhoneRegion)),
+		BotCommands:      os.Getenv("BOT_COMMANDS"),
+		VenueName:        getEnv("VENUE_NAME", defaultVenueName),
+		VenueAddress:     os.Getenv("VENUE_ADDRESS"),
+		MenuFile:         getEnv("MENU_FILE", defaultMenuFile),
+		EventDuration:    getEnvDuration("EVENT_DURATION", defaultEventDuration, &errs),
+
+		MetricsAddr: os.Getenv("METRICS_ADDR"),
+
+		GoogleSheetID:         os.Getenv("GOOGLE_SHEET_ID"),
+		GoogleSheetName:       getEnv("GOOGLE_SHEET_NAME", defaultGoogleSheetName),
+		GoogleCredentialsFile: os.Getenv("GOOGLE_CREDENTIALS_FILE"),
+
+		WebhookURL:    os.Getenv("RESERVATION_WEBHOOK_URL"),
+		WebhookSecret: os.Getenv("RESERVATION_WEBHOOK_SECRET"),
+
+		SMTPHost:     os.Getenv("SMTP_HOST"),
+		SMTPPort:     getEnvInt("SMTP_PORT", defaultSMTPPort, &errs),
+		SMTPUser:     os.Getenv("SMTP_USER"),
+		SMTPPassword: os.Getenv("SMTP_PASSWORD"),
+		SMTPFrom:     os.Getenv("SMTP_FROM"),
+
+		SMSProvider:   strings.ToLower(os.Getenv("SMS_PROVIDER")),
+		SMSAPIURL:     os.Getenv("SMS_API_URL"),
+		SMSAccountSID: os.Getenv("SMS_ACCOUNT_SID"),
+		SMSAuthToken:  os.Getenv("SMS_AUTH_TOKEN"),
+		SMSFrom:       os.Getenv("SMS_FROM"),
+
+		RateLimitBurst: getEnvInt("RATE_LIMIT_BURST", defaultRateBurst, &errs),
+
+		LogFile:       os.Getenv("LOG_FILE"),
+		LogMaxSizeMB:  getEnvInt("LOG_MAX_SIZE_MB", defaultLogMaxSizeMB, &errs),
+		LogMaxBackups: getEnvInt("LOG_MAX_BACKUPS", defaultLogMaxBackups, &errs),
+		BotDebug:      getEnvBool("BOT_DEBUG", false, &errs),
+		DryRun:        getEnvBool("DRY_RUN", false, &errs),
+
+		DailySummaryStateFile: getEnv("DAILY_SUMMARY_STATE_FILE", defaultDailySummaryFile),
+
+		CancelDeadlineHours: getEnvNonNegativeInt("CANCEL_DEADLINE_HOURS", 0, &errs),
+		ReminderBefore:      getEnvOptionalDuration("REMINDER_BEFORE", 0, &errs),
+
+		PaymentProviderToken: os.Getenv("PAYMENT_PROVIDER_TOKEN"),
+		DepositAmount:        getEnvInt("DEPOSIT_AMOUNT", 0, &errs) * 100,
+		DepositCurrency:      strings.ToUpper(getEnv("DEPOSIT_CURRENCY", defaultDepositCurrency)),
+		DepositMinGuests:     getEnvNonNegativeInt("DEPOSIT_MIN_GUESTS", 0, &errs),
+		DepositTimeout:       getEnvDuration("DEPOSIT_TIMEOUT", defaultDepositTimeout, &errs),
+
+		VerifyPhone:      getEnvBool("VERIFY_PHONE", false, &errs),
+		AutoConfirmAfter: getEnvNonNegativeInt("AUTO_CONFIRM_AFTER", 0, &errs),
+
+		// В .env перевод строки удобнее записать как \n
+		ConfirmationTemplate: strings.ReplaceAll(os.Getenv("CONFIRMATION_TEMPLATE"), `\n`, "\n"),
+	}
+
+	if c.BotToken == "" {
+		errs = append(errs, errors.New("токен бота не установлен (TELEGRAM_BOT_TOKEN)"))
+	}
+
+	var err error
+	if c.AdminChatIDs, err = parseChatIDs(getEnv("ADMIN_CHAT_IDS", defaultAdminChat)); err != nil {
+		errs = append(errs, err)
+	}
+	if c.ClosedWeekdays, err = parseWeekdays(os.Getenv("CLOSED_DAYS")); err != nil {
+		errs = append(errs, fmt.Errorf("CLOSED_DAYS: %w", err))
+	}
+	if c.WorkingHours, err = parseWorkingHours(os.Getenv("WORKING_HOURS")); err != nil {
+		errs = append(errs, fmt.Errorf("WORKING_HOURS: %w", err))
+	}
+	if c.DepositDays, err = parseWeekdays(os.Getenv("DEPOSIT_DAYS")); err != nil {
+		errs = append(errs, fmt.Errorf("DEPOSIT_DAYS: %w", err))
+	}
+	if c.QuietHours, err = parseQuietHours(os.Getenv("QUIET_HOURS")); err != nil {
+		errs = append(errs, fmt.Errorf("QUIET_HOURS: %w", err))
+	}
+	if c.Tables, err = parseTableMap(os.Getenv("TABLES")); err != nil {
+		errs = append(errs, fmt.Errorf("TABLES: %w", err))
+	}
+	if c.BlackoutDates, err = loadBlackoutDates(getEnv("BLACKOUT_DATES_FILE", defaultBlackoutFile)); err != nil {
+		errs = append(errs, err)
+	}
+
+	// BOOKING_LEAD задается длительностью, например 90m; старый MIN_BOOKING_HOURS в часах тоже работает
+	if os.Getenv("BOOKING_LEAD") != "" {
+		c.MinBookingLead = getEnvDuration("BOOKING_LEAD", defaultMinBookingLead, &errs)
+	} else {
+		c.MinBookingLead = time.Duration(getEnvInt("MIN_BOOKING_HOURS", int(defaultMinBookingLead/time.Hour), &errs)) * time.Hour
+	}
+
+	switch policy := getEnv("BLOCKED_RESERVATIONS", "keep"); policy {
+	case "keep":
+	case "cancel":
+		c.CancelBlockedReservations = true
+	default:
+		errs = append(errs, fmt.Errorf("некорректное значение BLOCKED_RESERVATIONS=%q, ожидалось keep или cancel", policy))
+	}
+
+	// Пустое ARCHIVE_FILE отключает архив
+	if archive, ok := os.LookupEnv("ARCHIVE_FILE"); ok {
+		c.ArchiveFile = archive
+	} else {
+		c.ArchiveFile = defaultArchiveFile
+	}
+
+	// Пустое SEATING_OPTIONS убирает шаг выбора места
+	seating, ok := os.LookupEnv("SEATING_OPTIONS")
+	if !ok {
+		seating = defaultSeatingOptions
+	}
+	for _, option := range strings.Split(seating, ",") {
+		if option = strings.TrimSpace(option); option != "" {
+			c.SeatingOptions = append(c.SeatingOptions, option)
+		}
+	}
+
+	if lat, lon := os.Getenv("VENUE_LATITUDE"), os.Getenv("VENUE_LONGITUDE"); lat != "" || lon != "" {
+		if c.VenueLatitude, c.VenueLongitude, err = parseCoordinates(lat, lon); err != nil {
+			errs = append(errs, err)
+		} else {
+			c.VenueLocationSet = true
+		}
+	}
+
+	if path := os.Getenv("VENUES_FILE"); path != "" {
+		if c.Venues, err = loadVenues(path, c); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(c.Venues) == 0 {
+		c.Venues = []Venue{defaultVenue(c)}
+	}
+	for i := range c.Venues {
+		v := &c.Venues[i]
+		if v.Confirmation == "" {
+			continue
+		}
+		if v.confirmation, err = parseConfirmationTemplate(v.Confirmation); err != nil {
+			if v.ID == "" {
+				errs = append(errs, fmt.Errorf("CONFIRMATION_TEMPLATE: %w", err))
+			} else {
+				errs = append(errs, fmt.Errorf("заведение %s, confirmation: %w", v.ID, err))
+			}
+		}
+	}
+
+	switch mode := getEnv("TIME_GRID", "reject"); mode {
+	case "reject":
+	case "snap":
+		c.SnapToGrid = true
+	default:
+		errs = append(errs, fmt.Errorf("некорректное значение TIME_GRID=%q, ожидалось reject или snap", mode))
+	}
+
+	switch mode := getEnv("SLOT_AVAILABILITY", "count"); mode {
+	case "count":
+	case "hide":
+		c.HideFullSlots = true
+	default:
+		errs = append(errs, fmt.Errorf("некорректное значение SLOT_AVAILABILITY=%q, ожидалось count или hide", mode))
+	}
+
+	// RATE_LIMIT_PER_MINUTE=0 отключает ограничение
+	if os.Getenv("RATE_LIMIT_PER_MINUTE") != "0" {
+		c.RateLimitPerMinute = getEnvInt("RATE_LIMIT_PER_MINUTE", defaultRateLimit, &errs)
+	}
+
+	if err := c.LogLevel.UnmarshalText([]byte(getEnv("LOG_LEVEL", "info"))); err != nil {
+		errs = append(errs, fmt.Errorf("LOG_LEVEL: %w", err))
+	}
+
+	// DAILY_SUMMARY_TIME=off отключает ежедневную сводку
+	if summaryTime := getEnv("DAILY_SUMMARY_TIME", defaultDailySummaryTime); summaryTime != "off" {
+		c.DailySummaryEnabled = true
+		if c.DailySummaryMinutes, err = parseClock(summaryTime); err != nil {
+			errs = append(errs, fmt.Errorf("DAILY_SUMMARY_TIME: %w", err))
+		}
+	}
+
+	for _, addr := range strings.Split(os.Getenv("SMTP_TO"), ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			c.SMTPTo = append(c.SMTPTo, addr)
+		}
+	}
+	if c.ManagerName == "" {
+		c.ManagerName = c.VenueName
+	}
+	if c.SMTPFrom == "" {
+		c.SMTPFrom = c.SMTPUser
+	}
+	if c.SMTPHost != "" && (len(c.SMTPTo) == 0 || c.SMTPFrom == "") {
+		errs = append(errs, errors.New("для SMTP_HOST нужны получатели (SMTP_TO) и отправитель (SMTP_FROM или SMTP_USER)"))
+	}
+
+	if c.MinGuests > c.MaxGuests {
+		errs = append(errs, fmt.Errorf("MIN_GUESTS=%d больше MAX_GUESTS=%d", c.MinGuests, c.MaxGuests))
+	}
+
+	if c.SMSProvider != "" && (c.SMSAccountSID == "" || c.SMSAuthToken == "" || c.SMSFrom == "") {
+		errs = append(errs, errors.New("для SMS_PROVIDER нужны SMS_ACCOUNT_SID, SMS_AUTH_TOKEN и SMS_FROM"))
+	}
+
+	// В DRY_RUN коды только пишутся в лог, провайдер не нужен
+	if c.VerifyPhone && c.SMSProvider == "" && !c.DryRun {
+		errs = append(errs, errors.New("для VERIFY_PHONE нужен SMS_PROVIDER"))
+	}
+
+	if c.PaymentProviderToken != "" && c.DepositAmount <= 0 {
+		errs = append(errs, errors.New("для PAYMENT_PROVIDER_TOKEN нужна сумма предоплаты DEPOSIT_AMOUNT"))
+	}
+
+	if c.GoogleSheetID != "" && c.GoogleCredentialsFile == "" {
+		errs = append(errs, errors.New("для GOOGLE_SHEET_ID нужен ключ сервисного аккаунта (GOOGLE_CREDENTIALS_FILE)"))
+	}
+
+	return c, errors.Join(errs...)
+}
+
+func parseCoordinates(lat, lon string) (float64, float64, error) {
+	latitude, err := strconv.ParseFloat(strings.TrimSpace(lat), 64)
+	if err != nil || latitude < -90 || latitude > 90 {
+		return 0, 0, fmt.Errorf("некорректное значение VENUE_LATITUDE=%q", lat)
+	}
+	longitude, err := strconv.ParseFloat(strings.TrimSpace(lon), 64)
+	if err != nil || longitude < -180 || longitude > 180 {
+		return 0, 0, fmt.Errorf("некорректное значение VENUE_LONGITUDE=%q", lon)
+	}
+	return latitude, longitude, nil
+}
+
+// Разбирает время суток ЧЧ:ММ в минуты от полуночи
+func parseClock(value string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(value))
+	if err != nil {
+		return 0, fmt.Errorf("ожидалось время в формате ЧЧ:ММ, получено %q", value)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+func getEnvDuration(key string, defaultValue time.Duration, errs *[]error) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		*errs = append(*errs, fmt.Errorf("некорректное значение %s=%q", key, value))
+		return defaultValue
+	}
+	return d
+}
+
+// Как getEnvDuration, но 0 допустим и отключает функцию
+func getEnvOptionalDuration(key string, defaultValue time.Duration, errs *[]error) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		*errs = append(*errs, fmt.Errorf("некорректное значение %s=%q", key, value))
+		return defaultValue
+	}
+	return d
+}
+
+func getEnvInt(key string, defaultValue int, errs *[]error) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		*errs = append(*errs, fmt.Errorf("некорректное значение %s=%q", key, value))
+		return defaultValue
+	}
+	return n
+}
+
+// Для настроек, где 0 явно отключает функцию
+func getEnvNonNegativeInt(key string, defaultValue int, errs *[]error) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		*errs = append(*errs, fmt.Errorf("некорректное значение %s=%q", key, value))
+		return defaultValue
+	}
+	return n
+}
+
+func getEnvBool(key string, defaultValue bool, errs *[]error) bool {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		*errs = append(*errs, fmt.Errorf("некорректное значение %s=%q", key, value))
+		return defaultValue
+	}
+	return b
+}
+
+func parseWeekdays(value string) (map[time.Weekday]bool, error) {
+	days := make(map[time.Weekday]bool)
+	for _, name := range strings.Split(value, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		day, ok := weekdayNames[name]
+		if !ok {
+			return days, fmt.Errorf("неизвестный день недели: %q", name)
+		}
+		days[day] = true
+	}
+	return days, nil
+}
+
+// Первое и последнее время брони в минутах от полуночи
+type hoursRange struct {
+	Open, LastBooking int
+}
+
+// Формат: "fri,sat=16:00-23:30; sun=12:00-22:00" — дни через запятую,
+// затем первое и последнее время, на которое можно забронировать
+func parseWorkingHours(value string) (map[time.Weekday]hoursRange, error) {
+	result := make(map[time.Weekday]hoursRange)
+	for _, entry := range strings.Split(value, ";") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		days, span, ok := strings.Cut(entry, "=")
+		from, to, ok2 := strings.Cut(span, "-")
+		if !ok || !ok2 {
+			return nil, fmt.Errorf("ожидалось дни=ЧЧ:ММ-ЧЧ:ММ, получено %q", strings.TrimSpace(entry))
+		}
+		open, err := parseClock(from)
+		if err != nil {
+			return nil, err
+		}
+		last, err := parseClock(to)
+		if err != nil {
+			return nil, err
+		}
+		if open > last {
+			return nil, fmt.Errorf("начало %s позже конца %s", strings.TrimSpace(from), strings.TrimSpace(to))
+		}
+		for _, name := range strings.Split(days, ",") {
+			day, ok := weekdayNames[strings.ToLower(strings.TrimSpace(name))]
+			if !ok {
+				return nil, fmt.Errorf("неизвестный день недели: %q", strings.TrimSpace(name))
+			}
+			result[day] = hoursRange{Open: open, LastBooking: last}
+		}
+	}
+	return result, nil
+}
+
+func loadBlackoutDates(path string) (map[string]bool, error) {
+	dates := make(map[string]bool)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return dates, nil
+		}
+		return dates, fmt.Errorf("ошибка чтения файла выходных дней: %w", err)
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if _, err := time.Parse("02.01.2006", line); err != nil {
+			return dates, fmt.Errorf("некорректная дата в файле выходных дней: %q", line)
+		}
+		dates[line] = true
+	}
+	return dates, nil
+}
+
+func parseChatIDs(value string) ([]int64, error) {
+	var ids []int64
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		id, err := strconv.ParseInt(part, 10, 64)
+		if err != nil || id == 0 {
+			return ids, fmt.Errorf("некорректный ID администратора: %q", part)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
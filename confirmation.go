@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"text/template"
+)
+
+// Шаблон подтверждения пишется с одинарными скобками: {name}, {date}, {time}, {guests}.
+// Это обычный text/template, поэтому работают и условия: {if comment}Комментарий: {comment}{end}
+func parseConfirmationTemplate(text string) (*template.Template, error) {
+	tmpl, err := template.New("confirmation").
+		Delims("{", "}").
+		Funcs(confirmationFuncs(Reservation{}, Venue{}, defaultLang)).
+		Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	// Ошибки выполнения (например, {guests.Name}) ловим при запуске, а не на госте
+	sample := Reservation{Code: "A1B2C3", Name: "Гость", Phone: "+79991234567", Guests: 2, Date: "01.01.2030", Time: "19:00"}
+	if _, err := renderConfirmation(tmpl, sample, Venue{Name: "Ресторан"}, defaultLang); err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+// Функции подставляют поля конкретной брони, поэтому задаются заново на каждый вызов
+func confirmationFuncs(r Reservation, venue Venue, lang string) template.FuncMap {
+	comment := r.Comment
+	if comment == "-" {
+		comment = ""
+	}
+	occasion := ""
+	if r.Occasion != "" {
+		occasion = occasionTitle(lang, r.Occasion)
+	}
+	return template.FuncMap{
+		"code":     func() string { return r.Code },
+		"name":     func() string { return r.Name },
+		"phone":    func() string { return formatPhone(r.Phone) },
+		"guests":   func() int { return r.Guests },
+		"date":     func() string { return r.Date },
+		"time":     func() string { return r.Time },
+		"comment":  func() string { return comment },
+		"seating":  func() string { return r.SeatingPreference },
+		"occasion": func() string { return occasion },
+		"venue":    func() string { return venue.Name },
+		"address":  func() string { return venue.Address },
+		"manager":  func() string { return cfg.ManagerPhone },
+	}
+}
+
+func renderConfirmation(tmpl *template.Template, r Reservation, venue Venue, lang string) (string, error) {
+	clone, err := tmpl.Clone()
+	if err != nil {
+		return "", err
+	}
+	var sb strings.Builder
+	if err := clone.Funcs(confirmationFuncs(r, venue, lang)).Execute(&sb, nil); err != nil {
+		return "", fmt.Errorf("ошибка шаблона подтверждения: %w", err)
+	}
+	return sb.String(), nil
+}
+
+// Текст подтверждения для гостя: шаблон заведения или стандартный текст из каталога
+func confirmationText(chatID int64, r Reservation) string {
+	venue := venueByID(r.VenueID)
+	if venue.confirmation != nil {
+		text, err := renderConfirmation(venue.confirmation, r, venue, userLang(chatID))
+		if err == nil && strings.TrimSpace(text) != "" {
+			return text
+		}
+		slog.Error("Шаблон подтверждения не сработал, отправлен стандартный текст", "venueID", r.VenueID, "err", err)
+	}
+
+	text := t(chatID, "confirmed", r.Code, r.Name, formatPhone(r.Phone), r.Guests, r.Date, r.Time)
+	if multiVenue() {
+		text += t(chatID, "venue_line", venue.Name)
+	}
+	if r.Comment != "" && r.Comment != "-" {
+		text += t(chatID, "comment_line", r.Comment)
+	}
+	if r.SeatingPreference != "" {
+		text += t(chatID, "seating_line", r.SeatingPreference)
+	}
+	if r.Occasion != "" {
+		text += t(chatID, "occasion_line", occasionTitle(userLang(chatID), r.Occasion))
+	}
+	if r.NeedsChildSeat {
+		text += t(chatID, "child_seat_line")
+	}
+	return text
+}
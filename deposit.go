@@ -0,0 +1,189 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const depositPayloadPrefix = "deposit_"
+
+// PAYMENT_PROVIDER_TOKEN включает предоплату через Telegram Payments. Сумма берется
+// с гостей от DEPOSIT_MIN_GUESTS человек и в дни DEPOSIT_DAYS (пусто — любой день)
+func depositFor(r Reservation) int {
+	if cfg.PaymentProviderToken == "" || r.CreatedByStaff || r.Guests < cfg.DepositMinGuests {
+		return 0
+	}
+	if len(cfg.DepositDays) > 0 {
+		day, err := time.ParseInLocation("02.01.2006", r.Date, loc)
+		if err != nil || !cfg.DepositDays[day.Weekday()] {
+			return 0
+		}
+	}
+	return cfg.DepositAmount
+}
+
+// Сумма в копейках (минимальных единицах валюты), как ее передает Telegram
+func formatMoney(amount int, currency string) string {
+	if amount%100 == 0 {
+		return fmt.Sprintf("%d %s", amount/100, currency)
+	}
+	return fmt.Sprintf("%d.%02d %s", amount/100, amount%100, currency)
+}
+
+func sendDepositInvoice(bot Sender, chatID int64, r Reservation) {
+	lang := userLang(chatID)
+	amount := formatMoney(r.DepositAmount, cfg.DepositCurrency)
+	sendMessage(bot, chatID, tr(lang, "deposit_invoice", r.Code, amount), false)
+
+	invoice := tgbotapi.NewInvoice(chatID,
+		tr(lang, "deposit_title", r.Code),
+		tr(lang, "deposit_desc", venueByID(r.VenueID).Name, r.Date, r.Time, r.Guests),
+		depositPayloadPrefix+r.ID,
+		cfg.PaymentProviderToken, "", cfg.DepositCurrency,
+		[]tgbotapi.LabeledPrice{{Label: tr(lang, "deposit_label"), Amount: r.DepositAmount}})
+	if err := deliver(bot, chatID, "счет на предоплату", invoice); err != nil {
+		notifyAdmins(bot, r.VenueID, adminReservationCard(
+			fmt.Sprintf("⚠️ Не удалось выставить счет на предоплату брони #%s", r.Code), r)+
+			fmt.Sprintf("\nОшибка: %v", err))
+		sendMessage(bot, chatID, tr(lang, "deposit_no_bill", cfg.ManagerPhone), false)
+	}
+}
+
+// Брони, предоплату по которым не внесли за DEPOSIT_TIMEOUT от выставления счета:
+// они держат место в слоте, поэтому очистка их отменяет
+func unpaidDepositIDs(now time.Time) []string {
+	var unpaid []string
+	for id, r := range reservations {
+		if r.Status != statusPending || r.DepositAmount == 0 || r.DepositPaid {
+			continue
+		}
+		issued := r.StatusChangedAt
+		if issued.IsZero() {
+			issued = r.CreatedAt
+		}
+		if !now.Before(issued.Add(cfg.DepositTimeout)) {
+			unpaid = append(unpaid, id)
+		}
+	}
+	return unpaid
+}
+
+func cancelUnpaidDeposits(bot Sender, now time.Time) {
+	var cancelled []Reservation
+	for _, id := range unpaidDepositIDs(now) {
+		r := reservations[id]
+		r.Status = statusCancelled
+		r.StatusChangedAt = now
+		cancelled = append(cancelled, r)
+	}
+	if len(cancelled) == 0 {
+		return
+	}
+	if err := updateReservationsInFile(cancelled...); err != nil {
+		slog.Error("Не удалось отменить неоплаченные брони", "err", err)
+		storageErrors.Inc()
+		return
+	}
+	for _, r := range cancelled {
+		reservations[r.ID] = r
+		bookingsCancelled.Inc()
+		publishReservationEvent(eventDeleted, r)
+		notifyAdmins(bot, r.VenueID, adminReservationCard(
+			fmt.Sprintf("⌛ Бронь #%s отменена: предоплата не внесена за %s", r.Code, cfg.DepositTimeout), r))
+		sendMessage(bot, r.ChatID, tr(r.Lang, "deposit_expired", r.Code, cfg.ManagerPhone), false)
+	}
+	slog.Info("Отменены брони без предоплаты", "count", len(cancelled))
+}
+
+// Бронь, за которую еще можно заплатить по счету из payload
+func payableReservation(payload string, chatID int64) (Reservation, bool) {
+	id, ok := strings.CutPrefix(payload, depositPayloadPrefix)
+	if !ok {
+		return Reservation{}, false
+	}
+	r, exists := reservations[id]
+	if !exists || r.ChatID != chatID || r.Status != statusPending || r.DepositAmount == 0 || r.DepositPaid {
+		return Reservation{}, false
+	}
+	return r, true
+}
+
+// Telegram ждет ответа на PreCheckoutQuery не дольше 10 секунд; отказ сохраняет бронь
+// неоплаченной, гость может оплатить тот же счет позже
+func handlePreCheckout(bot Sender, query *tgbotapi.PreCheckoutQuery) {
+	answer := tgbotapi.PreCheckoutConfig{PreCheckoutQueryID: query.ID, OK: true}
+	r, ok := payableReservation(query.InvoicePayload, query.From.ID)
+	if !ok || query.Currency != cfg.DepositCurrency || query.TotalAmount != r.DepositAmount {
+		slog.Warn("Оплата предоплаты отклонена", "chatID", query.From.ID, "payload", query.InvoicePayload,
+			"amount", query.TotalAmount, "currency", query.Currency)
+		answer.OK = false
+		answer.ErrorMessage = tr(detectLang(query.From.LanguageCode), "deposit_refused")
+	} else if visit, err := reservationDateTime(r); err != nil || !visit.After(clock.Now()) {
+		slog.Info("Оплата предоплаты после начала визита отклонена", "reservationID", r.ID)
+		answer.OK = false
+		answer.ErrorMessage = tr(detectLang(query.From.LanguageCode), "deposit_refused")
+	}
+	if _, err := bot.Request(answer); err != nil {
+		slog.Error("Ошибка ответа на PreCheckoutQuery", "chatID", query.From.ID, "err", err)
+	}
+}
+
+// Деньги уже списаны, поэтому даже если бронь с тех пор изменилась, платеж
+// запоминаем или передаем администраторам для ручного возврата
+func handleSuccessfulPayment(bot Sender, chatID int64, payment *tgbotapi.SuccessfulPayment) {
+	slog.Info("Получена предоплата", "chatID", chatID, "payload", payment.InvoicePayload,
+		"amount", payment.TotalAmount, "currency", payment.Currency, "chargeID", payment.TelegramPaymentChargeID)
+	amount := formatMoney(payment.TotalAmount, payment.Currency)
+
+	r, ok := payableReservation(payment.InvoicePayload, chatID)
+	if !ok {
+		slog.Error("Предоплата не сопоставлена с бронью", "chatID", chatID, "payload", payment.InvoicePayload)
+		// Бронь могли отменить, пока гость платил, — тогда пишем администраторам ее заведения
+		venueID := reservations[strings.TrimPrefix(payment.InvoicePayload, depositPayloadPrefix)].VenueID
+		notifyAdmins(bot, venueID, fmt.Sprintf("⚠️ Получена предоплата %s без ожидающей брони (%s), нужен возврат.\nЧат гостя: %d\nПлатеж: %s",
+			amount, payment.InvoicePayload, chatID, payment.TelegramPaymentChargeID))
+		sendMessage(bot, chatID, t(chatID, "deposit_failed", cfg.ManagerPhone), false)
+		return
+	}
+
+	r.DepositPaid = true
+	r.DepositAmount = payment.TotalAmount
+	r.PaymentChargeID = payment.TelegramPaymentChargeID
+	if !needsApproval(r) {
+		r.Status = statusConfirmed
+		r.StatusChangedAt = clock.Now()
+	}
+	if err := updateReservationsInFile(r); err != nil {
+		slog.Error("Предоплата не сохранена", "chatID", chatID, "reservationID", r.ID, "err", err)
+		storageErrors.Inc()
+		notifyAdmins(bot, r.VenueID, adminReservationCard(
+			fmt.Sprintf("⚠️ Предоплата %s по брони #%s получена, но не сохранена", amount, r.Code), r)+
+			fmt.Sprintf("\nПлатеж: %s\nОшибка: %v", r.PaymentChargeID, err))
+		sendMessage(bot, chatID, t(chatID, "deposit_failed", cfg.ManagerPhone), false)
+		return
+	}
+	reservations[r.ID] = r
+	publishReservationEvent(eventUpdated, r)
+	sendMessage(bot, chatID, t(chatID, "deposit_paid", amount), false)
+
+	if r.Status == statusPending {
+		sendToAdmins(bot, r.VenueID, adminReservationCard(fmt.Sprintf("🕓 Бронь #%s оплачена и ждет подтверждения!", r.Code), r),
+			adminApprovalKeyboard(r.ID))
+		deliver(bot, chatID, "бронь ждет подтверждения", tgbotapi.NewMessage(chatID, t(chatID, "pending",
+			r.Code, r.Name, formatPhone(r.Phone), r.Guests, r.Date, r.Time)))
+		return
+	}
+
+	sendToAdmins(bot, r.VenueID, adminReservationCard(fmt.Sprintf("💳 Бронь #%s оплачена и подтверждена!", r.Code), r),
+		adminStatusKeyboard(r.ID))
+	msg := tgbotapi.NewMessage(chatID, confirmationText(chatID, r))
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData(t(chatID, "btn_edit_this"), "edit_select_"+r.ID),
+	))
+	deliver(bot, chatID, "подтверждение брони", msg)
+	sendReservationICS(bot, chatID, r)
+}
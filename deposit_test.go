@@ -0,0 +1,131 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+var depositEnv = map[string]string{
+	"PAYMENT_PROVIDER_TOKEN": "provider",
+	"DEPOSIT_AMOUNT":         "1000",
+	"DEPOSIT_MIN_GUESTS":     "6",
+	"DEPOSIT_TIMEOUT":        "30m",
+}
+
+// Счета на предоплату, выставленные чату
+func (b *testBot) invoices(chatID int64) []tgbotapi.InvoiceConfig {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var list []tgbotapi.InvoiceConfig
+	for _, c := range b.sent {
+		if invoice, ok := c.(tgbotapi.InvoiceConfig); ok && invoice.ChatID == chatID {
+			list = append(list, invoice)
+		}
+	}
+	return list
+}
+
+func (b *testBot) editGuests(r Reservation, guests string) {
+	b.t.Helper()
+	b.press(r.ChatID, "edit_select_"+r.ID)
+	b.pressButton(r.ChatID, "edit_change_guests")
+	b.say(r.ChatID, guests)
+	b.pressButton(r.ChatID, "edit_confirm")
+}
+
+func TestEditIntoDepositRequiresPayment(t *testing.T) {
+	b := setupTest(t, "14.10.2026 12:00", depositEnv)
+	r := b.book(testGuestID, "2", "15.10.2026", "19:00")
+	if r.Status != statusConfirmed || r.DepositAmount != 0 || len(b.invoices(testGuestID)) != 0 {
+		t.Fatalf("бронь на двоих без предоплаты: %+v", r)
+	}
+
+	b.editGuests(r, "12")
+	edited := reservations[r.ID]
+	if edited.Guests != 12 || edited.Status != statusPending || edited.DepositAmount != 100000 {
+		t.Fatalf("правка обошла предоплату: %+v", edited)
+	}
+	invoices := b.invoices(testGuestID)
+	if len(invoices) != 1 || invoices[0].Prices[0].Amount != 100000 || invoices[0].Payload != depositPayloadPrefix+r.ID {
+		t.Fatalf("счет после правки: %+v", invoices)
+	}
+	if !b.received(testAdminID, "Бронь #"+r.Code+" отредактирована и ждет предоплаты") {
+		t.Fatalf("администратор не узнал о предоплате: %q", b.texts(testAdminID))
+	}
+
+	// Обратно на двоих: предоплата больше не нужна, бронь снова подтверждена
+	b.editGuests(edited, "2")
+	if got := reservations[r.ID]; got.Status != statusConfirmed || got.DepositAmount != 0 {
+		t.Fatalf("после возврата к двум гостям: %+v", got)
+	}
+	if _, ok := payableReservation(depositPayloadPrefix+r.ID, testGuestID); ok {
+		t.Fatal("старый счет все еще можно оплатить")
+	}
+}
+
+func TestEditRequiresApprovalAgain(t *testing.T) {
+	b := setupTest(t, "14.10.2026 12:00", map[string]string{"AUTO_CONFIRM_AFTER": "1"})
+	r := b.book(testGuestID, "2", "15.10.2026", "19:00")
+	if r.Status != statusPending {
+		t.Fatalf("бронь нового гостя без одобрения: %s", r.Status)
+	}
+	b.press(testAdminID, "approve_"+r.ID)
+	if reservations[r.ID].Status != statusConfirmed {
+		t.Fatalf("бронь не одобрена: %s", reservations[r.ID].Status)
+	}
+	b.reset()
+
+	b.editGuests(reservations[r.ID], "12")
+	if got := reservations[r.ID]; got.Status != statusPending || got.Guests != 12 {
+		t.Fatalf("правка обошла одобрение: %+v", got)
+	}
+	if _, ok := b.button(testAdminID, "approve_"+r.ID); !ok {
+		t.Fatalf("администратор не получил кнопки одобрения: %q", b.texts(testAdminID))
+	}
+	if !b.received(testGuestID, "#"+r.Code) {
+		t.Fatalf("гость не узнал, что бронь ждет подтверждения: %q", b.texts(testGuestID))
+	}
+}
+
+func TestUnpaidDepositCancelledAfterTimeout(t *testing.T) {
+	env := map[string]string{"MAX_GUESTS_PER_SLOT": "10"}
+	for k, v := range depositEnv {
+		env[k] = v
+	}
+	b := setupTest(t, "14.10.2026 12:00", env)
+	r := b.book(testGuestID, "8", "15.10.2026", "19:00")
+	if r.Status != statusPending || r.DepositAmount == 0 {
+		t.Fatalf("бронь на восьмерых без предоплаты: %+v", r)
+	}
+	next := Reservation{ID: "next", Date: r.Date, Time: r.Time, Guests: 8}
+	if checkSlotCapacity(langRU, next) == nil {
+		t.Fatal("неоплаченная бронь не занимает место в слоте")
+	}
+
+	b.clock.advance(29 * time.Minute)
+	cleanupPass(b, clock.Now())
+	if reservations[r.ID].Status != statusPending {
+		t.Fatalf("бронь отменена до DEPOSIT_TIMEOUT: %s", reservations[r.ID].Status)
+	}
+
+	b.clock.advance(time.Minute)
+	cleanupPass(b, clock.Now())
+	reloadReservations(t)
+	if got := reservations[r.ID]; got.Status != statusCancelled {
+		t.Fatalf("неоплаченная бронь не отменена: %s", got.Status)
+	}
+	if !b.received(testGuestID, tr(langRU, "deposit_expired", r.Code, cfg.ManagerPhone)) {
+		t.Fatalf("гость не узнал об отмене: %q", b.texts(testGuestID))
+	}
+	if !b.received(testAdminID, "Бронь #"+r.Code+" отменена: предоплата не внесена") {
+		t.Fatalf("администратор не узнал об отмене: %q", b.texts(testAdminID))
+	}
+	if _, ok := payableReservation(depositPayloadPrefix+r.ID, testGuestID); ok {
+		t.Fatal("отмененную бронь все еще можно оплатить")
+	}
+	if err := checkSlotCapacity(langRU, next); err != nil {
+		t.Fatalf("слот остался занятым: %v", err)
+	}
+}
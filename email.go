@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"mime"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+)
+
+const emailQueueSize = 50
+
+var emailTemplate = template.Must(template.New("email").Parse(`<!DOCTYPE html>
+<html><body style="font-family: sans-serif">
+<h2>{{.Title}}</h2>
+<table cellpadding="4" style="border-collapse: collapse">
+<tr><td><b>Бронь</b></td><td>#{{.R.Code}}</td></tr>
+<tr><td><b>Имя</b></td><td>{{.R.Name}}</td></tr>
+<tr><td><b>Телефон</b></td><td>{{.R.Phone}}</td></tr>
+{{if .R.Username}}<tr><td><b>Telegram</b></td><td>@{{.R.Username}}</td></tr>{{end}}
+<tr><td><b>Гостей</b></td><td>{{.R.Guests}}</td></tr>
+<tr><td><b>Дата</b></td><td>{{.R.Date}}</td></tr>
+<tr><td><b>Время</b></td><td>{{.R.Time}}</td></tr>
+{{if .R.SeatingPreference}}<tr><td><b>Место</b></td><td>{{.R.SeatingPreference}}</td></tr>{{end}}
+{{if .Occasion}}<tr><td><b>Повод</b></td><td>{{.Occasion}}</td></tr>{{end}}
+{{if .R.Comment}}<tr><td><b>Комментарий</b></td><td>{{.R.Comment}}</td></tr>{{end}}
+</table>
+</body></html>
+`))
+
+// Дублирует уведомления о новых и отменённых бронях на почту, если задан SMTP_HOST
+func startEmailNotifications(c Config) {
+	if c.SMTPHost == "" {
+		return
+	}
+
+	queue := make(chan reservationEvent, emailQueueSize)
+	go func() {
+		for event := range queue {
+			if err := sendReservationEmail(c, event); err != nil {
+				slog.Error("Не удалось отправить письмо", "reservationID", event.Reservation.ID, "err", err)
+			}
+		}
+	}()
+
+	eventSinks = append(eventSinks, func(event reservationEvent) {
+		if emailSubject(event) == "" {
+			return
+		}
+		select {
+		case queue <- event:
+		default:
+			slog.Warn("Очередь писем переполнена, письмо пропущено", "reservationID", event.Reservation.ID)
+		}
+	})
+	slog.Info("Уведомления на почту включены", "recipients", len(c.SMTPTo))
+}
+
+func emailSubject(event reservationEvent) string {
+	switch {
+	case event.Type == eventCreated:
+		return "Новая бронь"
+	case event.Type == eventDeleted,
+		event.Type == eventUpdated && event.Reservation.Status == statusCancelled:
+		return "Бронь отменена"
+	}
+	return ""
+}
+
+func sendReservationEmail(c Config, event reservationEvent) error {
+	r := event.Reservation
+	title := emailSubject(event)
+
+	var body bytes.Buffer
+	err := emailTemplate.Execute(&body, struct {
+		Title    string
+		R        Reservation
+		Occasion string
+	}{title, r, occasionTitle(langRU, r.Occasion)})
+	if err != nil {
+		return err
+	}
+
+	subject := fmt.Sprintf("%s #%s: %s %s, %d гост.", title, r.Code, r.Date, r.Time, r.Guests)
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", c.SMTPFrom)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(c.SMTPTo, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/html; charset=utf-8\r\n\r\n")
+	msg.Write(body.Bytes())
+
+	var auth smtp.Auth
+	if c.SMTPUser != "" {
+		auth = smtp.PlainAuth("", c.SMTPUser, c.SMTPPassword, c.SMTPHost)
+	}
+	// SendMail сам переходит на STARTTLS, если сервер его поддерживает
+	addr := net.JoinHostPort(c.SMTPHost, strconv.Itoa(c.SMTPPort))
+	return smtp.SendMail(addr, auth, c.SMTPFrom, c.SMTPTo, msg.Bytes())
+}
@@ -0,0 +1,25 @@
+package main
+
+import "time"
+
+const (
+	eventCreated = "created"
+	eventUpdated = "updated"
+	eventDeleted = "deleted"
+)
+
+type reservationEvent struct {
+	Type        string      `json:"event"`
+	Reservation Reservation `json:"reservation"`
+	At          time.Time   `json:"at"`
+}
+
+// Внешние интеграции; каждая сама отвечает за очередь и не должна блокировать бота
+var eventSinks []func(reservationEvent)
+
+func publishReservationEvent(eventType string, r Reservation) {
+	event := reservationEvent{Type: eventType, Reservation: r, At: clock.Now()}
+	for _, sink := range eventSinks {
+		sink(event)
+	}
+}
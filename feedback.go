@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const maxFeedbackRating = 5
+
+// Просьба оценить визит уходит один раз, когда бронь завершается по времени;
+// неявки сюда не попадают — их статус не активный и они не завершаются
+func requestFeedback(bot Sender, r Reservation) {
+	if !cfg.AskFeedback || r.CreatedByStaff || isChatBlocked(r.ChatID) {
+		return
+	}
+
+	// По кнопке в ряд: столбик из звезд читается как шкала
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for rating := maxFeedbackRating; rating >= 1; rating-- {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(
+			strings.Repeat("⭐", rating), fmt.Sprintf("feedback_%d_%s", rating, r.ID))))
+	}
+	msg := tgbotapi.NewMessage(r.ChatID, tr(r.Lang, "feedback_ask", r.Date))
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
+	deliver(bot, r.ChatID, "запрос отзыва", msg)
+}
+
+// Визиты, завершившиеся в тихие часы; доступ под statesMu. Очередь живет только
+// в памяти: после перезапуска в тихие часы эти гости просьбу об оценке не получат
+var deferredFeedback = make(map[string]bool)
+
+func requestFeedbackOutsideQuietHours(bot Sender, r Reservation, now time.Time) {
+	if cfg.QuietHours.contains(now) {
+		deferredFeedback[r.ID] = true
+		return
+	}
+	requestFeedback(bot, r)
+}
+
+func hasDeferredFeedback(now time.Time) bool {
+	return len(deferredFeedback) > 0 && !cfg.QuietHours.contains(now)
+}
+
+// Отложенные просьбы уходят первым проходом очистки после конца тихих часов
+func flushDeferredFeedback(bot Sender, now time.Time) {
+	if !hasDeferredFeedback(now) {
+		return
+	}
+	for id := range deferredFeedback {
+		delete(deferredFeedback, id)
+		// Гость мог успеть оценить визит или бронь удалили из истории
+		if r, exists := reservations[id]; exists && r.Status == statusCompleted && r.Feedback == 0 {
+			requestFeedback(bot, r)
+		}
+	}
+}
+
+func processFeedback(bot Sender, chatID int64, messageID int, data string) {
+	value, reservationID, ok := strings.Cut(data, "_")
+	rating, err := strconv.Atoi(value)
+	if !ok || err != nil || rating < 1 || rating > maxFeedbackRating {
+		return
+	}
+	r, exists := reservations[reservationID]
+	if !exists || r.ChatID != chatID {
+		return
+	}
+	if r.Feedback != 0 {
+		sendPage(bot, chatID, messageID, t(chatID, "feedback_already"), nil)
+		return
+	}
+
+	r.Feedback = rating
+	if err := updateReservationsInFile(r); err != nil {
+		slog.Error("Оценка визита не сохранена", "chatID", chatID, "reservationID", r.ID, "err", err)
+		storageErrors.Inc()
+		sendPage(bot, chatID, messageID, t(chatID, "feedback_failed"), nil)
+		return
+	}
+	reservations[r.ID] = r
+	publishReservationEvent(eventUpdated, r)
+	slog.Info("Получена оценка визита", "chatID", chatID, "reservationID", r.ID, "rating", rating)
+
+	sendPage(bot, chatID, messageID, t(chatID, "feedback_thanks", strings.Repeat("⭐", rating)), nil)
+}
@@ -0,0 +1,495 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	langRU      = "ru"
+	langEN      = "en"
+	defaultLang = langRU
+)
+
+// Все тексты для гостей. Новый язык — новый раздел с теми же ключами;
+// недостающие ключи берутся из defaultLang
+var catalog = map[string]map[string]string{
+	langRU: {
+		"btn_book":            "Забронировать стол",
+		"btn_contact":         "Связаться с нами",
+		"btn_my_bookings":     "Моя бронь",
+		"btn_directions":      "Как добраться",
+		"btn_repeat":          "🔁 Повторить прошлую бронь",
+		"btn_menu":            "Меню",
+		"btn_seat_any":        "Без разницы",
+		"btn_yes":             "Да",
+		"btn_menu_back":       "Назад",
+		"btn_step_back":       "⬅ Назад",
+		"btn_resend_code":     "🔁 Отправить код еще раз",
+		"btn_skip":            "Пропустить",
+		"btn_cancel":          "❌ Отмена",
+		"btn_share_contact":   "📲 Поделиться контактом",
+		"btn_send_contact":    "📲 Отправить мой контакт",
+		"btn_phone_manual":    "⌨ Ввести вручную",
+		"btn_other_time":      "🕒 Другое время",
+		"btn_pick_date":       "📅 Выбрать другую дату",
+		"slot_seats_left":     "%s (%s)",
+		"seats_one":           "%d место",
+		"seats_few":           "%d места",
+		"seats_many":          "%d мест",
+		"dur_hours":           "%d ч",
+		"dur_minutes":         "%d мин",
+		"dur_hours_minutes":   "%d ч %d мин",
+		"btn_confirm":         "✅ Подтвердить",
+		"btn_edit":            "✏️ Изменить",
+		"btn_yes_delete":      "Да, удалить",
+		"btn_edit_this":       "✏️ Изменить эту бронь",
+		"btn_no":              "Нет",
+		"btn_change_name":     "Изменить имя",
+		"btn_change_phone":    "Изменить телефон",
+		"btn_change_guests":   "Изменить количество гостей",
+		"btn_change_date":     "Изменить дату",
+		"btn_change_time":     "Изменить время",
+		"btn_change_comment":  "Изменить комментарий",
+		"btn_confirm_changes": "✅ Подтвердить изменения",
+		"btn_ask_question":    "✉️ Задать вопрос",
+		"btn_reuse_data":      "Использовать прошлые данные (%s, %s)",
+
+		"cmd_start":      "Главное меню",
+		"cmd_help":       "Как пользоваться ботом",
+		"cmd_cancel":     "Отменить текущее действие",
+		"cmd_mybookings": "Мои бронирования",
+		"cmd_booking":    "Бронь по коду",
+		"cmd_language":   "Выбрать язык",
+
+		"choose_action":    "Выберите действие:",
+		"choose_language":  "Выберите язык:",
+		"language_set":     "Язык интерфейса: русский.",
+		"rate_limited":     "Слишком много запросов. Пожалуйста, подождите немного.",
+		"idle_cancelled":   "Бронирование отменено из-за неактивности",
+		"action_cancelled": "Действие отменено.",
+		"contact_phone":    "Наш телефон для связи: %s",
+		"ask_question":     "Напишите ваш вопрос одним сообщением, и мы перешлём его администратору:",
+		"question_sent":    "Спасибо! Вопрос передан администратору, ответ придёт сюда.",
+		"question_failed":  "Не удалось передать вопрос. Пожалуйста, позвоните нам: %s",
+		"staff_reply":      "💬 Ответ администратора:\n\n%s",
+		"phone_invalid":    "Не удалось распознать номер телефона. Пожалуйста, проверьте правильность написания.",
+		"code_sent":        "Мы отправили SMS с кодом на номер %s. Пожалуйста, введите код — он действует %d минут.",
+		"code_wait":        "Новый код можно запросить через %d с. Пожалуйста, введите код из последнего SMS.",
+		"code_limit":       "Слишком много запросов кода. Пожалуйста, попробуйте позже или позвоните нам: %s",
+		"code_failed":      "😔 Не удалось отправить SMS с кодом. Пожалуйста, попробуйте позже или позвоните нам: %s",
+		"code_expired":     "Срок действия кода истек. Нажмите «🔁 Отправить код еще раз», чтобы получить новый.",
+		"code_wrong":       "Неверный код. Осталось попыток: %d.",
+		"code_too_many":    "Код введен неверно слишком много раз. Пожалуйста, укажите номер телефона заново.",
+		"name_too_short":   "Имя должно содержать хотя бы 2 символа. Пожалуйста, введите ваше имя:",
+		"name_too_long":    "Имя не должно быть длиннее %d символов. Пожалуйста, введите ваше имя:",
+		"comment_too_long": "Комментарий не должен быть длиннее %d символов. Пожалуйста, сократите его:",
+		"name_invalid":     "Похоже, это не имя. Имя должно содержать буквы и не может быть ссылкой. Пожалуйста, введите ваше имя:",
+		"edit_error":       "Ошибка редактирования. Пожалуйста, начните заново.",
+		"booking_error":    "Ошибка бронирования. Пожалуйста, начните заново.",
+		"date_format":      "Пожалуйста, введите дату в формате ДД.ММ.ГГГГ.",
+		"date_closed":      "Мы закрыты в этот день. Пожалуйста, выберите другую дату.",
+		"refill":           "Давайте заполним данные заново.",
+		"menu_unavailable": "Меню сейчас недоступно. Уточните, пожалуйста, по телефону: %s",
+
+		"ask_name":         "Пожалуйста, введите ваше имя:",
+		"reuse_offer":      "Или возьмите данные из прошлой брони:",
+		"repeat_prefill":   "Как в прошлый раз: %s, %s, гостей: %d. Выберите дату — перед подтверждением все данные можно будет изменить.",
+		"ask_guests":       "Спасибо! Теперь укажите количество гостей:",
+		"ask_phone_method": "Как вы хотите предоставить номер телефона?",
+		"ask_phone_manual": "Пожалуйста, введите ваш номер телефона, например +7 999 123-45-67:",
+		"ask_contact":      "Нажмите кнопку ниже, чтобы поделиться контактом:",
+		"ask_date":         "Выберите дату бронирования:",
+		"ask_time":         "Выберите время бронирования:",
+		"ask_manual_time":  "Введите желаемое время в формате ЧЧ:ММ:",
+		"button_outdated":  "Эта кнопка уже не действует. Выберите действие в меню.",
+		"ask_comment":      "Укажите ваши пожелания или комментарий к брони:",
+		"ask_seating":      "Где вам удобнее сидеть?",
+		"ask_child_seat":   "Нужен детский стул?",
+		"ask_venue":        "Выберите заведение:",
+		"ask_occasion":     "Есть ли особый повод?",
+		"ask_own_occasion": "Напишите, какой у вас повод:",
+
+		"time_format":      "Пожалуйста, введите время в формате ЧЧ:ММ.",
+		"time_hours":       "Бронирование доступно с %02d:%02d до %02d:%02d.",
+		"time_grid":        "Бронировать можно с шагом %d минут. Ближайшее доступное время: %s.",
+		"time_snapped":     "Время %s округлено до %s по сетке бронирования.",
+		"time_bad_date":    "Ошибка даты бронирования. Пожалуйста, начните заново.",
+		"time_min_lead":    "Бронировать нужно минимум за %s. Пожалуйста, выберите более позднее время.",
+		"guests_invalid":   "Пожалуйста, введите корректное количество гостей (число больше 0).",
+		"guests_too_few":   "Минимальное количество гостей для брони — %d. Пожалуйста, введите другое число:",
+		"guests_too_many":  "Мы принимаем онлайн-бронь не более чем на %d гостей. Для большой компании позвоните менеджеру: %s",
+		"no_slots_today":   "На сегодня слотов больше нет, выберите другую дату.",
+		"no_slots_date":    "На %s свободных слотов нет, выберите другую дату.",
+		"slot_full":        "На %s %s свободных мест уже нет. Пожалуйста, выберите другое время.",
+		"duplicate":        "У вас уже есть бронь #%s на %s в %s. Выберите другое время или посмотрите существующую бронь.",
+		"no_bookings":      "У вас нет активных бронирований.",
+		"booking_usage":    "Укажите код брони: /booking A1B2C3",
+		"booking_missing":  "Бронь %s не найдена.",
+		"bookings_header":  "Ваши бронирования (%d)",
+		"page_of":          ", страница %d из %d",
+		"booking_item":     "\nБронь #%s\nИмя: %s\nТелефон: %s\nГостей: %d\nВремя: %s\n",
+		"comment_line":     "\nКомментарий: %s",
+		"seating_line":     "\nМесто: %s",
+		"occasion_line":    "\nПовод: %s",
+		"child_seat_line":  "\nНужен детский стул",
+		"venue_line":       "\nЗаведение: %s",
+		"review":           "Проверьте данные брони:\n\nИмя: %s\nТелефон: %s\nГостей: %d\nДата: %s\nВремя: %s",
+		"confirmed":        "✅ Бронь #%s успешна!\n\nДетали:\nИмя: %s\nТелефон: %s\nГостей: %d\nДата: %s\nВремя: %s",
+		"pending":          "🕓 Бронь #%s принята и ждет подтверждения администратора — мы пришлем сообщение, как только ее подтвердят.\n\nДетали:\nИмя: %s\nТелефон: %s\nГостей: %d\nДата: %s\nВремя: %s",
+		"declined_refund":  "\nПредоплату %s мы вернем — деньги придут тем же способом, которым вы платили.",
+		"declined":         "😔 К сожалению, мы не можем подтвердить бронь #%s на %s в %s. Пожалуйста, позвоните нам, чтобы подобрать другое время: %s",
+		"deleted":          "Бронь #%s успешно удалена",
+		"feedback_ask":     "Как всё прошло? Оцените, пожалуйста, ваш визит %s:",
+		"feedback_thanks":  "Спасибо за оценку %s!",
+		"feedback_already": "Вы уже оценили этот визит, спасибо!",
+		"feedback_failed":  "😔 Не удалось сохранить оценку. Пожалуйста, попробуйте позже.",
+		"table_line":       "\nВаш стол №%s",
+		"deposit_invoice":  "💳 Для брони #%s нужна предоплата %s. Оплатите счет ниже — бронь подтвердится после оплаты, а до тех пор будет ждать.",
+		"deposit_title":    "Предоплата за бронь #%s",
+		"deposit_desc":     "«%s», %s в %s, гостей: %d",
+		"deposit_label":    "Предоплата",
+		"deposit_no_bill":  "😔 Не удалось выставить счет. Бронь пока не подтверждена — пожалуйста, позвоните нам: %s",
+		"deposit_refused":  "Эту бронь уже нельзя оплатить: она оплачена, изменена или отменена.",
+		"deposit_paid":     "✅ Предоплата %s получена, спасибо!",
+		"deposit_failed":   "😔 Оплата прошла, но мы не смогли записать ее в бронь. Мы уже разбираемся; если хотите, позвоните нам: %s",
+		"deposit_expired":  "⌛ Бронь #%s отменена: предоплата не поступила вовремя. Вы можете забронировать стол заново или позвонить нам: %s",
+		"reminder":         "⏰ Напоминаем о брони #%s в «%s» на %s в %s, гостей: %d. Если планы изменились, отмените бронь в разделе «Моя бронь».",
+		"save_failed":      "😔 Не удалось сохранить бронь из-за технической ошибки, поэтому она не создана. Пожалуйста, попробуйте позже или позвоните нам: %s",
+		"edit_failed":      "😔 Не удалось сохранить изменения из-за технической ошибки, бронь осталась прежней. Пожалуйста, попробуйте позже или позвоните нам: %s",
+		"edit_inactive":    "Бронь #%s уже отменена или завершена, изменения не сохранены.",
+		"cancel_failed":    "😔 Не удалось отменить бронь из-за технической ошибки, она по-прежнему действует. Пожалуйста, попробуйте позже или позвоните нам: %s",
+		"user_blocked":     "К сожалению, бронирование через бота для вас недоступно. Пожалуйста, свяжитесь с нами по телефону %s.",
+		"cancel_too_late":  "До визита осталось меньше %d ч, отменить бронь через бота уже нельзя. Пожалуйста, позвоните нам: %s",
+		"edited_by_staff":  "ℹ️ Администратор изменил вашу бронь #%s.\n\nИмя: %s\nТелефон: %s\nГостей: %d\nДата: %s\nВремя: %s",
+		"delete_confirm":   "Вы уверены, что хотите удалить бронь #%s?\n\nИмя: %s\nТелефон: %s\nГостей: %d\nДата: %s\nВремя: %s",
+		"edit_options":     "Редактирование брони #%s:\n\nИмя: %s\nТелефон: %s\nГостей: %d\nДата: %s\nВремя: %s\nКомментарий: %s\n\nЧто хотите изменить?",
+		"current_name":     "Текущее имя: %s. Введите новое имя:",
+		"current_phone":    "Текущий телефон: %s. Введите новый телефон:",
+		"current_guests":   "Текущее количество гостей: %d. Введите новое количество:",
+		"current_comment":  "Текущий комментарий: %s. Введите новый комментарий:",
+		"changes_saved":    "✅ Изменения сохранены!",
+		"ical_caption":     "Добавьте бронь в календарь 📅",
+		"ical_summary":     "Бронь стола: %s (%d гост.)",
+		"ical_description": "Бронь #%s\nГостей: %d\nТелефон для связи: %s",
+		"sms_confirmed":    "%s: бронь #%s подтверждена, %s в %s, гостей: %d. Телефон: %s",
+		"sms_phone_code":   "Код подтверждения: %s. %s",
+		"edit_ignored":     "Исправленные сообщения не учитываются. Пожалуйста, отправьте новое сообщение.",
+		"private_only":     "Я работаю только в личных сообщениях. Напишите мне напрямую, чтобы забронировать столик.",
+
+		"help": `Как забронировать стол:
+
+1. Нажмите «Забронировать стол».
+2. Введите имя и номер телефона (можно поделиться контактом).
+3. Укажите количество гостей и, по желанию, комментарий.
+4. Выберите дату и время.
+
+Бронировать нужно минимум за %s до визита.
+
+Чтобы посмотреть, изменить или удалить бронь, нажмите «Моя бронь».
+Отменить текущее действие можно командой /cancel, сменить язык — /language.
+
+Телефон для связи: %s`,
+
+		"occasion_birthday":    "День рождения",
+		"occasion_anniversary": "Годовщина",
+		"occasion_business":    "Деловая встреча",
+		"occasion_other":       "Другое",
+
+		"weekday_0": "воскресенье",
+		"weekday_1": "понедельник",
+		"weekday_2": "вторник",
+		"weekday_3": "среда",
+		"weekday_4": "четверг",
+		"weekday_5": "пятница",
+		"weekday_6": "суббота",
+	},
+	langEN: {
+		"btn_book":            "Book a table",
+		"btn_contact":         "Contact us",
+		"btn_my_bookings":     "My bookings",
+		"btn_directions":      "How to get here",
+		"btn_repeat":          "🔁 Repeat last booking",
+		"btn_menu":            "Menu",
+		"btn_seat_any":        "No preference",
+		"btn_yes":             "Yes",
+		"btn_menu_back":       "Back",
+		"btn_step_back":       "⬅ Back",
+		"btn_resend_code":     "🔁 Send the code again",
+		"btn_skip":            "Skip",
+		"btn_cancel":          "❌ Cancel",
+		"btn_share_contact":   "📲 Share contact",
+		"btn_send_contact":    "📲 Send my contact",
+		"btn_phone_manual":    "⌨ Type it in",
+		"btn_other_time":      "🕒 Other time",
+		"btn_pick_date":       "📅 Choose another date",
+		"slot_seats_left":     "%s (%s)",
+		"seats_one":           "%d seat",
+		"seats_few":           "%d seats",
+		"seats_many":          "%d seats",
+		"dur_hours":           "%d h",
+		"dur_minutes":         "%d min",
+		"dur_hours_minutes":   "%d h %d min",
+		"btn_confirm":         "✅ Confirm",
+		"btn_edit":            "✏️ Change",
+		"btn_yes_delete":      "Yes, delete",
+		"btn_edit_this":       "✏️ Change this booking",
+		"btn_no":              "No",
+		"btn_change_name":     "Change name",
+		"btn_change_phone":    "Change phone",
+		"btn_change_guests":   "Change number of guests",
+		"btn_change_date":     "Change date",
+		"btn_change_time":     "Change time",
+		"btn_change_comment":  "Change comment",
+		"btn_confirm_changes": "✅ Save changes",
+		"btn_ask_question":    "✉️ Ask a question",
+		"btn_reuse_data":      "Use my previous details (%s, %s)",
+
+		"cmd_start":      "Main menu",
+		"cmd_help":       "How to use the bot",
+		"cmd_cancel":     "Cancel the current action",
+		"cmd_mybookings": "My bookings",
+		"cmd_booking":    "Booking by code",
+		"cmd_language":   "Choose language",
+
+		"choose_action":    "Choose an action:",
+		"choose_language":  "Choose a language:",
+		"language_set":     "Interface language: English.",
+		"rate_limited":     "Too many requests. Please wait a moment.",
+		"idle_cancelled":   "Booking cancelled due to inactivity",
+		"action_cancelled": "Action cancelled.",
+		"contact_phone":    "Our phone number: %s",
+		"ask_question":     "Type your question in one message and we will pass it to the staff:",
+		"question_sent":    "Thank you! Your question has been passed to the staff, the reply will arrive here.",
+		"question_failed":  "Could not pass your question on. Please call us: %s",
+		"staff_reply":      "💬 Reply from the staff:\n\n%s",
+		"phone_invalid":    "We couldn't recognise this phone number. Please check it and try again.",
+		"code_sent":        "We've sent a text with a code to %s. Please enter the code — it is valid for %d minutes.",
+		"code_wait":        "You can request a new code in %d s. Please enter the code from the latest text.",
+		"code_limit":       "Too many code requests. Please try again later or call us: %s",
+		"code_failed":      "😔 We couldn't send the text with the code. Please try again later or call us: %s",
+		"code_expired":     "The code has expired. Tap «🔁 Send the code again» to get a new one.",
+		"code_wrong":       "Wrong code. Attempts left: %d.",
+		"code_too_many":    "The code was entered incorrectly too many times. Please enter your phone number again.",
+		"name_too_short":   "The name must be at least 2 characters long. Please enter your name:",
+		"name_too_long":    "The name must be at most %d characters long. Please enter your name:",
+		"comment_too_long": "The comment must be at most %d characters long. Please shorten it:",
+		"name_invalid":     "That doesn't look like a name. It must contain letters and can't be a link. Please enter your name:",
+		"edit_error":       "Editing failed. Please start over.",
+		"booking_error":    "Booking failed. Please start over.",
+		"date_format":      "Please enter the date as DD.MM.YYYY.",
+		"date_closed":      "We are closed on this day. Please choose another date.",
+		"refill":           "Let's fill in the details again.",
+		"menu_unavailable": "The menu is not available right now. Please call us: %s",
+
+		"ask_name":         "Please enter your name:",
+		"reuse_offer":      "Or use the details from your last booking:",
+		"repeat_prefill":   "Same as last time: %s, %s, guests: %d. Choose a date — you can change any details before confirming.",
+		"ask_guests":       "Thank you! Now enter the number of guests:",
+		"ask_phone_method": "How would you like to provide your phone number?",
+		"ask_phone_manual": "Please enter your phone number, e.g. +7 999 123-45-67:",
+		"ask_contact":      "Tap the button below to share your contact:",
+		"ask_date":         "Choose the booking date:",
+		"ask_time":         "Choose the booking time:",
+		"ask_manual_time":  "Enter the time you'd like as HH:MM:",
+		"button_outdated":  "This button is no longer valid. Please choose an action from the menu.",
+		"ask_comment":      "Add any requests or a comment for the booking:",
+		"ask_seating":      "Where would you like to sit?",
+		"ask_child_seat":   "Do you need a high chair?",
+		"ask_venue":        "Choose a location:",
+		"ask_occasion":     "Is there a special occasion?",
+		"ask_own_occasion": "Tell us about the occasion:",
+
+		"time_format":      "Please enter the time as HH:MM.",
+		"time_hours":       "Bookings are available from %02d:%02d to %02d:%02d.",
+		"time_grid":        "Bookings are made in %d-minute steps. The nearest available times: %s.",
+		"time_snapped":     "The time %s was rounded to %s to match the booking grid.",
+		"time_bad_date":    "The booking date is invalid. Please start over.",
+		"time_min_lead":    "Bookings must be made at least %s in advance. Please choose a later time.",
+		"guests_invalid":   "Please enter a valid number of guests (greater than 0).",
+		"guests_too_few":   "The minimum party size for a booking is %d. Please enter another number:",
+		"guests_too_many":  "Online bookings are limited to %d guests. For a larger party please call the manager: %s",
+		"no_slots_today":   "There are no slots left for today, please choose another date.",
+		"no_slots_date":    "There are no free slots on %s, please choose another date.",
+		"slot_full":        "There are no free places left on %s at %s. Please choose another time.",
+		"duplicate":        "You already have booking #%s on %s at %s. Choose another time or view the existing booking.",
+		"no_bookings":      "You have no active bookings.",
+		"booking_usage":    "Add the booking code: /booking A1B2C3",
+		"booking_missing":  "Booking %s not found.",
+		"bookings_header":  "Your bookings (%d)",
+		"page_of":          ", page %d of %d",
+		"booking_item":     "\nBooking #%s\nName: %s\nPhone: %s\nGuests: %d\nTime: %s\n",
+		"comment_line":     "\nComment: %s",
+		"seating_line":     "\nSeating: %s",
+		"occasion_line":    "\nOccasion: %s",
+		"child_seat_line":  "\nHigh chair needed",
+		"venue_line":       "\nLocation: %s",
+		"review":           "Please check your booking:\n\nName: %s\nPhone: %s\nGuests: %d\nDate: %s\nTime: %s",
+		"confirmed":        "✅ Booking #%s confirmed!\n\nDetails:\nName: %s\nPhone: %s\nGuests: %d\nDate: %s\nTime: %s",
+		"pending":          "🕓 Booking #%s received and is waiting for the staff to confirm it — we'll message you as soon as it is confirmed.\n\nDetails:\nName: %s\nPhone: %s\nGuests: %d\nDate: %s\nTime: %s",
+		"declined_refund":  "\nWe will refund your %s deposit to the payment method you used.",
+		"declined":         "😔 Unfortunately we can't confirm booking #%s on %s at %s. Please call us to find another time: %s",
+		"deleted":          "Booking #%s has been deleted",
+		"feedback_ask":     "How did it go? Please rate your visit on %s:",
+		"feedback_thanks":  "Thank you for your rating %s!",
+		"feedback_already": "You have already rated this visit, thank you!",
+		"feedback_failed":  "😔 We couldn't save your rating. Please try again later.",
+		"table_line":       "\nYour table: #%s",
+		"deposit_invoice":  "💳 Booking #%s requires a deposit of %s. Pay the invoice below — the booking is confirmed once paid and stays on hold until then.",
+		"deposit_title":    "Deposit for booking #%s",
+		"deposit_desc":     "%s, %s at %s, guests: %d",
+		"deposit_label":    "Deposit",
+		"deposit_no_bill":  "😔 We couldn't issue the invoice. Your booking is not confirmed yet — please call us: %s",
+		"deposit_refused":  "This booking can no longer be paid: it is already paid, changed or cancelled.",
+		"deposit_paid":     "✅ Deposit of %s received, thank you!",
+		"deposit_failed":   "😔 Your payment went through, but we couldn't attach it to the booking. We're on it; you can also call us: %s",
+		"deposit_expired":  "⌛ Booking #%s was cancelled because the deposit was not paid in time. You can book again or call us: %s",
+		"reminder":         "⏰ A reminder about booking #%s at %s on %s at %s, guests: %d. If your plans have changed, cancel it under \"My bookings\".",
+		"save_failed":      "😔 We couldn't save your booking due to a technical error, so it was not created. Please try again later or call us: %s",
+		"edit_failed":      "😔 We couldn't save your changes due to a technical error, so the booking is unchanged. Please try again later or call us: %s",
+		"edit_inactive":    "Booking #%s has already been cancelled or completed, so your changes were not saved.",
+		"cancel_failed":    "😔 We couldn't cancel your booking due to a technical error, so it is still active. Please try again later or call us: %s",
+		"user_blocked":     "Unfortunately, booking through this bot is not available to you. Please contact us by phone: %s.",
+		"cancel_too_late":  "Your visit is less than %d h away, so the booking can no longer be cancelled here. Please call us: %s",
+		"edited_by_staff":  "ℹ️ The staff updated your booking #%s.\n\nName: %s\nPhone: %s\nGuests: %d\nDate: %s\nTime: %s",
+		"delete_confirm":   "Are you sure you want to delete booking #%s?\n\nName: %s\nPhone: %s\nGuests: %d\nDate: %s\nTime: %s",
+		"edit_options":     "Editing booking #%s:\n\nName: %s\nPhone: %s\nGuests: %d\nDate: %s\nTime: %s\nComment: %s\n\nWhat would you like to change?",
+		"current_name":     "Current name: %s. Enter a new name:",
+		"current_phone":    "Current phone: %s. Enter a new phone:",
+		"current_guests":   "Current number of guests: %d. Enter a new number:",
+		"current_comment":  "Current comment: %s. Enter a new comment:",
+		"changes_saved":    "✅ Changes saved!",
+		"ical_caption":     "Add the booking to your calendar 📅",
+		"ical_summary":     "Table booking: %s (%d guests)",
+		"ical_description": "Booking #%s\nGuests: %d\nContact phone: %s",
+		"sms_confirmed":    "%s: booking #%s confirmed, %s at %s, guests: %d. Phone: %s",
+		"sms_phone_code":   "Verification code: %s. %s",
+		"edit_ignored":     "Edited messages are not processed. Please send a new message.",
+		"private_only":     "I only work in direct messages. Write to me privately to book a table.",
+
+		"help": `How to book a table:
+
+1. Tap "Book a table".
+2. Enter your name and phone number (you can share your contact).
+3. Enter the number of guests and, optionally, a comment.
+4. Choose the date and time.
+
+Bookings must be made at least %s before the visit.
+
+To view, change or delete a booking, tap "My bookings".
+Use /cancel to cancel the current action and /language to switch language.
+
+Contact phone: %s`,
+
+		"occasion_birthday":    "Birthday",
+		"occasion_anniversary": "Anniversary",
+		"occasion_business":    "Business meeting",
+		"occasion_other":       "Other",
+
+		"weekday_0": "Sunday",
+		"weekday_1": "Monday",
+		"weekday_2": "Tuesday",
+		"weekday_3": "Wednesday",
+		"weekday_4": "Thursday",
+		"weekday_5": "Friday",
+		"weekday_6": "Saturday",
+	},
+}
+
+// Порядок языков в меню выбора
+var languages = []struct{ Code, Title string }{
+	{langRU, "Русский"},
+	{langEN, "English"},
+}
+
+func tr(lang, key string, args ...interface{}) string {
+	text, ok := catalog[lang][key]
+	if !ok {
+		text = catalog[defaultLang][key]
+	}
+	if len(args) > 0 {
+		return fmt.Sprintf(text, args...)
+	}
+	return text
+}
+
+// Число мест с правильным окончанием: 1 место, 3 места, 5 мест
+func seatsLabel(lang string, n int) string {
+	key := "seats_many"
+	switch {
+	case lang != langRU:
+		if n == 1 {
+			key = "seats_one"
+		}
+	case n%10 == 1 && n%100 != 11:
+		key = "seats_one"
+	case n%10 >= 2 && n%10 <= 4 && (n%100 < 12 || n%100 > 14):
+		key = "seats_few"
+	}
+	return tr(lang, key, n)
+}
+
+// Срок вида «1 ч 30 мин» с точностью до минуты
+func durationTitle(lang string, d time.Duration) string {
+	hours, minutes := int(d/time.Hour), int(d%time.Hour/time.Minute)
+	switch {
+	case minutes == 0:
+		return tr(lang, "dur_hours", hours)
+	case hours == 0:
+		return tr(lang, "dur_minutes", minutes)
+	}
+	return tr(lang, "dur_hours_minutes", hours, minutes)
+}
+
+func t(chatID int64, key string, args ...interface{}) string {
+	return tr(userLang(chatID), key, args...)
+}
+
+func userLang(chatID int64) string {
+	if lang := userStates[chatID].Lang; lang != "" {
+		return lang
+	}
+	return defaultLang
+}
+
+// Язык по настройкам клиента Telegram, если пользователь его еще не выбирал
+func detectLang(languageCode string) string {
+	code := strings.ToLower(languageCode)
+	for _, l := range languages {
+		if strings.HasPrefix(code, l.Code) {
+			return l.Code
+		}
+	}
+	return defaultLang
+}
+
+func rememberLang(chatID int64, languageCode string) {
+	state := userStates[chatID]
+	if state.Lang != "" {
+		return
+	}
+	// Состояние могло устареть, а выбранный язык хранится в профиле
+	if profile, ok := getProfile(chatID); ok && profile.Lang != "" {
+		state.Lang = profile.Lang
+	} else {
+		state.Lang = detectLang(languageCode)
+	}
+	userStates[chatID] = state
+}
+
+// Ключ кнопки по ее тексту на любом из языков
+func buttonKey(text string) string {
+	for _, texts := range catalog {
+		for key, value := range texts {
+			if strings.HasPrefix(key, "btn_") && value == text {
+				return key
+			}
+		}
+	}
+	return ""
+}
+
+func weekdayTitle(lang string, day time.Weekday) string {
+	return tr(lang, fmt.Sprintf("weekday_%d", int(day)))
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const icalTimeFormat = "20060102T150405Z"
+
+var icalEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`)
+
+// Время события пишется в UTC, поэтому календарь гостя покажет его
+// корректно в любом часовом поясе устройства
+func buildReservationICS(r Reservation, now time.Time) ([]byte, error) {
+	start, err := reservationDateTime(r)
+	if err != nil {
+		return nil, err
+	}
+	end := start.Add(cfg.EventDuration)
+
+	venue := venueByID(r.VenueID)
+	description := tr(r.Lang, "ical_description", r.Code, r.Guests, cfg.ManagerPhone)
+	if r.Comment != "" && r.Comment != "-" {
+		description += tr(r.Lang, "comment_line", r.Comment)
+	}
+
+	lines := []string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:-//BOT_FROM_SIMACH//Reservations//RU",
+		"CALSCALE:GREGORIAN",
+		"METHOD:PUBLISH",
+		"BEGIN:VEVENT",
+		"UID:" + r.ID + "@reservations",
+		"DTSTAMP:" + now.UTC().Format(icalTimeFormat),
+		"DTSTART:" + start.UTC().Format(icalTimeFormat),
+		"DTEND:" + end.UTC().Format(icalTimeFormat),
+		"SUMMARY:" + icalEscaper.Replace(tr(r.Lang, "ical_summary", venue.Name, r.Guests)),
+		"LOCATION:" + icalEscaper.Replace(venue.Name),
+		"DESCRIPTION:" + icalEscaper.Replace(description),
+		"END:VEVENT",
+		"END:VCALENDAR",
+	}
+	return []byte(strings.Join(lines, "\r\n") + "\r\n"), nil
+}
+
+func sendReservationICS(bot Sender, chatID int64, r Reservation) {
+	data, err := buildReservationICS(r, clock.Now())
+	if err != nil {
+		return
+	}
+
+	doc := tgbotapi.NewDocument(chatID, tgbotapi.FileBytes{Name: "reservation.ics", Bytes: data})
+	doc.Caption = tr(r.Lang, "ical_caption")
+	deliver(bot, chatID, "календарный файл", doc)
+}
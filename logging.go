@@ -0,0 +1,24 @@
+package main
+
+import (
+	"io"
+	"log/slog"
+	"os"
+
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+func setupLogging(c Config) {
+	var out io.Writer = os.Stdout
+	if c.LogFile != "" {
+		out = &lumberjack.Logger{
+			Filename:   c.LogFile,
+			MaxSize:    c.LogMaxSizeMB,
+			MaxBackups: c.LogMaxBackups,
+			Compress:   true,
+		}
+	}
+
+	handler := slog.NewTextHandler(out, &slog.HandlerOptions{Level: c.LogLevel})
+	slog.SetDefault(slog.New(handler))
+}
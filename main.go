@@ -1,26 +1,41 @@
 package main
 
 import (
+	"crypto/rand"
 	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"hash/fnv"
 	"log"
+	"log/slog"
 	"os"
+	"path/filepath"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
+	_ "time/tzdata"
+	"unicode"
+	"unicode/utf8"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"github.com/joho/godotenv"
+	"github.com/nyaruka/phonenumbers"
 )
 
 const (
-	managerPhone     = "ТУТ НОМЕР БУДЕТ ХОСТЕС"
-	adminChatID      = 5069516411
-	reservationsFile = "reservations.csv"
-	timeZone         = "Europe/Moscow"
-	minBookingHours  = 2
-	reservationTTL   = 15 * time.Minute
+	bookingDays       = 10
+	idleSweepInterval = time.Minute
+	maxNameLength     = 64
+	purgeInterval     = 24 * time.Hour
+
+	openingMinutes     = 16 * 60
+	lastBookingMinutes = 23*60 + 30
+	slotMinutes        = 30
 )
 
 const (
@@ -39,6 +54,15 @@ const (
 	stateEditingReservationDate
 	stateEditingReservationTime
 	stateEditingReservationComment
+	stateConfirmingReservation
+	stateWaitingForManualTime
+	stateWaitingForSeating
+	stateWaitingForOccasion
+	stateWaitingForOccasionText
+	stateWaitingForSupport
+	stateWaitingForChildSeat
+	stateWaitingForVenue
+	stateWaitingForPhoneCode
 )
 
 type Reservation struct {
@@ -50,8 +74,50 @@ type Reservation struct {
 	Date      string
 	Time      string
 	Comment   string
-	Confirmed bool
+	Status    ReservationStatus
 	CreatedAt time.Time
+	Username  string
+
+	StatusChangedAt   time.Time
+	Code              string
+	Lang              string
+	SeatingPreference string
+	Occasion          string
+	Source            string
+	CreatedByStaff    bool // бронь внёс администратор; ChatID — его чат, а не гостя
+	NeedsChildSeat    bool
+	VenueID           string
+	ReminderSent      bool
+	Feedback          int // оценка гостя 1–5; 0 — оценки нет
+	Table             string
+	DepositAmount     int // в копейках; 0 — предоплата не требуется
+	DepositPaid       bool
+	PaymentChargeID   string
+}
+
+type ReservationStatus string
+
+const (
+	statusPending   ReservationStatus = "pending"
+	statusConfirmed ReservationStatus = "confirmed"
+	statusSeated    ReservationStatus = "seated"
+	statusCompleted ReservationStatus = "completed"
+	statusNoShow    ReservationStatus = "noshow"
+	statusCancelled ReservationStatus = "cancelled"
+)
+
+var statusTitles = map[ReservationStatus]string{
+	statusPending:   "ожидает подтверждения",
+	statusConfirmed: "подтверждена",
+	statusSeated:    "гости пришли",
+	statusCompleted: "завершена",
+	statusNoShow:    "гости не пришли",
+	statusCancelled: "отменена",
+}
+
+// Активными для гостя считаются брони, визит по которым еще не закрыт
+func (s ReservationStatus) isActive() bool {
+	return s == statusPending || s == statusConfirmed || s == statusSeated
 }
 
 type UserState struct {
@@ -62,36 +128,139 @@ type UserState struct {
 	Guests          int
 	Date            string
 	Comment         string
+	Seating         string
+	Occasion        string
 	TempReservation *Reservation
+	LastActivity    time.Time
+	Username        string
+	Lang            string
+	Source          string // метка из deep-link /start, например QR-код стола
+	StaffBooking    bool   // администратор оформляет бронь за гостя через /new
+	ChildSeat       bool
+	VenueID         string
+
+	// Номер ждет подтверждения кодом из SMS (VERIFY_PHONE), см. phoneverify.go
+	PendingPhone     string
+	PhoneCode        string
+	PhoneCodeExpires time.Time
+	PhoneCodeTries   int
+	PhoneCodeForEdit bool
 }
 
 var (
+	// Настройки для обработчиков диалога; службам main передает Config явно
+	cfg          Config
 	userStates   = make(map[int64]UserState)
 	reservations = make(map[string]Reservation)
-	phoneRegex   = regexp.MustCompile(`^[\d]{11}$`)
-	loc, _       = time.LoadLocation(timeZone)
+	nonDigits    = regexp.MustCompile(`\D`)
+	startPayload = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+	loc          *time.Location
+	statesMu     sync.RWMutex
+
+	occasionKeys = []string{"birthday", "anniversary", "business"}
+
+	// file_id загруженного меню, чтобы не отправлять файл заново
+	menuFileID string
+
+	// ID самого бота, чтобы узнавать ответы на его сообщения
+	botID int64
+
+	// Короткий код брони -> внутренний ID
+	reservationCodes = make(map[string]string)
+
+	reservationHeaders = []string{
+		"ID",
+		"ChatID",
+		"Name",
+		"Phone",
+		"Guests",
+		"Date",
+		"Time",
+		"Comment",
+		"Confirmed",
+		"CreatedAt",
+		"Username",
+		"Status",
+		"StatusChangedAt",
+		"Code",
+		"Lang",
+		"SeatingPreference",
+		"Occasion",
+		"Source",
+		"CreatedByStaff",
+		"NeedsChildSeat",
+		"VenueID",
+		"ReminderSent",
+		"Feedback",
+		"Table",
+		"DepositAmount",
+		"DepositPaid",
+		"PaymentChargeID",
+	}
+
+	userCommands = []tgbotapi.BotCommand{
+		{Command: "start", Description: "cmd_start"},
+		{Command: "help", Description: "cmd_help"},
+		{Command: "cancel", Description: "cmd_cancel"},
+		{Command: "mybookings", Description: "cmd_mybookings"},
+		{Command: "booking", Description: "cmd_booking"},
+		{Command: "language", Description: "cmd_language"},
+	}
+	adminCommands = []tgbotapi.BotCommand{
+		{Command: "today", Description: "Брони на сегодня"},
+		{Command: "tomorrow", Description: "Брони на завтра"},
+		{Command: "date", Description: "Брони на дату (ДД.ММ.ГГГГ)"},
+		{Command: "find", Description: "Найти брони по телефону"},
+		{Command: "noshows", Description: "Неявки за период"},
+		{Command: "export", Description: "Выгрузить брони в CSV"},
+		{Command: "stats", Description: "Статистика бронирований"},
+		{Command: "broadcast", Description: "Рассылка всем гостям"},
+		{Command: "edit", Description: "Изменить бронь по коду"},
+		{Command: "table", Description: "Назначить стол брони"},
+		{Command: "new", Description: "Внести бронь за гостя"},
+		{Command: "block", Description: "Заблокировать гостя (chat ID или +телефон)"},
+		{Command: "unblock", Description: "Снять блокировку"},
+	}
 )
 
 func main() {
 	if err := godotenv.Load(); err != nil {
-		log.Print("Файл .env не найден")
+		slog.Info("Файл .env не найден")
 	}
 
-	botToken := os.Getenv("TELEGRAM_BOT_TOKEN")
-	if botToken == "" {
-		log.Panic("Токен бота не установлен")
+	c, err := loadConfig()
+	if err != nil {
+		log.Panic("Ошибка конфигурации: ", err)
 	}
+	setupLogging(c)
+	loc = loadLocation(c.TimeZone)
+	// До cfg = c и до запуска горутин: обработчики читают cfg без блокировки
+	c.VerifyPhone = startPhoneVerification(c)
+	cfg = c
 
-	bot, err := tgbotapi.NewBotAPI(botToken)
+	bot, err := tgbotapi.NewBotAPI(c.BotToken)
 	if err != nil {
 		log.Panic("Ошибка создания бота:", err)
 	}
 
-	bot.Debug = true
-	log.Printf("Авторизован как %s", bot.Self.UserName)
+	bot.Debug = c.BotDebug
+	botID = bot.Self.ID
+	slog.Info("Авторизован", "username", bot.Self.UserName)
 
-	initReservationsFile()
-	loadReservationsFromFile()
+	registerBotCommands(bot)
+
+	// В режиме DRY_RUN брони, состояния и профили живут только в памяти процесса:
+	// файлы не читаются и не пишутся, уведомления администраторам и выгрузки во
+	// внешние системы не отправляются, а весь диалог с гостем работает как обычно
+	if cfg.DryRun {
+		slog.Warn("Включен режим DRY_RUN: данные не сохраняются, администраторы не уведомляются")
+	} else {
+		initReservationsFile()
+		loadReservationsFromFile()
+		loadUserStatesFromFile()
+		profiles = loadProfileStore(cfg.ProfilesFile)
+		loadBlocklist()
+	}
 
 	_, _ = bot.Request(tgbotapi.DeleteWebhookConfig{})
 
@@ -99,70 +268,369 @@ func main() {
 	u.Timeout = 60
 	updates := bot.GetUpdatesChan(u)
 
+	go runSendRetries(bot)
 	go cleanupExpiredReservations(bot)
+	go sweepIdleUserStates(bot)
+	go runDailySummary(bot)
+	go runReminders(bot)
+	startMetricsServer(c)
+	if !c.DryRun {
+		startSheetsSync(c)
+		startReservationWebhook(c)
+		startEmailNotifications(c)
+		startSMSConfirmations(c)
+	}
 
 	for update := range updates {
+		started := time.Now()
+		statesMu.Lock()
+		// EditedChannelPost и прочие типы обновлений боту не нужны и просто пропускаются
 		if update.Message != nil {
-			handleMessage(bot, update.Message)
-		} else if update.CallbackQuery != nil {
-			handleCallbackQuery(bot, update.CallbackQuery)
+			if acceptMessage(bot, update.Message) {
+				handleMessage(bot, update.Message)
+			}
+		} else if update.EditedMessage != nil {
+			if acceptMessage(bot, update.EditedMessage) {
+				handleEditedMessage(bot, update.EditedMessage)
+			}
+		} else if query := update.PreCheckoutQuery; query != nil && query.From != nil {
+			handlePreCheckout(bot, query)
+		} else if query := update.CallbackQuery; query != nil && query.From != nil && !query.From.IsBot {
+			handleCallbackQuery(bot, query)
+		}
+		statesMu.Unlock()
+		updateDuration.Observe(time.Since(started).Seconds())
+	}
+}
+
+// Без tzdata в минимальных образах LoadLocation возвращает ошибку и nil,
+// поэтому база часовых поясов встроена в бинарник, а на крайний случай есть UTC
+func loadLocation(name string) *time.Location {
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		slog.Warn("Не удалось загрузить часовой пояс, используется UTC", "timezone", name, "err", err)
+		return time.UTC
+	}
+	return location
+}
+
+func registerBotCommands(bot Sender) {
+	// Пустой код языка — список по умолчанию для клиентов без перевода
+	langCodes := []string{""}
+	for _, l := range languages {
+		langCodes = append(langCodes, l.Code)
+	}
+
+	for _, code := range langCodes {
+		lang := code
+		if lang == "" {
+			lang = defaultLang
+		}
+		commands := localizeCommands(filterBotCommands(userCommands, cfg.BotCommands), lang)
+
+		config := tgbotapi.NewSetMyCommands(commands...)
+		config.LanguageCode = code
+		if _, err := bot.Request(config); err != nil {
+			slog.Error("Ошибка регистрации команд", "lang", code, "err", err)
+		}
+
+		// Админские команды видны только в чатах администраторов
+		allCommands := append(append([]tgbotapi.BotCommand{}, commands...), adminCommands...)
+		for _, adminID := range allAdminChatIDs() {
+			adminConfig := tgbotapi.NewSetMyCommandsWithScope(tgbotapi.NewBotCommandScopeChat(adminID), allCommands...)
+			adminConfig.LanguageCode = code
+			if _, err := bot.Request(adminConfig); err != nil {
+				slog.Error("Ошибка регистрации команд администратора", "chatID", adminID, "lang", code, "err", err)
+			}
+		}
+	}
+}
+
+// В userCommands вместо описаний хранятся ключи каталога
+func localizeCommands(commands []tgbotapi.BotCommand, lang string) []tgbotapi.BotCommand {
+	result := make([]tgbotapi.BotCommand, len(commands))
+	for i, c := range commands {
+		result[i] = tgbotapi.BotCommand{Command: c.Command, Description: tr(lang, c.Description)}
+	}
+	return result
+}
+
+func filterBotCommands(commands []tgbotapi.BotCommand, enabled string) []tgbotapi.BotCommand {
+	if strings.TrimSpace(enabled) == "" {
+		return commands
+	}
+
+	allowed := make(map[string]bool)
+	for _, name := range strings.Split(enabled, ",") {
+		allowed[strings.TrimPrefix(strings.TrimSpace(name), "/")] = true
+	}
+
+	var filtered []tgbotapi.BotCommand
+	for _, c := range commands {
+		if allowed[c.Command] {
+			filtered = append(filtered, c)
+		}
+	}
+	return filtered
+}
+
+func isClosedDate(date time.Time) bool {
+	return cfg.ClosedWeekdays[date.Weekday()] || cfg.BlackoutDates[date.Format("02.01.2006")]
+}
+
+func isAdmin(chatID int64) bool {
+	for _, id := range allAdminChatIDs() {
+		if id == chatID {
+			return true
+		}
+	}
+	return false
+}
+
+func notifyAdmins(bot Sender, venueID string, text string) {
+	sendToAdmins(bot, venueID, text, nil)
+}
+
+// Уведомления о брони уходят администраторам ее заведения
+func sendToAdmins(bot Sender, venueID string, text string, markup interface{}) {
+	if cfg.DryRun {
+		slog.Info("DRY_RUN: уведомление администраторам не отправлено", "venueID", venueID, "text", text)
+		return
+	}
+	for _, adminID := range venueAdmins(venueID) {
+		msg := tgbotapi.NewMessage(adminID, text)
+		if markup != nil {
+			msg.ReplyMarkup = markup
 		}
+		deliver(bot, adminID, "уведомление администратору", msg)
 	}
 }
 
 func initReservationsFile() {
-	if _, err := os.Stat(reservationsFile); os.IsNotExist(err) {
-		file, err := os.Create(reservationsFile)
+	if _, err := os.Stat(cfg.ReservationsFile); os.IsNotExist(err) {
+		file, err := os.Create(cfg.ReservationsFile)
 		if err != nil {
-			log.Printf("Ошибка создания файла бронирований: %v", err)
+			slog.Error("Ошибка создания файла бронирований", "err", err)
 			return
 		}
 		defer file.Close()
 
 		writer := csv.NewWriter(file)
-		headers := []string{
-			"ID",
-			"ChatID",
-			"Name",
-			"Phone",
-			"Guests",
-			"Date",
-			"Time",
-			"Comment",
-			"Confirmed",
-			"CreatedAt",
-		}
-		writer.Write(headers)
+		writer.Write(reservationHeaders)
 		writer.Flush()
+		return
+	}
+
+	migrateReservationsFile()
+}
+
+// Приводит файл со старым набором или порядком колонок к текущему заголовку
+func migrateReservationsFile() {
+	file, err := os.Open(cfg.ReservationsFile)
+	if err != nil {
+		slog.Error("Ошибка при открытии файла для миграции", "err", err)
+		return
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil || strings.Join(header, ",") == strings.Join(reservationHeaders, ",") {
+		return
+	}
+	columns := newCSVColumns(header)
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		slog.Error("Ошибка чтения файла для миграции", "err", err)
+		return
+	}
+
+	file.Close()
+
+	normalized := make([][]string, 0, len(records))
+	for _, record := range records {
+		normalized = append(normalized, columns.normalize(record))
+	}
+	if err := replaceReservationsFile(normalized); err != nil {
+		slog.Error("Ошибка миграции файла бронирований", "err", err)
+		return
 	}
+	slog.Info("Файл бронирований обновлен до новой схемы", "columns", len(reservationHeaders))
 }
 
-func cleanupExpiredReservations(bot *tgbotapi.BotAPI) {
+func cleanupExpiredReservations(bot Sender) {
+	var lastPurge time.Time
 	for {
-		currentTime := time.Now().In(loc)
-		for id, r := range reservations {
-			reservationTime, err := time.ParseInLocation("02.01.2006 15:04", r.Date+" "+r.Time, loc)
-			if err != nil {
+		lastPurge = cleanupPass(bot, lastPurge)
+		time.Sleep(5 * time.Minute)
+	}
+}
+
+// Один проход очистки; возвращает время последней чистки истории
+func cleanupPass(bot Sender, lastPurge time.Time) time.Time {
+	// Историю чистим раз в сутки, а завершаем прошедшие брони при каждом проходе
+	purge := clock.Now().Sub(lastPurge) >= purgeInterval
+
+	// Истекшие брони ищем под блокировкой на чтение, чтобы не тормозить обработку сообщений
+	statesMu.RLock()
+	found := len(expiredReservationIDs(clock.Now())) > 0 || (purge && len(outdatedReservationIDs(clock.Now())) > 0) ||
+		hasDeferredFeedback(clock.Now()) || len(unpaidDepositIDs(clock.Now())) > 0
+	statesMu.RUnlock()
+	if purge {
+		lastPurge = clock.Now()
+	}
+	if !found {
+		return lastPurge
+	}
+
+	statesMu.Lock()
+	defer statesMu.Unlock()
+	// Пока блокировки не было, бронь могли удалить или изменить, поэтому ищем заново
+	now := clock.Now()
+	var completed []Reservation
+	for _, id := range expiredReservationIDs(now) {
+		r := reservations[id]
+		// Бронь, которую так никто и не подтвердил, визитом не считается
+		if r.Status == statusPending {
+			r.Status = statusCancelled
+		} else {
+			r.Status = statusCompleted
+		}
+		r.StatusChangedAt = now
+		completed = append(completed, r)
+	}
+	// Файл переписываем один раз на все изменения; при ошибке брони
+	// останутся прежними и попадут в следующий проход
+	if err := updateReservationsInFile(completed...); err != nil {
+		slog.Error("Не удалось отметить прошедшие брони завершенными", "err", err)
+		storageErrors.Inc()
+		completed = nil
+	}
+	if len(completed) > 0 {
+		for _, r := range completed {
+			reservations[r.ID] = r
+			publishReservationEvent(eventUpdated, r)
+			if r.Status == statusCompleted {
+				requestFeedbackOutsideQuietHours(bot, r, now)
+			}
+		}
+		slog.Info("Прошедшие брони отмечены завершенными", "count", len(completed))
+	}
+
+	cancelUnpaidDeposits(bot, now)
+	flushDeferredFeedback(bot, now)
+
+	if purge {
+		purgeOutdatedReservations(now)
+	}
+	return lastPurge
+}
+
+// Активные брони, у которых закончилось окно активности
+func expiredReservationIDs(now time.Time) []string {
+	var expired []string
+	for id, r := range reservations {
+		if !r.Status.isActive() {
+			continue
+		}
+		if upcoming, ok := isUpcoming(r, now); ok && !upcoming {
+			expired = append(expired, id)
+		}
+	}
+	return expired
+}
+
+// Любые брони, визит по которым был раньше RETENTION_DAYS дней назад
+func outdatedReservationIDs(now time.Time) []string {
+	cutoff := now.AddDate(0, 0, -cfg.RetentionDays)
+	var outdated []string
+	for id, r := range reservations {
+		reservationTime, err := reservationDateTime(r)
+		if err != nil {
+			continue
+		}
+		if reservationTime.Before(cutoff) {
+			outdated = append(outdated, id)
+		}
+	}
+	return outdated
+}
+
+// Переносит устаревшие брони в архив (или удаляет, если архив отключен). Вызывать под statesMu
+func purgeOutdatedReservations(now time.Time) {
+	outdated := outdatedReservationIDs(now)
+	if len(outdated) == 0 {
+		return
+	}
+
+	if cfg.ArchiveFile != "" {
+		list := make([]Reservation, 0, len(outdated))
+		for _, id := range outdated {
+			list = append(list, reservations[id])
+		}
+		// Без записи в архив из рабочего файла ничего не удаляем
+		if err := archiveReservations(list); err != nil {
+			slog.Error("Ошибка записи архива броней", "path", cfg.ArchiveFile, "err", err)
+			return
+		}
+	}
+
+	if err := deleteReservationsFromFile(outdated...); err != nil {
+		slog.Error("Ошибка удаления устаревших броней из рабочего файла", "err", err)
+		storageErrors.Inc()
+		return
+	}
+	for _, id := range outdated {
+		delete(reservationCodes, reservations[id].Code)
+		delete(reservations, id)
+	}
+	slog.Info("Устаревшие брони перенесены из рабочего файла", "count", len(outdated), "archive", cfg.ArchiveFile)
+}
+
+func sweepIdleUserStates(bot Sender) {
+	for {
+		time.Sleep(idleSweepInterval)
+
+		statesMu.Lock()
+		now := clock.Now()
+		pruneRateLimiters(now)
+		prunePhoneCodeSends(now)
+		pruneSupportThreads(now)
+		changed := false
+		for chatID, state := range userStates {
+			if state.State == stateMainMenu || state.LastActivity.IsZero() {
+				continue
+			}
+			if now.Sub(state.LastActivity) <= cfg.IdleTimeout {
 				continue
 			}
 
-			if currentTime.After(reservationTime.Add(reservationTTL)) {
-				delete(reservations, id)
-				deleteReservationFromFile(id)
-				log.Printf("Бронь %s удалена (истек срок)", id)
+			clearUserState(chatID)
+			changed = true
+			slog.Info("Состояние сброшено из-за неактивности", "chatID", chatID)
+
+			if cfg.NotifyIdle {
+				sendMessage(bot, chatID, t(chatID, "idle_cancelled"), false)
+				showMainMenu(bot, chatID, hasActiveReservations(chatID))
 			}
 		}
-		time.Sleep(5 * time.Minute)
+		if changed {
+			saveUserStatesToFile()
+		}
+		statesMu.Unlock()
 	}
 }
 
 func loadReservationsFromFile() {
-	file, err := os.Open(reservationsFile)
+	file, err := os.Open(cfg.ReservationsFile)
 	if err != nil {
 		if os.IsNotExist(err) {
 			return
 		}
-		log.Printf("Ошибка при открытии файла бронирований: %v", err)
+		slog.Error("Ошибка при открытии файла бронирований", "err", err)
 		return
 	}
 	defer file.Close()
@@ -171,132 +639,281 @@ func loadReservationsFromFile() {
 	reader.Comma = ','
 	reader.FieldsPerRecord = -1
 
-	if _, err := reader.Read(); err != nil {
-		log.Printf("Ошибка чтения заголовка: %v", err)
+	header, err := reader.Read()
+	if err != nil {
+		slog.Error("Ошибка чтения заголовка", "err", err)
 		return
 	}
+	columns := newCSVColumns(header)
 
 	records, err := reader.ReadAll()
 	if err != nil {
-		log.Printf("Ошибка чтения файла бронирований: %v", err)
+		slog.Error("Ошибка чтения файла бронирований", "err", err)
 		return
 	}
 
 	for _, record := range records {
-		if len(record) < 10 {
-			continue
-		}
-
-		chatID, err := strconv.ParseInt(record[1], 10, 64)
+		reservation, err := parseReservationRecord(columns, record)
 		if err != nil {
-			log.Printf("Ошибка парсинга ChatID: %v", err)
+			slog.Warn("Пропущена запись в файле бронирований", "err", err)
 			continue
 		}
 
-		name := record[2]
-		if name == "" {
-			log.Printf("Пустое имя в брони ID: %s", record[0])
-			continue
+		// У старых записей кода нет, а совпавший код выдаем заново
+		if ownerID, taken := reservationCodes[reservation.Code]; reservation.Code == "" || (taken && ownerID != reservation.ID) {
+			reservation.Code = assignShortCode(reservation.ID)
 		}
 
-		guests, err := strconv.Atoi(record[4])
-		if err != nil {
-			log.Printf("Ошибка парсинга количества гостей: %v", err)
-			continue
-		}
+		reservations[reservation.ID] = reservation
+		reservationCodes[reservation.Code] = reservation.ID
+		slog.Debug("Загружена бронь", "reservationID", reservation.ID, "code", reservation.Code, "name", reservation.Name)
+	}
+}
 
-		confirmed, err := strconv.ParseBool(record[8])
-		if err != nil {
-			log.Printf("Ошибка парсинга статуса подтверждения: %v", err)
-			continue
+func loadUserStatesFromFile() {
+	data, err := os.ReadFile(cfg.UserStatesFile)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			slog.Error("Ошибка при открытии файла состояний", "err", err)
 		}
+		return
+	}
 
-		createdAt, err := time.Parse(time.RFC3339, record[9])
-		if err != nil {
-			log.Printf("Ошибка парсинга даты создания: %v", err)
+	var saved map[int64]UserState
+	if err := json.Unmarshal(data, &saved); err != nil {
+		slog.Error("Ошибка чтения файла состояний", "err", err)
+		return
+	}
+
+	now := clock.Now()
+	for chatID, state := range saved {
+		if now.Sub(state.LastActivity) > cfg.UserStateTTL {
+			slog.Info("Состояние устарело и не восстановлено", "chatID", chatID)
 			continue
 		}
+		userStates[chatID] = state
+	}
+	slog.Info("Восстановлены состояния пользователей", "count", len(userStates))
+}
 
-		reservation := Reservation{
-			ID:        record[0],
-			ChatID:    chatID,
-			Name:      name,
-			Phone:     record[3],
-			Guests:    guests,
-			Date:      record[5],
-			Time:      record[6],
-			Comment:   record[7],
-			Confirmed: confirmed,
-			CreatedAt: createdAt,
-		}
+func saveUserStatesToFile() {
+	if cfg.DryRun {
+		return
+	}
+	data, err := json.Marshal(userStates)
+	if err != nil {
+		slog.Error("Ошибка сериализации состояний", "err", err)
+		return
+	}
 
-		reservations[reservation.ID] = reservation
-		log.Printf("Загружена бронь: ID=%s, Имя='%s'", reservation.ID, reservation.Name)
+	// Пишем во временный файл и переименовываем, чтобы не оставить битый файл при падении
+	tmpFile := cfg.UserStatesFile + ".tmp"
+	if err := os.WriteFile(tmpFile, data, 0644); err != nil {
+		slog.Error("Ошибка записи файла состояний", "err", err)
+		return
+	}
+	if err := os.Rename(tmpFile, cfg.UserStatesFile); err != nil {
+		slog.Error("Ошибка сохранения файла состояний", "err", err)
+	}
+}
+
+func touchUserState(chatID int64) {
+	state := userStates[chatID]
+	state.LastActivity = clock.Now()
+	userStates[chatID] = state
+	saveUserStatesToFile()
+}
+
+func rememberUsername(chatID int64, username string) {
+	state, exists := userStates[chatID]
+	if !exists || state.Username == username {
+		return
 	}
+	state.Username = username
+	userStates[chatID] = state
 }
 
 func clearUserState(chatID int64) {
-	userStates[chatID] = UserState{State: stateMainMenu}
+	previous := userStates[chatID]
+	userStates[chatID] = UserState{State: stateMainMenu, Lang: previous.Lang, Source: previous.Source}
+}
+
+// Бронирование ведётся только в личке с живым пользователем: сообщения из групп,
+// каналов и от других ботов иначе превращаются в мусорные брони
+func acceptMessage(bot Sender, message *tgbotapi.Message) bool {
+	if message.From == nil || message.From.IsBot {
+		return false
+	}
+	if message.Chat.IsPrivate() {
+		return true
+	}
+	// В группе отвечаем только на явные команды, чтобы не шуметь в общем чате
+	if message.IsCommand() {
+		sendMessage(bot, message.Chat.ID, tr(detectLang(message.From.LanguageCode), "private_only"), false)
+	}
+	return false
+}
+
+// Исправленное сообщение считаем новым ответом, только если бот сейчас ждёт ввода текста:
+// гость обычно правит опечатку в последнем ответе. В остальных шагах правка прошлых
+// сообщений ничего не меняет, поэтому просим отправить новое сообщение
+func handleEditedMessage(bot Sender, message *tgbotapi.Message) {
+	chatID := message.Chat.ID
+	if message.Text != "" && awaitsTextInput(userStates[chatID].State) {
+		handleMessage(bot, message)
+		return
+	}
+	// Как и в handleMessage: сначала лимит запросов, затем блокировка
+	if allowed, _ := allowRequest(chatID); !allowed || refuseBlockedUser(bot, chatID) {
+		return
+	}
+	sendMessage(bot, chatID, t(chatID, "edit_ignored"), false)
+}
+
+func awaitsTextInput(state int) bool {
+	switch state {
+	case stateWaitingForName, stateWaitingForManualPhone, stateWaitingForPhoneCode, stateWaitingForGuests,
+		stateWaitingForComment, stateWaitingForManualTime, stateWaitingForOccasionText,
+		stateEditingReservationName, stateEditingReservationPhone, stateEditingReservationGuests,
+		stateEditingReservationDate, stateEditingReservationTime, stateEditingReservationComment:
+		return true
+	}
+	return false
 }
 
-func handleMessage(bot *tgbotapi.BotAPI, message *tgbotapi.Message) {
+func handleMessage(bot Sender, message *tgbotapi.Message) {
 	chatID := message.Chat.ID
+	// Платеж уже прошел, его нельзя потерять из-за лимита запросов или блокировки
+	if message.SuccessfulPayment != nil {
+		handleSuccessfulPayment(bot, chatID, message.SuccessfulPayment)
+		return
+	}
+	if allowed, warn := allowRequest(chatID); !allowed {
+		if warn {
+			sendMessage(bot, chatID, t(chatID, "rate_limited"), false)
+		}
+		return
+	}
+
+	if message.From != nil {
+		rememberLang(chatID, message.From.LanguageCode)
+	}
+	if refuseBlockedUser(bot, chatID) {
+		return
+	}
+	// Раз гость снова пишет, значит бот разблокирован
+	markChatBlocked(chatID, false)
 	state, exists := userStates[chatID]
+	defer touchUserState(chatID)
+	rememberUsername(chatID, message.Chat.UserName)
+	state.Username = message.Chat.UserName
+
+	// Команды отмены работают из любого состояния, включая редактирование
+	switch message.Command() {
+	case "cancel":
+		clearUserState(chatID)
+		sendMessage(bot, chatID, t(chatID, "action_cancelled"), false)
+		showMainMenu(bot, chatID, hasActiveReservations(chatID))
+		return
+	case "menu":
+		showMainMenu(bot, chatID, hasActiveReservations(chatID))
+		return
+	case "help":
+		sendMessage(bot, chatID, t(chatID, "help", durationTitle(userLang(chatID), cfg.MinBookingLead), cfg.ManagerPhone), false)
+		return
+	case "language":
+		askForLanguage(bot, chatID)
+		return
+	case "mybookings":
+		clearUserState(chatID)
+		showUserReservations(bot, chatID)
+		return
+	case "booking":
+		showBooking(bot, chatID, message.CommandArguments())
+		return
+	}
+
+	if isAdmin(chatID) && relaySupportReply(bot, message) {
+		return
+	}
+	if isAdmin(chatID) && handleAdminCommand(bot, message) {
+		return
+	}
 
-	if message.Contact != nil && state.State == stateWaitingForPhone {
-		phone := normalizePhone(message.Contact.PhoneNumber)
-		if !phoneRegex.MatchString(phone) {
-			sendMessage(bot, chatID, "Номер телефона должен содержать 11 цифр. Пожалуйста, проверьте правильность написания.", true)
+	// Контакт принимаем и при ручном вводе: гость мог передумать и нажать кнопку
+	if message.Contact != nil && (state.State == stateWaitingForPhone || state.State == stateWaitingForManualPhone) {
+		// Telegram присылает номер контакта в международном формате, но иногда без "+"
+		phone, err := normalizePhone("+" + strings.TrimPrefix(message.Contact.PhoneNumber, "+"))
+		if err != nil {
+			sendMessage(bot, chatID, t(chatID, "phone_invalid"), false)
 			return
 		}
-		userStates[chatID] = UserState{
-			State:           stateWaitingForGuests,
-			Name:            state.Name,
-			PhoneContact:    phone,
-			PhoneManual:     state.PhoneManual,
-			Guests:          state.Guests,
-			Date:            state.Date,
-			Comment:         state.Comment,
-			TempReservation: state.TempReservation,
+		// Собственный контакт Telegram уже подтвердил, чужой — нет
+		ownContact := message.From != nil && message.Contact.UserID == message.From.ID
+		if !ownContact && phoneNeedsVerification(chatID, phone) {
+			requestPhoneCode(bot, chatID, phone, false)
+			return
 		}
-		log.Printf("Сохранен контактный телефон для chatID %d: Имя='%s', Телефон='%s'", chatID, state.Name, phone)
-		sendMessage(bot, chatID, "Спасибо! Теперь укажите количество гостей:", true)
+		state.State = stateWaitingForGuests
+		state.PhoneContact = phone
+		state.PhoneManual = ""
+		userStates[chatID] = state
+		slog.Debug("Сохранен контактный телефон", "chatID", chatID, "state", state.State, "name", state.Name, "phone", phone)
+		askForGuests(bot, chatID)
 		return
 	}
 
-	switch message.Text {
-	case "/start":
+	// t.me/<bot>?start=<метка> приходит как "/start <метка>"; метка остаётся до следующей
+	if message.Command() == "start" {
+		if payload := message.CommandArguments(); startPayload.MatchString(payload) {
+			state.Source = payload
+			userStates[chatID] = state
+		}
 		clearUserState(chatID)
 		showMainMenu(bot, chatID, hasActiveReservations(chatID))
 		return
-	case "Забронировать стол":
+	}
+
+	switch buttonKey(message.Text) {
+	case "btn_book":
+		clearUserState(chatID)
+		startBooking(bot, chatID)
+		return
+	case "btn_repeat":
 		clearUserState(chatID)
-		askForName(bot, chatID)
+		repeatLastBooking(bot, chatID)
 		return
-	case "Связаться с нами":
-		sendMessage(bot, chatID, "Наш телефон для связи: "+managerPhone, false)
+	case "btn_contact":
+		showContactOptions(bot, chatID)
 		return
-	case "Моя бронь":
+	case "btn_menu":
+		sendMenu(bot, chatID)
+		return
+	case "btn_directions":
+		sendVenueLocation(bot, chatID)
+		return
+	case "btn_my_bookings":
 		clearUserState(chatID)
 		showUserReservations(bot, chatID)
 		return
-	case "Назад":
+	case "btn_menu_back":
 		clearUserState(chatID)
 		showMainMenuSilent(bot, chatID, hasActiveReservations(chatID))
 		return
-	case "Пропустить":
+	case "btn_step_back":
+		goBack(bot, chatID)
+		return
+	case "btn_resend_code":
+		if state.State == stateWaitingForPhoneCode {
+			sendPhoneCode(bot, chatID)
+			return
+		}
+	case "btn_skip":
 		if state.State == stateWaitingForComment {
-			userStates[chatID] = UserState{
-				State:           stateWaitingForDate,
-				Name:            state.Name,
-				PhoneContact:    state.PhoneContact,
-				PhoneManual:     state.PhoneManual,
-				Guests:          state.Guests,
-				Date:            state.Date,
-				Comment:         "-",
-				TempReservation: state.TempReservation,
-			}
-			log.Printf("Пропущен комментарий для chatID %d", chatID)
+			state.State = stateWaitingForDate
+			state.Comment = "-"
+			userStates[chatID] = state
+			slog.Debug("Пропущен комментарий", "chatID", chatID, "state", state.State)
 			askForDate(bot, chatID)
 			return
 		}
@@ -304,89 +921,83 @@ func handleMessage(bot *tgbotapi.BotAPI, message *tgbotapi.Message) {
 
 	if exists {
 		switch state.State {
+		case stateWaitingForSupport:
+			forwardSupportMessage(bot, chatID, message)
+			return
 		case stateWaitingForName:
-			name := strings.TrimSpace(message.Text)
-			if len(name) < 2 {
-				sendMessage(bot, chatID, "Имя должно содержать хотя бы 2 символа. Пожалуйста, введите ваше имя:", true)
+			name, err := parseName(userLang(chatID), message.Text)
+			if err != nil {
+				sendMessage(bot, chatID, err.Error(), false)
 				return
 			}
-			userStates[chatID] = UserState{
-				State:           stateWaitingForPhone,
-				Name:            name,
-				PhoneContact:    state.PhoneContact,
-				PhoneManual:     state.PhoneManual,
-				Guests:          state.Guests,
-				Date:            state.Date,
-				Comment:         state.Comment,
-				TempReservation: state.TempReservation,
-			}
-			log.Printf("Сохранено имя для chatID %d: '%s'", chatID, name)
+			state.State = stateWaitingForPhone
+			state.Name = name
+			userStates[chatID] = state
+			slog.Debug("Сохранено имя", "chatID", chatID, "state", state.State, "name", name)
 			askForPhone(bot, chatID)
 			return
 		case stateWaitingForManualPhone:
-			phone := normalizePhone(message.Text)
-			if !phoneRegex.MatchString(phone) {
-				sendMessage(bot, chatID, "Номер телефона должен содержать 11 цифр. Пожалуйста, проверьте правильность написания.", true)
+			phone, err := normalizePhone(message.Text)
+			if err != nil {
+				sendMessage(bot, chatID, t(chatID, "phone_invalid"), false)
 				return
 			}
-			userStates[chatID] = UserState{
-				State:           stateWaitingForGuests,
-				Name:            state.Name,
-				PhoneContact:    state.PhoneContact,
-				PhoneManual:     phone,
-				Guests:          state.Guests,
-				Date:            state.Date,
-				Comment:         state.Comment,
-				TempReservation: state.TempReservation,
+			if phoneNeedsVerification(chatID, phone) {
+				requestPhoneCode(bot, chatID, phone, false)
+				return
 			}
-			log.Printf("Сохранен ручной телефон для chatID %d: Имя='%s', Телефон='%s'", chatID, state.Name, phone)
-			sendMessage(bot, chatID, "Спасибо! Теперь укажите количество гостей:", true)
+			state.State = stateWaitingForGuests
+			state.PhoneManual = phone
+			state.PhoneContact = ""
+			userStates[chatID] = state
+			slog.Debug("Сохранен ручной телефон", "chatID", chatID, "state", state.State, "name", state.Name, "phone", phone)
+			askForGuests(bot, chatID)
+			return
+		case stateWaitingForPhoneCode:
+			checkPhoneCode(bot, chatID, message.Text)
 			return
 		case stateWaitingForGuests:
-			guests, err := strconv.Atoi(message.Text)
-			if err != nil || guests <= 0 {
-				sendMessage(bot, chatID, "Пожалуйста, введите корректное количество гостей (число больше 0).", true)
+			guests, err := parseGuests(userLang(chatID), message.Text)
+			if err != nil {
+				sendMessage(bot, chatID, err.Error(), false)
 				return
 			}
-			userStates[chatID] = UserState{
-				State:           stateWaitingForComment,
-				Name:            state.Name,
-				PhoneContact:    state.PhoneContact,
-				PhoneManual:     state.PhoneManual,
-				Guests:          guests,
-				Date:            state.Date,
-				Comment:         state.Comment,
-				TempReservation: state.TempReservation,
+			state.Guests = guests
+			userStates[chatID] = state
+			slog.Debug("Сохранено количество гостей", "chatID", chatID, "state", state.State, "guests", guests)
+			askAfterGuests(bot, chatID)
+			return
+		case stateWaitingForOccasionText:
+			occasion := strings.TrimSpace(message.Text)
+			if occasion == "" {
+				sendPrompt(bot, chatID, t(chatID, "ask_own_occasion"))
+				return
 			}
-			log.Printf("Сохранено количество гостей для chatID %d: %d", chatID, guests)
+			state.State = stateWaitingForComment
+			state.Occasion = occasion
+			userStates[chatID] = state
 			askForComment(bot, chatID)
 			return
 		case stateWaitingForComment:
-			comment := strings.TrimSpace(message.Text)
-			if comment == "" {
-				comment = "-"
-			}
-			userStates[chatID] = UserState{
-				State:           stateWaitingForDate,
-				Name:            state.Name,
-				PhoneContact:    state.PhoneContact,
-				PhoneManual:     state.PhoneManual,
-				Guests:          state.Guests,
-				Date:            state.Date,
-				Comment:         comment,
-				TempReservation: state.TempReservation,
+			comment, err := parseComment(userLang(chatID), message.Text)
+			if err != nil {
+				sendMessage(bot, chatID, err.Error(), false)
+				return
 			}
-			log.Printf("Сохранен комментарий для chatID %d: '%s'", chatID, comment)
+			state.State = stateWaitingForDate
+			state.Comment = comment
+			userStates[chatID] = state
+			slog.Debug("Сохранен комментарий", "chatID", chatID, "state", state.State, "comment", comment)
 			askForDate(bot, chatID)
 			return
 		case stateEditingReservationName:
-			name := strings.TrimSpace(message.Text)
-			if len(name) < 2 {
-				sendMessage(bot, chatID, "Имя должно содержать хотя бы 2 символа. Пожалуйста, введите ваше имя:", true)
+			name, err := parseName(userLang(chatID), message.Text)
+			if err != nil {
+				sendMessage(bot, chatID, err.Error(), true)
 				return
 			}
 			if state.TempReservation == nil {
-				sendMessage(bot, chatID, "Ошибка редактирования. Пожалуйста, начните заново.", false)
+				sendMessage(bot, chatID, t(chatID, "edit_error"), false)
 				showMainMenu(bot, chatID, hasActiveReservations(chatID))
 				return
 			}
@@ -395,28 +1006,32 @@ func handleMessage(bot *tgbotapi.BotAPI, message *tgbotapi.Message) {
 			showEditOptions(bot, chatID, *state.TempReservation)
 			return
 		case stateEditingReservationPhone:
-			phone := normalizePhone(message.Text)
-			if !phoneRegex.MatchString(phone) {
-				sendMessage(bot, chatID, "Номер телефона должен содержать 11 цифр. Пожалуйста, проверьте правильность написания.", true)
+			phone, err := normalizePhone(message.Text)
+			if err != nil {
+				sendMessage(bot, chatID, t(chatID, "phone_invalid"), true)
 				return
 			}
 			if state.TempReservation == nil {
-				sendMessage(bot, chatID, "Ошибка редактирования. Пожалуйста, начните заново.", false)
+				sendMessage(bot, chatID, t(chatID, "edit_error"), false)
 				showMainMenu(bot, chatID, hasActiveReservations(chatID))
 				return
 			}
+			if phone != state.TempReservation.Phone && phoneNeedsVerification(chatID, phone) {
+				requestPhoneCode(bot, chatID, phone, true)
+				return
+			}
 			state.TempReservation.Phone = phone
 			userStates[chatID] = state
 			showEditOptions(bot, chatID, *state.TempReservation)
 			return
 		case stateEditingReservationGuests:
-			guests, err := strconv.Atoi(message.Text)
-			if err != nil || guests <= 0 {
-				sendMessage(bot, chatID, "Пожалуйста, введите корректное количество гостей (число больше 0).", true)
+			guests, err := parseGuests(userLang(chatID), message.Text)
+			if err != nil {
+				sendMessage(bot, chatID, err.Error(), true)
 				return
 			}
 			if state.TempReservation == nil {
-				sendMessage(bot, chatID, "Ошибка редактирования. Пожалуйста, начните заново.", false)
+				sendMessage(bot, chatID, t(chatID, "edit_error"), false)
 				showMainMenu(bot, chatID, hasActiveReservations(chatID))
 				return
 			}
@@ -426,43 +1041,56 @@ func handleMessage(bot *tgbotapi.BotAPI, message *tgbotapi.Message) {
 			return
 		case stateEditingReservationDate:
 			date := strings.TrimSpace(message.Text)
-			_, err := time.ParseInLocation("02.01.2006", date, loc)
+			parsedDate, err := time.ParseInLocation("02.01.2006", date, loc)
 			if err != nil {
-				sendMessage(bot, chatID, "Пожалуйста, введите дату в формате ДД.ММ.ГГГГ.", true)
+				sendMessage(bot, chatID, t(chatID, "date_format"), true)
+				return
+			}
+			if isClosedDate(parsedDate) {
+				sendMessage(bot, chatID, t(chatID, "date_closed"), true)
 				return
 			}
 			if state.TempReservation == nil {
-				sendMessage(bot, chatID, "Ошибка редактирования. Пожалуйста, начните заново.", false)
+				sendMessage(bot, chatID, t(chatID, "edit_error"), false)
 				showMainMenu(bot, chatID, hasActiveReservations(chatID))
 				return
 			}
 			state.TempReservation.Date = date
+			state.State = stateEditingReservationTime
 			userStates[chatID] = state
 			askForTime(bot, chatID)
 			return
-		case stateEditingReservationTime:
-			timeStr := strings.TrimSpace(message.Text)
-			_, err := time.ParseInLocation("15:04", timeStr, loc)
+		case stateWaitingForManualTime:
+			timeStr, err := manualBookingTime(bot, chatID, stateVenue(state), state.Date, message.Text)
 			if err != nil {
-				sendMessage(bot, chatID, "Пожалуйста, введите время в формате ЧЧ:ММ.", true)
+				sendMessage(bot, chatID, err.Error(), false)
 				return
 			}
+			processTimeSelection(bot, chatID, timeStr)
+			return
+		case stateEditingReservationTime:
 			if state.TempReservation == nil {
-				sendMessage(bot, chatID, "Ошибка редактирования. Пожалуйста, начните заново.", false)
+				sendMessage(bot, chatID, t(chatID, "edit_error"), false)
 				showMainMenu(bot, chatID, hasActiveReservations(chatID))
 				return
 			}
+			timeStr, err := manualBookingTime(bot, chatID, stateVenue(state), state.TempReservation.Date, message.Text)
+			if err != nil {
+				sendMessage(bot, chatID, err.Error(), true)
+				return
+			}
 			state.TempReservation.Time = timeStr
 			userStates[chatID] = state
 			showEditOptions(bot, chatID, *state.TempReservation)
 			return
 		case stateEditingReservationComment:
-			comment := strings.TrimSpace(message.Text)
-			if comment == "" {
-				comment = "-"
+			comment, err := parseComment(userLang(chatID), message.Text)
+			if err != nil {
+				sendMessage(bot, chatID, err.Error(), true)
+				return
 			}
 			if state.TempReservation == nil {
-				sendMessage(bot, chatID, "Ошибка редактирования. Пожалуйста, начните заново.", false)
+				sendMessage(bot, chatID, t(chatID, "edit_error"), false)
 				showMainMenu(bot, chatID, hasActiveReservations(chatID))
 				return
 			}
@@ -476,7 +1104,7 @@ func handleMessage(bot *tgbotapi.BotAPI, message *tgbotapi.Message) {
 	showMainMenu(bot, chatID, hasActiveReservations(chatID))
 }
 
-func showMainMenu(bot *tgbotapi.BotAPI, chatID int64, showMyReservationButton bool) {
+func showMainMenu(bot Sender, chatID int64, showMyReservationButton bool) {
 	state, exists := userStates[chatID]
 	if !exists {
 		state = UserState{State: stateMainMenu}
@@ -485,27 +1113,79 @@ func showMainMenu(bot *tgbotapi.BotAPI, chatID int64, showMyReservationButton bo
 	}
 	userStates[chatID] = state
 
-	buttons := []tgbotapi.KeyboardButton{
-		tgbotapi.NewKeyboardButton("Забронировать стол"),
-		tgbotapi.NewKeyboardButton("Связаться с нами"),
-	}
+	msg := tgbotapi.NewMessage(chatID, t(chatID, "choose_action"))
+	msg.ReplyMarkup = mainMenuKeyboard(chatID, showMyReservationButton)
+	deliver(bot, chatID, "главное меню", msg)
+}
 
+func mainMenuKeyboard(chatID int64, showMyReservationButton bool) tgbotapi.ReplyKeyboardMarkup {
+	extra := []tgbotapi.KeyboardButton{tgbotapi.NewKeyboardButton(t(chatID, "btn_menu"))}
 	if showMyReservationButton {
-		buttons = append(buttons, tgbotapi.NewKeyboardButton("Моя бронь"))
+		extra = append(extra, tgbotapi.NewKeyboardButton(t(chatID, "btn_my_bookings")))
+	}
+	if venuesWithLocation() != nil {
+		extra = append(extra, tgbotapi.NewKeyboardButton(t(chatID, "btn_directions")))
+	}
+
+	rows := [][]tgbotapi.KeyboardButton{{
+		tgbotapi.NewKeyboardButton(t(chatID, "btn_book")),
+		tgbotapi.NewKeyboardButton(t(chatID, "btn_contact")),
+	}}
+	if _, ok := lastOwnReservation(chatID); ok {
+		rows = append(rows, tgbotapi.NewKeyboardButtonRow(tgbotapi.NewKeyboardButton(t(chatID, "btn_repeat"))))
+	}
+	rows = append(rows, extra)
+	return tgbotapi.NewReplyKeyboard(rows...)
+}
+
+func sendVenueLocation(bot Sender, chatID int64) {
+	venues := venuesWithLocation()
+	if venues == nil {
+		sendMessage(bot, chatID, t(chatID, "contact_phone", cfg.ManagerPhone), false)
+		return
 	}
+	for _, v := range venues {
+		deliver(bot, chatID, "адрес заведения", tgbotapi.NewVenue(chatID, v.Name, v.Address, v.Latitude, v.Longitude))
+	}
+}
 
-	var keyboardRows [][]tgbotapi.KeyboardButton
-	keyboardRows = append(keyboardRows, buttons[:2])
-	if len(buttons) > 2 {
-		keyboardRows = append(keyboardRows, buttons[2:])
+func sendMenu(bot Sender, chatID int64) {
+	var file tgbotapi.RequestFileData = tgbotapi.FileID(menuFileID)
+	if menuFileID == "" {
+		if _, err := os.Stat(cfg.MenuFile); err != nil {
+			slog.Error("Файл меню недоступен", "path", cfg.MenuFile, "err", err)
+			sendMessage(bot, chatID, t(chatID, "menu_unavailable", cfg.ManagerPhone), false)
+			return
+		}
+		file = tgbotapi.FilePath(cfg.MenuFile)
 	}
 
-	msg := tgbotapi.NewMessage(chatID, "Выберите действие:")
-	msg.ReplyMarkup = tgbotapi.NewReplyKeyboard(keyboardRows...)
-	bot.Send(msg)
+	var menu tgbotapi.Chattable = tgbotapi.NewDocument(chatID, file)
+	switch strings.ToLower(filepath.Ext(cfg.MenuFile)) {
+	case ".jpg", ".jpeg", ".png":
+		menu = tgbotapi.NewPhoto(chatID, file)
+	}
+	err := safeSend(bot, chatID, "меню", menu, rememberMenuFile)
+	if err != nil && !errors.Is(err, errSendQueued) {
+		sendErrors.Inc()
+		slog.Error("Ошибка отправки меню", "chatID", chatID, "err", err)
+		sendMessage(bot, chatID, t(chatID, "menu_unavailable", cfg.ManagerPhone), false)
+	}
 }
 
-func showMainMenuSilent(bot *tgbotapi.BotAPI, chatID int64, showMyReservationButton bool) {
+// После первой отправки меню шлём уже загруженный в Telegram файл
+func rememberMenuFile(sent tgbotapi.Message) {
+	if menuFileID != "" {
+		return
+	}
+	if sent.Document != nil {
+		menuFileID = sent.Document.FileID
+	} else if len(sent.Photo) > 0 {
+		menuFileID = sent.Photo[len(sent.Photo)-1].FileID
+	}
+}
+
+func showMainMenuSilent(bot Sender, chatID int64, showMyReservationButton bool) {
 	state, exists := userStates[chatID]
 	if !exists {
 		state = UserState{State: stateMainMenu}
@@ -514,168 +1194,787 @@ func showMainMenuSilent(bot *tgbotapi.BotAPI, chatID int64, showMyReservationBut
 	}
 	userStates[chatID] = state
 
-	buttons := []tgbotapi.KeyboardButton{
-		tgbotapi.NewKeyboardButton("Забронировать стол"),
-		tgbotapi.NewKeyboardButton("Связаться с нами"),
+	msg := tgbotapi.NewMessage(chatID, "")
+	msg.ReplyMarkup = mainMenuKeyboard(chatID, showMyReservationButton)
+	deliver(bot, chatID, "главное меню", msg)
+}
+
+func askForLanguage(bot Sender, chatID int64) {
+	var row []tgbotapi.InlineKeyboardButton
+	for _, l := range languages {
+		row = append(row, tgbotapi.NewInlineKeyboardButtonData(l.Title, "lang_"+l.Code))
 	}
 
-	if showMyReservationButton {
-		buttons = append(buttons, tgbotapi.NewKeyboardButton("Моя бронь"))
+	msg := tgbotapi.NewMessage(chatID, t(chatID, "choose_language"))
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(row)
+	deliver(bot, chatID, "выбор языка", msg)
+}
+
+func setLanguage(bot Sender, chatID int64, lang string) {
+	if _, ok := catalog[lang]; !ok {
+		return
+	}
+
+	state := userStates[chatID]
+	state.Lang = lang
+	userStates[chatID] = state
+
+	profile, _ := getProfile(chatID)
+	profile.ChatID = chatID
+	profile.Lang = lang
+	saveProfile(profile)
+
+	sendMessage(bot, chatID, t(chatID, "language_set"), false)
+	showMainMenu(bot, chatID, hasActiveReservations(chatID))
+}
+
+func askForName(bot Sender, chatID int64) {
+	sendPrompt(bot, chatID, t(chatID, "ask_name"))
+	state := userStates[chatID]
+	state.State = stateWaitingForName
+	userStates[chatID] = state
+
+	// Постоянному гостю предлагаем не вводить имя и телефон заново
+	if last, ok := getProfile(chatID); ok && last.Name != "" && last.Phone != "" && !state.StaffBooking {
+		msg := tgbotapi.NewMessage(chatID, t(chatID, "reuse_offer"))
+		msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(t(chatID, "btn_reuse_data", last.Name, formatPhone(last.Phone)), "reuse_data"),
+		))
+		deliver(bot, chatID, "прошлые данные", msg)
 	}
+}
 
-	var keyboardRows [][]tgbotapi.KeyboardButton
-	keyboardRows = append(keyboardRows, buttons[:2])
-	if len(buttons) > 2 {
-		keyboardRows = append(keyboardRows, buttons[2:])
+func reusePreviousData(bot Sender, chatID int64) {
+	state := userStates[chatID]
+	last, ok := getProfile(chatID)
+	if state.State != stateWaitingForName || !ok || last.Name == "" || last.Phone == "" {
+		return
 	}
+	state.Name = last.Name
+	state.PhoneContact = last.Phone
+	state.PhoneManual = ""
+	state.State = stateWaitingForGuests
+	userStates[chatID] = state
+	askForGuests(bot, chatID)
+}
 
-	msg := tgbotapi.NewMessage(chatID, "")
-	msg.ReplyMarkup = tgbotapi.NewReplyKeyboard(keyboardRows...)
-	bot.Send(msg)
+// Последняя бронь, которую гость оформил сам; брони от администратора не в счет
+func lastOwnReservation(chatID int64) (Reservation, bool) {
+	var last Reservation
+	found := false
+	for _, r := range reservations {
+		if r.ChatID != chatID || r.CreatedByStaff {
+			continue
+		}
+		if !found || r.CreatedAt.After(last.CreatedAt) {
+			last, found = r, true
+		}
+	}
+	return last, found
+}
+
+// «Повторить прошлую бронь»: имя, телефон, гости и место берутся из последней брони,
+// гость сразу выбирает дату, а все поля может поправить на экране проверки
+func repeatLastBooking(bot Sender, chatID int64) {
+	last, ok := lastOwnReservation(chatID)
+	if !ok {
+		startBooking(bot, chatID)
+		return
+	}
+	venue, venueOK := findVenue(last.VenueID)
+	if !venueOK && multiVenue() {
+		startBooking(bot, chatID)
+		return
+	}
+
+	state := userStates[chatID]
+	state.VenueID = venue.ID
+	state.Name = last.Name
+	state.PhoneContact = last.Phone
+	state.PhoneManual = ""
+	state.ChildSeat = last.NeedsChildSeat
+	state.Comment = "-"
+	state.Seating = ""
+	for _, option := range cfg.SeatingOptions {
+		if option == last.SeatingPreference {
+			state.Seating = option
+		}
+	}
+	// Лимиты гостей могли поменяться с прошлого раза
+	if last.Guests < cfg.MinGuests || last.Guests > cfg.MaxGuests {
+		state.State = stateWaitingForGuests
+		userStates[chatID] = state
+		askForGuests(bot, chatID)
+		return
+	}
+	state.Guests = last.Guests
+	state.State = stateWaitingForDate
+	userStates[chatID] = state
+
+	sendMessage(bot, chatID, t(chatID, "repeat_prefill", last.Name, formatPhone(last.Phone), last.Guests), false)
+	askForDate(bot, chatID)
+}
+
+func askForGuests(bot Sender, chatID int64) {
+	sendPrompt(bot, chatID, t(chatID, "ask_guests"))
+}
+
+// Текстовый вопрос мастера бронирования с кнопкой возврата на шаг назад
+func sendPrompt(bot Sender, chatID int64, text string) {
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.ReplyMarkup = tgbotapi.NewReplyKeyboard(
+		tgbotapi.NewKeyboardButtonRow(
+			tgbotapi.NewKeyboardButton(t(chatID, "btn_step_back")),
+		),
+	)
+	deliver(bot, chatID, "подсказка", msg)
+}
+
+func isEditingState(state int) bool {
+	switch state {
+	case stateEditingReservation, stateEditingReservationName, stateEditingReservationPhone,
+		stateEditingReservationGuests, stateEditingReservationDate, stateEditingReservationTime,
+		stateEditingReservationComment, stateWaitingForSupport:
+		return true
+	}
+	return false
+}
+
+func goBack(bot Sender, chatID int64) {
+	state := userStates[chatID]
+
+	switch state.State {
+	case stateWaitingForName:
+		if multiVenue() {
+			askForVenue(bot, chatID)
+			return
+		}
+		clearUserState(chatID)
+		showMainMenu(bot, chatID, hasActiveReservations(chatID))
+	case stateWaitingForVenue:
+		clearUserState(chatID)
+		showMainMenu(bot, chatID, hasActiveReservations(chatID))
+	case stateWaitingForPhone, stateWaitingForManualPhone:
+		askForName(bot, chatID)
+	case stateWaitingForPhoneCode:
+		cancelPhoneCode(bot, chatID)
+	case stateWaitingForGuests:
+		state.State = stateWaitingForPhone
+		state.PhoneContact = ""
+		state.PhoneManual = ""
+		userStates[chatID] = state
+		askForPhone(bot, chatID)
+	case stateWaitingForComment, stateWaitingForOccasionText:
+		state.State = stateWaitingForOccasion
+		userStates[chatID] = state
+		askForOccasion(bot, chatID)
+	case stateWaitingForOccasion:
+		if len(cfg.SeatingOptions) > 0 {
+			state.State = stateWaitingForSeating
+			userStates[chatID] = state
+			askForSeating(bot, chatID)
+			return
+		}
+		if cfg.AskChildSeat {
+			state.State = stateWaitingForChildSeat
+			userStates[chatID] = state
+			askForChildSeat(bot, chatID)
+			return
+		}
+		state.State = stateWaitingForGuests
+		userStates[chatID] = state
+		askForGuests(bot, chatID)
+	case stateWaitingForSeating:
+		if cfg.AskChildSeat {
+			state.State = stateWaitingForChildSeat
+			userStates[chatID] = state
+			askForChildSeat(bot, chatID)
+			return
+		}
+		state.State = stateWaitingForGuests
+		userStates[chatID] = state
+		askForGuests(bot, chatID)
+	case stateWaitingForChildSeat:
+		state.State = stateWaitingForGuests
+		userStates[chatID] = state
+		askForGuests(bot, chatID)
+	case stateWaitingForDate:
+		state.State = stateWaitingForComment
+		userStates[chatID] = state
+		askForComment(bot, chatID)
+	case stateWaitingForTime:
+		state.State = stateWaitingForDate
+		userStates[chatID] = state
+		askForDate(bot, chatID)
+	case stateWaitingForManualTime, stateConfirmingReservation:
+		state.State = stateWaitingForTime
+		state.TempReservation = nil
+		userStates[chatID] = state
+		askForTime(bot, chatID)
+	default:
+		// Из шагов редактирования возвращаемся к списку полей брони
+		if state.TempReservation != nil && isEditingState(state.State) {
+			state.State = stateEditingReservation
+			userStates[chatID] = state
+			showEditOptions(bot, chatID, *state.TempReservation)
+			return
+		}
+		clearUserState(chatID)
+		showMainMenu(bot, chatID, hasActiveReservations(chatID))
+	}
+}
+
+// После количества гостей спрашиваем место, если площадка задала варианты
+func askAfterGuests(bot Sender, chatID int64) {
+	if cfg.AskChildSeat {
+		state := userStates[chatID]
+		state.State = stateWaitingForChildSeat
+		userStates[chatID] = state
+		askForChildSeat(bot, chatID)
+		return
+	}
+	askAfterChildSeat(bot, chatID)
+}
+
+func askForChildSeat(bot Sender, chatID int64) {
+	msg := tgbotapi.NewMessage(chatID, t(chatID, "ask_child_seat"))
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(t(chatID, "btn_yes"), "child_yes"),
+			tgbotapi.NewInlineKeyboardButtonData(t(chatID, "btn_no"), "child_no"),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(t(chatID, "btn_step_back"), "back"),
+			tgbotapi.NewInlineKeyboardButtonData(t(chatID, "btn_cancel"), "cancel"),
+		),
+	)
+	deliver(bot, chatID, "вопрос о детском стуле", msg)
+}
+
+func processChildSeatSelection(bot Sender, chatID int64, choice string) {
+	state := userStates[chatID]
+	if state.State != stateWaitingForChildSeat {
+		return
+	}
+	state.ChildSeat = choice == "yes"
+	userStates[chatID] = state
+	askAfterChildSeat(bot, chatID)
+}
+
+// Затем место, если площадка задала варианты, иначе сразу повод
+func askAfterChildSeat(bot Sender, chatID int64) {
+	state := userStates[chatID]
+	if len(cfg.SeatingOptions) == 0 {
+		state.State = stateWaitingForOccasion
+		userStates[chatID] = state
+		askForOccasion(bot, chatID)
+		return
+	}
+	state.State = stateWaitingForSeating
+	userStates[chatID] = state
+	askForSeating(bot, chatID)
+}
+
+func askForSeating(bot Sender, chatID int64) {
+	msg := tgbotapi.NewMessage(chatID, t(chatID, "ask_seating"))
+	var buttons [][]tgbotapi.InlineKeyboardButton
+	for i, option := range cfg.SeatingOptions {
+		buttons = append(buttons, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(option, fmt.Sprintf("seat_%d", i)),
+		))
+	}
+	buttons = append(buttons, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData(t(chatID, "btn_seat_any"), "seat_any"),
+	))
+	buttons = append(buttons, []tgbotapi.InlineKeyboardButton{
+		tgbotapi.NewInlineKeyboardButtonData(t(chatID, "btn_step_back"), "back"),
+		tgbotapi.NewInlineKeyboardButtonData(t(chatID, "btn_cancel"), "cancel"),
+	})
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(buttons...)
+	deliver(bot, chatID, "выбор места", msg)
+}
+
+func processSeatingSelection(bot Sender, chatID int64, choice string) {
+	state := userStates[chatID]
+	if state.State != stateWaitingForSeating {
+		return
+	}
+
+	state.Seating = ""
+	if i, err := strconv.Atoi(choice); err == nil && i >= 0 && i < len(cfg.SeatingOptions) {
+		state.Seating = cfg.SeatingOptions[i]
+	}
+	state.State = stateWaitingForOccasion
+	userStates[chatID] = state
+	askForOccasion(bot, chatID)
+}
+
+func askForOccasion(bot Sender, chatID int64) {
+	msg := tgbotapi.NewMessage(chatID, t(chatID, "ask_occasion"))
+	var buttons [][]tgbotapi.InlineKeyboardButton
+	for _, key := range occasionKeys {
+		buttons = append(buttons, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(t(chatID, "occasion_"+key), "occasion_"+key),
+		))
+	}
+	buttons = append(buttons, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData(t(chatID, "occasion_other"), "occasion_other"),
+		tgbotapi.NewInlineKeyboardButtonData(t(chatID, "btn_skip"), "occasion_skip"),
+	))
+	buttons = append(buttons, []tgbotapi.InlineKeyboardButton{
+		tgbotapi.NewInlineKeyboardButtonData(t(chatID, "btn_step_back"), "back"),
+		tgbotapi.NewInlineKeyboardButtonData(t(chatID, "btn_cancel"), "cancel"),
+	})
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(buttons...)
+	deliver(bot, chatID, "выбор повода", msg)
+}
+
+func processOccasionSelection(bot Sender, chatID int64, choice string) {
+	state := userStates[chatID]
+	if state.State != stateWaitingForOccasion {
+		return
+	}
+
+	switch {
+	case choice == "other":
+		state.State = stateWaitingForOccasionText
+		userStates[chatID] = state
+		sendPrompt(bot, chatID, t(chatID, "ask_own_occasion"))
+		return
+	case isOccasionKey(choice):
+		state.Occasion = choice
+	default:
+		state.Occasion = ""
+	}
+	state.State = stateWaitingForComment
+	userStates[chatID] = state
+	askForComment(bot, chatID)
 }
 
-func askForName(bot *tgbotapi.BotAPI, chatID int64) {
-	sendMessage(bot, chatID, "Пожалуйста, введите ваше имя:", true)
-	userStates[chatID] = UserState{State: stateWaitingForName}
+func isOccasionKey(value string) bool {
+	for _, key := range occasionKeys {
+		if key == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Для готовых вариантов храним ключ, свой вариант гостя — как есть
+func occasionTitle(lang, occasion string) string {
+	if isOccasionKey(occasion) {
+		return tr(lang, "occasion_"+occasion)
+	}
+	return occasion
 }
 
-func askForPhone(bot *tgbotapi.BotAPI, chatID int64) {
-	msg := tgbotapi.NewMessage(chatID, "Как вы хотите предоставить номер телефона?")
+func askForPhone(bot Sender, chatID int64) {
+	msg := tgbotapi.NewMessage(chatID, t(chatID, "ask_phone_method"))
 	buttons := [][]tgbotapi.InlineKeyboardButton{
-		{tgbotapi.NewInlineKeyboardButtonData("📲 Поделиться контактом", "phone_contact")},
-		{tgbotapi.NewInlineKeyboardButtonData("⌨ Ввести вручную", "phone_manual")},
-		{tgbotapi.NewInlineKeyboardButtonData("❌ Отмена", "cancel")},
+		{tgbotapi.NewInlineKeyboardButtonData(t(chatID, "btn_share_contact"), "phone_contact")},
+		{tgbotapi.NewInlineKeyboardButtonData(t(chatID, "btn_phone_manual"), "phone_manual")},
+		{
+			tgbotapi.NewInlineKeyboardButtonData(t(chatID, "btn_step_back"), "back"),
+			tgbotapi.NewInlineKeyboardButtonData(t(chatID, "btn_cancel"), "cancel"),
+		},
 	}
 	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(buttons...)
-	bot.Send(msg)
+	deliver(bot, chatID, "запрос телефона", msg)
 }
 
-func askForDate(bot *tgbotapi.BotAPI, chatID int64) {
-	msg := tgbotapi.NewMessage(chatID, "Выберите дату бронирования:")
+func askForDate(bot Sender, chatID int64) {
+	msg := tgbotapi.NewMessage(chatID, t(chatID, "ask_date"))
 	var buttons [][]tgbotapi.InlineKeyboardButton
 	var row []tgbotapi.InlineKeyboardButton
 
-	today := time.Now().In(loc)
-	for i := 0; i < 10; i++ {
+	today := clock.Now()
+	for i := 0; i < bookingDays; i++ {
 		date := today.AddDate(0, 0, i)
+		if isClosedDate(date) {
+			continue
+		}
 		dateStr := date.Format("02.01.2006")
 		row = append(row, tgbotapi.NewInlineKeyboardButtonData(dateStr, "date_"+dateStr))
-		if len(row) == 4 || i == 9 {
+		if len(row) == 4 {
 			buttons = append(buttons, row)
 			row = []tgbotapi.InlineKeyboardButton{}
 		}
 	}
+	if len(row) > 0 {
+		buttons = append(buttons, row)
+	}
 
 	buttons = append(buttons, []tgbotapi.InlineKeyboardButton{
-		tgbotapi.NewInlineKeyboardButtonData("❌ Отмена", "cancel"),
+		tgbotapi.NewInlineKeyboardButtonData(t(chatID, "btn_step_back"), "back"),
+		tgbotapi.NewInlineKeyboardButtonData(t(chatID, "btn_cancel"), "cancel"),
 	})
 
 	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(buttons...)
-	bot.Send(msg)
+	deliver(bot, chatID, "выбор даты", msg)
 }
 
-func askForTime(bot *tgbotapi.BotAPI, chatID int64) {
-	msg := tgbotapi.NewMessage(chatID, "Выберите время бронирования:")
+func askForTime(bot Sender, chatID int64) {
+	msg := tgbotapi.NewMessage(chatID, t(chatID, "ask_time"))
 	var buttons [][]tgbotapi.InlineKeyboardButton
 	var row []tgbotapi.InlineKeyboardButton
 
-	now := time.Now().In(loc)
-	selectedDate := userStates[chatID].Date
-
-	minBookingTime := now.Add(time.Hour * minBookingHours)
-	minHour := minBookingTime.Hour()
-	minMinute := minBookingTime.Minute()
+	now := clock.Now()
+	state := userStates[chatID]
+	venue := stateVenue(state)
+	selectedDate, guests, excludeID := state.Date, state.Guests, ""
+	if state.State == stateEditingReservationTime && state.TempReservation != nil {
+		selectedDate, guests, excludeID = state.TempReservation.Date, state.TempReservation.Guests, state.TempReservation.ID
+	}
+	booked := dateSlotGuests(venue.ID, selectedDate, excludeID)
 
-	count := 0
-	for hour := 16; hour <= 23; hour++ {
-		for minute := 0; minute <= 30; minute += 30 {
-			if selectedDate == now.Format("02.01.2006") {
-				if hour < minHour || (hour == minHour && minute < minMinute) {
-					continue
-				}
+	for _, minutes := range slotGrid(venue.hoursOnDate(selectedDate)) {
+		timeStr := clockTitle(minutes)
+		if validateBookingTime(userLang(chatID), venue, selectedDate, timeStr, now) != nil {
+			continue
+		}
+		label := timeStr
+		if venue.MaxGuestsPerSlot > 0 {
+			left := max(venue.MaxGuestsPerSlot-booked[timeStr], 0)
+			if cfg.HideFullSlots && left < guests {
+				continue
 			}
-			timeStr := fmt.Sprintf("%02d:%02d", hour, minute)
-			row = append(row, tgbotapi.NewInlineKeyboardButtonData(timeStr, "time_"+timeStr))
-			count++
-			if count%4 == 0 || (hour == 23 && minute == 30) {
-				buttons = append(buttons, row)
-				row = []tgbotapi.InlineKeyboardButton{}
+			if !cfg.HideFullSlots {
+				label = t(chatID, "slot_seats_left", timeStr, seatsLabel(userLang(chatID), left))
 			}
 		}
+		row = append(row, tgbotapi.NewInlineKeyboardButtonData(label, "time_"+timeStr))
+		if len(row) == 4 {
+			buttons = append(buttons, row)
+			row = []tgbotapi.InlineKeyboardButton{}
+		}
+	}
+	if len(row) > 0 {
+		buttons = append(buttons, row)
+	}
+
+	// Поздно вечером на сегодня, или все слоты заняты: без кнопок гость
+	// видел бы одну «Отмену», поэтому сразу предлагаем другую дату
+	if len(buttons) == 0 {
+		text := t(chatID, "no_slots_date", selectedDate)
+		if selectedDate == now.Format("02.01.2006") {
+			text = t(chatID, "no_slots_today")
+		}
+		pickDate := "back"
+		if state.State == stateEditingReservationTime {
+			pickDate = "edit_change_date"
+		}
+		empty := tgbotapi.NewMessage(chatID, text)
+		empty.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+			tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(t(chatID, "btn_pick_date"), pickDate)),
+			tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(t(chatID, "btn_cancel"), "cancel")),
+		)
+		deliver(bot, chatID, "нет свободных слотов", empty)
+		return
 	}
 
 	buttons = append(buttons, []tgbotapi.InlineKeyboardButton{
-		tgbotapi.NewInlineKeyboardButtonData("❌ Отмена", "cancel"),
+		tgbotapi.NewInlineKeyboardButtonData(t(chatID, "btn_other_time"), "time_manual"),
+	})
+	buttons = append(buttons, []tgbotapi.InlineKeyboardButton{
+		tgbotapi.NewInlineKeyboardButtonData(t(chatID, "btn_step_back"), "back"),
+		tgbotapi.NewInlineKeyboardButtonData(t(chatID, "btn_cancel"), "cancel"),
 	})
 
 	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(buttons...)
-	bot.Send(msg)
+	deliver(bot, chatID, "выбор времени", msg)
+}
+
+// Сетка времени брони: от открытия до последней брони с шагом slotMinutes.
+// По ней askForTime строит кнопки, а validateBookingTime проверяет ручной ввод
+func slotGrid(hours hoursRange) []int {
+	var grid []int
+	for minutes := hours.Open; minutes <= hours.LastBooking; minutes += slotMinutes {
+		grid = append(grid, minutes)
+	}
+	return grid
+}
+
+func onSlotGrid(hours hoursRange, minutes int) bool {
+	return minutes >= hours.Open && minutes <= hours.LastBooking && (minutes-hours.Open)%slotMinutes == 0
+}
+
+// Ближайшие к minutes время сетки раньше и позже; на краях сетки — одно
+func nearestSlots(hours hoursRange, minutes int) []int {
+	var before, after []int
+	for _, slot := range slotGrid(hours) {
+		if slot <= minutes {
+			before = []int{slot}
+		} else if after == nil {
+			after = []int{slot}
+		}
+	}
+	return append(before, after...)
+}
+
+func clockTitle(minutes int) string {
+	return fmt.Sprintf("%02d:%02d", minutes/60, minutes%60)
+}
+
+// Время, которое askForTime мог показать кнопкой в этот день
+func offeredSlot(venue Venue, date, timeStr string) bool {
+	t, err := time.ParseInLocation("15:04", timeStr, loc)
+	if err != nil {
+		return false
+	}
+	return onSlotGrid(venue.hoursOnDate(date), t.Hour()*60+t.Minute())
+}
+
+// Время, введенное вручную. При TIME_GRID=snap время вне сетки округляется
+// до ближайшего слота (при равенстве — к более раннему), иначе validateBookingTime
+// отклонит его и подскажет соседние слоты
+func manualBookingTime(bot Sender, chatID int64, venue Venue, date, input string) (string, error) {
+	timeStr := strings.TrimSpace(input)
+	if cfg.SnapToGrid {
+		if parsed, err := time.ParseInLocation("15:04", timeStr, loc); err == nil {
+			hours := venue.hoursOnDate(date)
+			minutes := parsed.Hour()*60 + parsed.Minute()
+			if minutes >= hours.Open && minutes <= hours.LastBooking && !onSlotGrid(hours, minutes) {
+				nearest := nearestSlots(hours, minutes)
+				snapped := nearest[0]
+				if len(nearest) > 1 && nearest[1]-minutes < minutes-nearest[0] {
+					snapped = nearest[1]
+				}
+				if err := validateBookingTime(userLang(chatID), venue, date, clockTitle(snapped), clock.Now()); err != nil {
+					return "", err
+				}
+				sendMessage(bot, chatID, t(chatID, "time_snapped", timeStr, clockTitle(snapped)), false)
+				return clockTitle(snapped), nil
+			}
+		}
+	}
+	if err := validateBookingTime(userLang(chatID), venue, date, timeStr, clock.Now()); err != nil {
+		return "", err
+	}
+	return timeStr, nil
+}
+
+// Общая проверка времени для кнопок и ручного ввода
+func validateBookingTime(lang string, venue Venue, date, timeStr string, now time.Time) error {
+	t, err := time.ParseInLocation("15:04", timeStr, loc)
+	if err != nil {
+		return errors.New(tr(lang, "time_format"))
+	}
+
+	reservationTime, err := time.ParseInLocation("02.01.2006 15:04", date+" "+timeStr, loc)
+	if err != nil {
+		return errors.New(tr(lang, "time_bad_date"))
+	}
+
+	hours := venue.hoursOn(reservationTime.Weekday())
+	minutes := t.Hour()*60 + t.Minute()
+	if minutes < hours.Open || minutes > hours.LastBooking {
+		return errors.New(tr(lang, "time_hours",
+			hours.Open/60, hours.Open%60, hours.LastBooking/60, hours.LastBooking%60))
+	}
+	// Та же сетка, по которой askForTime строит кнопки
+	if !onSlotGrid(hours, minutes) {
+		var nearest []string
+		for _, slot := range nearestSlots(hours, minutes) {
+			nearest = append(nearest, clockTitle(slot))
+		}
+		return errors.New(tr(lang, "time_grid", slotMinutes, strings.Join(nearest, ", ")))
+	}
+
+	if reservationTime.Before(now.Add(cfg.MinBookingLead)) {
+		return errors.New(tr(lang, "time_min_lead", durationTitle(lang, cfg.MinBookingLead)))
+	}
+	return nil
 }
 
-func askForComment(bot *tgbotapi.BotAPI, chatID int64) {
-	msg := tgbotapi.NewMessage(chatID, "Укажите ваши пожелания или комментарий к брони:")
+func askForComment(bot Sender, chatID int64) {
+	msg := tgbotapi.NewMessage(chatID, t(chatID, "ask_comment"))
 	msg.ReplyMarkup = tgbotapi.NewReplyKeyboard(
 		tgbotapi.NewKeyboardButtonRow(
-			tgbotapi.NewKeyboardButton("Пропустить"),
+			tgbotapi.NewKeyboardButton(t(chatID, "btn_step_back")),
+			tgbotapi.NewKeyboardButton(t(chatID, "btn_skip")),
 		),
 	)
-	bot.Send(msg)
+	deliver(bot, chatID, "запрос комментария", msg)
 }
 
-func showUserReservations(bot *tgbotapi.BotAPI, chatID int64) {
+func showUserReservations(bot Sender, chatID int64) {
 	userReservations := getUserActiveReservations(chatID)
 
 	if len(userReservations) == 0 {
-		sendMessage(bot, chatID, "У вас нет активных бронирований.", false)
+		sendMessage(bot, chatID, t(chatID, "no_bookings"), false)
 		showMainMenu(bot, chatID, false)
 		return
 	}
 
-	for _, r := range userReservations {
-		msgText := fmt.Sprintf(
-			"Бронь #%s\n\nИмя: %s\nТелефон: %s\nГостей: %d\nДата: %s\nВремя: %s",
-			r.ID, r.Name, r.Phone, r.Guests, r.Date, r.Time)
-
-		if r.Comment != "" && r.Comment != "-" {
-			msgText += fmt.Sprintf("\nКомментарий: %s", r.Comment)
-		}
-
-		msg := tgbotapi.NewMessage(chatID, msgText)
-		buttons := tgbotapi.NewInlineKeyboardMarkup(
-			tgbotapi.NewInlineKeyboardRow(
-				tgbotapi.NewInlineKeyboardButtonData("Редактировать", "edit_select_"+r.ID),
-				tgbotapi.NewInlineKeyboardButtonData("Удалить", "edit_delete_"+r.ID),
-			),
-		)
-		msg.ReplyMarkup = buttons
-		bot.Send(msg)
-	}
+	showUserReservationsPage(bot, chatID, 0, 0)
 
 	msg := tgbotapi.NewMessage(chatID, "")
 	msg.ReplyMarkup = tgbotapi.NewReplyKeyboard(
 		tgbotapi.NewKeyboardButtonRow(
-			tgbotapi.NewKeyboardButton("Назад"),
-			tgbotapi.NewKeyboardButton("Забронировать стол"),
+			tgbotapi.NewKeyboardButton(t(chatID, "btn_menu_back")),
+			tgbotapi.NewKeyboardButton(t(chatID, "btn_book")),
 		),
 		tgbotapi.NewKeyboardButtonRow(
-			tgbotapi.NewKeyboardButton("Связаться с нами"),
+			tgbotapi.NewKeyboardButton(t(chatID, "btn_contact")),
 		),
 	)
-	bot.Send(msg)
+	deliver(bot, chatID, "список броней", msg)
+}
+
+func showUserReservationsPage(bot Sender, chatID int64, messageID int, page int) {
+	userReservations := getUserActiveReservations(chatID)
+	if len(userReservations) == 0 {
+		sendPage(bot, chatID, messageID, t(chatID, "no_bookings"), nil)
+		return
+	}
+
+	sortReservationsByTime(userReservations)
+	start, end, page, pages := pageBounds(len(userReservations), page, userListPageSize)
+
+	var sb strings.Builder
+	var rows [][]tgbotapi.InlineKeyboardButton
+	sb.WriteString(t(chatID, "bookings_header", len(userReservations)))
+	if pages > 1 {
+		sb.WriteString(t(chatID, "page_of", page+1, pages))
+	}
+	sb.WriteString(":\n")
+
+	lastDate := ""
+	for _, r := range userReservations[start:end] {
+		if r.Date != lastDate {
+			lastDate = r.Date
+			header := "📅 " + r.Date
+			if day, err := time.ParseInLocation("02.01.2006", r.Date, loc); err == nil {
+				header += ", " + weekdayTitle(userLang(chatID), day.Weekday())
+			}
+			sb.WriteString("\n" + header + "\n")
+		}
+
+		sb.WriteString(t(chatID, "booking_item", r.Code, r.Name, formatPhone(r.Phone), r.Guests, r.Time))
+		if r.Comment != "" && r.Comment != "-" {
+			sb.WriteString(strings.TrimPrefix(t(chatID, "comment_line", r.Comment), "\n") + "\n")
+		}
+		if multiVenue() {
+			sb.WriteString(strings.TrimPrefix(t(chatID, "venue_line", venueByID(r.VenueID).Name), "\n") + "\n")
+		}
+
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("✏️ #"+r.Code, "edit_select_"+r.ID),
+			tgbotapi.NewInlineKeyboardButtonData("❌ #"+r.Code, "edit_delete_"+r.ID),
+		))
+	}
+	if nav := pageNavRow("my", "", page, pages); nav != nil {
+		rows = append(rows, nav)
+	}
+
+	sendPage(bot, chatID, messageID, sb.String(), rows)
+}
+
+// /booking <код>: гость видит свою активную бронь, администратор — любую бронь своего заведения
+func showBooking(bot Sender, chatID int64, ref string) {
+	ref = strings.TrimSpace(ref)
+	if ref == "" {
+		sendMessage(bot, chatID, t(chatID, "booking_usage"), false)
+		return
+	}
+	r, exists := findReservation(ref)
+	staff := isAdmin(chatID) && exists && canSeeReservation(chatID, r)
+	if !staff && (!exists || r.ChatID != chatID || !r.Status.isActive()) {
+		slog.Info("Бронь по коду не найдена", "chatID", chatID, "ref", ref, "exists", exists)
+		sendMessage(bot, chatID, t(chatID, "booking_missing", ref), false)
+		return
+	}
+	slog.Info("Просмотр брони по коду", "chatID", chatID, "reservationID", r.ID, "code", r.Code, "staff", staff)
+
+	var text string
+	var rows [][]tgbotapi.InlineKeyboardButton
+	if staff {
+		text = adminReservationCard(fmt.Sprintf("Бронь #%s [%s]", r.Code, statusTitles[r.Status]), r) +
+			fmt.Sprintf("\nСоздана: %s", r.CreatedAt.In(loc).Format("02.01.2006 15:04"))
+		if r.Feedback > 0 {
+			text += fmt.Sprintf("\nОценка: %d", r.Feedback)
+		}
+		if r.Status.isActive() {
+			rows = adminStatusKeyboard(r.ID).InlineKeyboard
+		}
+	} else {
+		text = "📅 " + r.Date + "\n" + strings.TrimPrefix(t(chatID, "booking_item", r.Code, r.Name, formatPhone(r.Phone), r.Guests, r.Time), "\n")
+		if r.Comment != "" && r.Comment != "-" {
+			text += strings.TrimPrefix(t(chatID, "comment_line", r.Comment), "\n") + "\n"
+		}
+		if multiVenue() {
+			text += strings.TrimPrefix(t(chatID, "venue_line", venueByID(r.VenueID).Name), "\n") + "\n"
+		}
+	}
+	if r.Status.isActive() {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("✏️ #"+r.Code, "edit_select_"+r.ID),
+			tgbotapi.NewInlineKeyboardButtonData("❌ #"+r.Code, "edit_delete_"+r.ID),
+		))
+	}
+
+	msg := tgbotapi.NewMessage(chatID, text)
+	if len(rows) > 0 {
+		msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
+	}
+	deliver(bot, chatID, "просмотр брони", msg)
+}
+
+// Активная бронь пользователя на тот же день и время, если есть
+func findDuplicateReservation(chatID int64, date, timeStr string) (Reservation, bool) {
+	for _, r := range getUserActiveReservations(chatID) {
+		if r.Date == date && r.Time == timeStr {
+			return r, true
+		}
+	}
+	return Reservation{}, false
+}
+
+// Гостей в слоте без учета брони excludeID (редактируемой)
+func slotGuests(venueID, date, timeStr, excludeID string) int {
+	return dateSlotGuests(venueID, date, excludeID)[timeStr]
+}
+
+// Гостей по всем слотам дня за один проход, для экрана выбора времени
+func dateSlotGuests(venueID, date, excludeID string) map[string]int {
+	venueID = venueByID(venueID).ID
+	totals := make(map[string]int)
+	for _, r := range reservations {
+		if r.ID != excludeID && r.Status.isActive() && r.Date == date && venueByID(r.VenueID).ID == venueID {
+			totals[r.Time] += r.Guests
+		}
+	}
+	return totals
+}
+
+func checkSlotCapacity(lang string, r Reservation) error {
+	limit := venueByID(r.VenueID).MaxGuestsPerSlot
+	if limit <= 0 {
+		return nil
+	}
+	if slotGuests(r.VenueID, r.Date, r.Time, r.ID)+r.Guests > limit {
+		return errors.New(tr(lang, "slot_full", r.Date, r.Time))
+	}
+	return nil
+}
+
+func sendDuplicateWarning(bot Sender, chatID int64, existing Reservation) {
+	msg := tgbotapi.NewMessage(chatID, t(chatID, "duplicate", existing.Code, existing.Date, existing.Time))
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(t(chatID, "btn_my_bookings"), "my_bookings"),
+		),
+	)
+	deliver(bot, chatID, "предупреждение о дубле", msg)
 }
 
 func getUserActiveReservations(chatID int64) []Reservation {
 	var activeReservations []Reservation
-	now := time.Now().In(loc)
+	now := clock.Now()
 
 	for _, r := range reservations {
-		if r.ChatID == chatID && r.Confirmed {
-			reservationTime, err := time.ParseInLocation("02.01.2006 15:04", r.Date+" "+r.Time, loc)
-			if err != nil {
-				continue
-			}
-
-			if now.Before(reservationTime.Add(reservationTTL)) {
+		if r.ChatID == chatID && r.Status.isActive() {
+			if upcoming, _ := isUpcoming(r, now); upcoming {
 				activeReservations = append(activeReservations, r)
 			}
 		}
@@ -683,35 +1982,331 @@ func getUserActiveReservations(chatID int64) []Reservation {
 	return activeReservations
 }
 
+// Окно активности брони: от создания до времени визита плюс ReservationTTL (не включая
+// границу). Верхней границы нет: дальние брони отсекаются при создании (bookingDays).
+// Этим же окном пользуются кнопка «Моя бронь» и фоновая очистка, чтобы они не расходились.
+// ok=false, если дату или время брони не удалось разобрать
+func isUpcoming(r Reservation, now time.Time) (upcoming, ok bool) {
+	reservationTime, err := reservationDateTime(r)
+	if err != nil {
+		return false, false
+	}
+	return now.Before(reservationTime.Add(cfg.ReservationTTL)), true
+}
+
+// Случайный идентификатор брони; старые ID вида chatID-nano остаются валидными
+func newReservationID() string {
+	for {
+		buf := make([]byte, 8)
+		if _, err := rand.Read(buf); err != nil {
+			log.Panicf("Ошибка генерации ID брони: %v", err)
+		}
+		id := hex.EncodeToString(buf)
+		if _, exists := reservations[id]; !exists {
+			return id
+		}
+	}
+}
+
+// Алфавит без похожих символов (0/O, 1/I), чтобы код было удобно диктовать
+const shortCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+// Короткий код брони для персонала, вычисляется из ID
+func shortCode(id string) string {
+	h := fnv.New32a()
+	h.Write([]byte(id))
+	sum := h.Sum32()
+
+	code := make([]byte, 4)
+	for i := range code {
+		code[i] = shortCodeAlphabet[sum%uint32(len(shortCodeAlphabet))]
+		sum /= uint32(len(shortCodeAlphabet))
+	}
+	return string(code)
+}
+
+// Уникальный короткий код: при совпадении перебираем производные от ID
+func assignShortCode(id string) string {
+	code := shortCode(id)
+	for i := 1; ; i++ {
+		if ownerID, taken := reservationCodes[code]; !taken || ownerID == id {
+			return code
+		}
+		code = shortCode(fmt.Sprintf("%s#%d", id, i))
+	}
+}
+
+// Ищет бронь по внутреннему ID или короткому коду
+func findReservation(ref string) (Reservation, bool) {
+	if reservation, exists := reservations[ref]; exists {
+		return reservation, true
+	}
+	if id, exists := reservationCodes[strings.ToUpper(strings.TrimPrefix(ref, "#"))]; exists {
+		reservation, exists := reservations[id]
+		return reservation, exists
+	}
+	return Reservation{}, false
+}
+
+// Сортирует брони по дате и времени; записи с некорректной датой уходят в конец
+func sortReservationsByTime(list []Reservation) {
+	times := make(map[string]time.Time, len(list))
+	for _, r := range list {
+		t, err := reservationDateTime(r)
+		if err != nil {
+			slog.Warn("Некорректные дата/время в брони", "reservationID", r.ID, "err", err)
+			continue
+		}
+		times[r.ID] = t
+	}
+
+	sort.SliceStable(list, func(i, j int) bool {
+		ti, okI := times[list[i].ID]
+		tj, okJ := times[list[j].ID]
+		if okI != okJ {
+			return okI
+		}
+		return ti.Before(tj)
+	})
+}
+
+func reservationDateTime(r Reservation) (time.Time, error) {
+	return time.ParseInLocation("02.01.2006 15:04", r.Date+" "+r.Time, loc)
+}
+
 func hasActiveReservations(chatID int64) bool {
-	now := time.Now().In(loc)
-	for _, r := range reservations {
-		if r.ChatID == chatID && r.Confirmed {
-			reservationTime, err := time.ParseInLocation("02.01.2006 15:04", r.Date+" "+r.Time, loc)
-			if err != nil {
-				continue
-			}
+	return len(getUserActiveReservations(chatID)) > 0
+}
 
-			if now.Before(reservationTime.Add(reservationTTL)) {
-				return true
-			}
+// Имя попадает в уведомления персоналу, поэтому отсекаем явный мусор: цифры, ссылки, управляющие символы
+func parseName(lang, text string) (string, error) {
+	name := strings.Join(strings.Fields(text), " ")
+	if utf8.RuneCountInString(name) < 2 {
+		return "", errors.New(tr(lang, "name_too_short"))
+	}
+	if utf8.RuneCountInString(name) > maxNameLength {
+		return "", errors.New(tr(lang, "name_too_long", maxNameLength))
+	}
+
+	hasLetter := false
+	for _, r := range name {
+		if unicode.IsControl(r) {
+			return "", errors.New(tr(lang, "name_invalid"))
+		}
+		if unicode.IsLetter(r) {
+			hasLetter = true
 		}
 	}
-	return false
+	lower := strings.ToLower(name)
+	if !hasLetter || strings.Contains(lower, "://") || strings.HasPrefix(lower, "www.") {
+		return "", errors.New(tr(lang, "name_invalid"))
+	}
+	return name, nil
+}
+
+// Переносы строк оставляем, остальные управляющие символы выкидываем
+func parseComment(lang, text string) (string, error) {
+	comment := strings.TrimSpace(strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) && r != '\n' {
+			return -1
+		}
+		return r
+	}, text))
+	if comment == "" {
+		return "-", nil
+	}
+	if utf8.RuneCountInString(comment) > cfg.MaxCommentLength {
+		return "", errors.New(tr(lang, "comment_too_long", cfg.MaxCommentLength))
+	}
+	return comment, nil
+}
+
+func parseGuests(lang, text string) (int, error) {
+	tooMany := errors.New(tr(lang, "guests_too_many", cfg.MaxGuests, cfg.ManagerPhone))
+
+	guests, err := strconv.Atoi(strings.TrimSpace(text))
+	if errors.Is(err, strconv.ErrRange) && !strings.HasPrefix(strings.TrimSpace(text), "-") {
+		return 0, tooMany
+	}
+	if err != nil || guests <= 0 {
+		return 0, errors.New(tr(lang, "guests_invalid"))
+	}
+	if guests < cfg.MinGuests {
+		return 0, errors.New(tr(lang, "guests_too_few", cfg.MinGuests))
+	}
+	if guests > cfg.MaxGuests {
+		return 0, tooMany
+	}
+	return guests, nil
+}
+
+// Дополнительные пожелания гостя для сообщений персоналу
+// Лимиты полей в уведомлениях администраторам; в файле брони значения хранятся целиком
+const (
+	adminNameLimit    = 100
+	adminCommentLimit = 500
+)
+
+// Поле, которое ввел гость, для сообщения администратору: переводы строк и управляющие
+// символы заменяются пробелами, чтобы имя не могло дописать в карточку фальшивые строки
+// вроде «Телефон: ...», а слишком длинное значение обрезается. Сообщения уходят без
+// ParseMode, поэтому разметку экранировать не нужно — при его включении это делается здесь
+func adminField(value string, limit int) string {
+	value = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || r == '\u2028' || r == '\u2029' {
+			return ' '
+		}
+		return r
+	}, value)
+	value = strings.TrimSpace(value)
+	if runes := []rune(value); len(runes) > limit {
+		value = strings.TrimSpace(string(runes[:limit-1])) + "…"
+	}
+	return value
+}
+
+// Карточка брони для уведомлений администраторам; все поля гостя проходят через adminField
+func adminReservationCard(title string, r Reservation) string {
+	card := fmt.Sprintf("%s\nИмя: %s\nТелефон: %s\nГостей: %d\nДата: %s\nВремя: %s",
+		title, adminField(r.Name, adminNameLimit), formatPhone(r.Phone), r.Guests, r.Date, r.Time)
+	if r.Comment != "" {
+		card += "\nКомментарий: " + adminField(r.Comment, adminCommentLimit)
+	}
+	return card + preferencesLines(r) + usernameLine(r)
+}
+
+func preferencesLines(r Reservation) string {
+	lines := venueLine(r)
+	if r.Table != "" {
+		lines += "\nСтол: №" + r.Table
+	}
+	if r.DepositPaid {
+		lines += "\nПредоплата внесена: " + formatMoney(r.DepositAmount, cfg.DepositCurrency)
+	} else if r.DepositAmount > 0 {
+		lines += "\nПредоплата не внесена: " + formatMoney(r.DepositAmount, cfg.DepositCurrency)
+	}
+	if r.SeatingPreference != "" {
+		lines += "\nМесто: " + r.SeatingPreference
+	}
+	if r.Occasion != "" {
+		lines += "\nПовод: " + adminField(occasionTitle(langRU, r.Occasion), adminNameLimit)
+	}
+	if r.Source != "" {
+		lines += "\nИсточник: " + r.Source
+	}
+	if r.NeedsChildSeat {
+		lines += "\nНужен детский стул"
+	}
+	if r.CreatedByStaff {
+		lines += "\nВнесена администратором"
+	}
+	return lines
+}
+
+func usernameLine(r Reservation) string {
+	if r.Username == "" {
+		return ""
+	}
+	return "\nTelegram: @" + r.Username
+}
+
+func formatPhone(raw string) string {
+	digits := nonDigits.ReplaceAllString(raw, "")
+	if len(digits) == 11 && (digits[0] == '7' || digits[0] == '8') {
+		return fmt.Sprintf("+7 (%s) %s-%s-%s", digits[1:4], digits[4:7], digits[7:9], digits[9:11])
+	}
+
+	number, err := phonenumbers.Parse("+"+digits, "")
+	if err != nil || !phonenumbers.IsValidNumber(number) {
+		return raw
+	}
+	return phonenumbers.Format(number, phonenumbers.INTERNATIONAL)
 }
 
-func normalizePhone(phone string) string {
-	re := regexp.MustCompile(`\D`)
-	return re.ReplaceAllString(phone, "")
+func normalizePhone(phone string) (string, error) {
+	phone = strings.TrimSpace(phone)
+	// Буквы libphonenumber переводит в цифры по кнопкам телефона, и опечатка
+	// превратилась бы в чужой номер
+	if strings.IndexFunc(phone, unicode.IsLetter) >= 0 {
+		return "", fmt.Errorf("некорректный номер телефона: %q", phone)
+	}
+
+	// Российские номера часто пишут через 8 вместо +7
+	digits := nonDigits.ReplaceAllString(phone, "")
+	if !strings.HasPrefix(phone, "+") && len(digits) == 11 && digits[0] == '8' {
+		phone = "+7" + digits[1:]
+	}
+
+	number, err := phonenumbers.Parse(phone, cfg.PhoneRegion)
+	if err != nil {
+		return "", err
+	}
+	if !phonenumbers.IsValidNumber(number) {
+		return "", fmt.Errorf("некорректный номер телефона: %q", phone)
+	}
+	return phonenumbers.Format(number, phonenumbers.E164), nil
 }
 
-func handleCallbackQuery(bot *tgbotapi.BotAPI, query *tgbotapi.CallbackQuery) {
+func handleCallbackQuery(bot Sender, query *tgbotapi.CallbackQuery) {
+	// Callback от inline-сообщений или очень старых кнопок может прийти без Message
+	if query.Message == nil {
+		slog.Warn("Callback без сообщения", "callbackID", query.ID, "data", query.Data, "inline", query.InlineMessageID)
+		if _, err := bot.Request(tgbotapi.NewCallback(query.ID, "")); err != nil {
+			slog.Error("Ошибка callback", "err", err)
+		}
+		return
+	}
+
 	chatID := query.Message.Chat.ID
 	data := query.Data
+	// Ответ на повтор все равно нужен, иначе у кнопки крутится индикатор загрузки
+	if isDuplicateCallback(chatID, data) {
+		slog.Debug("Повторное нажатие кнопки пропущено", "chatID", chatID, "data", data)
+		if _, err := bot.Request(tgbotapi.NewCallback(query.ID, "")); err != nil {
+			slog.Error("Ошибка callback", "err", err)
+		}
+		return
+	}
+	if allowed, _ := allowRequest(chatID); !allowed {
+		if _, err := bot.Request(tgbotapi.NewCallback(query.ID, t(chatID, "rate_limited"))); err != nil {
+			slog.Error("Ошибка callback", "err", err)
+		}
+		return
+	}
+
+	defer touchUserState(chatID)
+	rememberUsername(chatID, query.Message.Chat.UserName)
+	if query.From != nil {
+		rememberLang(chatID, query.From.LanguageCode)
+	}
 
 	callback := tgbotapi.NewCallback(query.ID, "")
 	if _, err := bot.Request(callback); err != nil {
-		log.Println("Ошибка callback:", err)
+		slog.Error("Ошибка callback", "err", err)
+	}
+	if refuseBlockedUser(bot, chatID) {
+		return
+	}
+	if !validCallbackData(data) {
+		slog.Warn("Отклонены некорректные данные кнопки", "chatID", chatID, "username", query.Message.Chat.UserName, "data", data)
+		return
+	}
+
+	if data == "time_manual" {
+		// Кнопка из старого списка времени: без выбранной даты вводить время некуда
+		state := userStates[chatID]
+		switch {
+		case state.State == stateEditingReservationTime && state.TempReservation != nil:
+		case state.State == stateWaitingForTime || state.State == stateWaitingForManualTime:
+			state.State = stateWaitingForManualTime
+			userStates[chatID] = state
+		default:
+			slog.Info("Устаревшая кнопка ввода времени", "chatID", chatID, "state", state.State)
+			sendMessage(bot, chatID, t(chatID, "button_outdated"), false)
+			return
+		}
+		sendPrompt(bot, chatID, t(chatID, "ask_manual_time"))
+		return
 	}
 
 	if strings.HasPrefix(data, "time_") {
@@ -726,6 +2321,74 @@ func handleCallbackQuery(bot *tgbotapi.BotAPI, query *tgbotapi.CallbackQuery) {
 		return
 	}
 
+	if data == "support_ask" {
+		askSupportQuestion(bot, chatID)
+		return
+	}
+
+	if strings.HasPrefix(data, "broadcast_") {
+		if isAdmin(chatID) {
+			handleBroadcastAction(bot, chatID, strings.TrimPrefix(data, "broadcast_"))
+		}
+		return
+	}
+
+	if strings.HasPrefix(data, "approve_") || strings.HasPrefix(data, "decline_") {
+		if isAdmin(chatID) {
+			handleApprovalCallback(bot, chatID, data)
+		}
+		return
+	}
+
+	if strings.HasPrefix(data, "table_") || strings.HasPrefix(data, "tableset_") {
+		if isAdmin(chatID) {
+			handleTableCallback(bot, chatID, data)
+		}
+		return
+	}
+
+	if strings.HasPrefix(data, "status_") {
+		if isAdmin(chatID) {
+			handleStatusAction(bot, chatID, strings.TrimPrefix(data, "status_"))
+		}
+		return
+	}
+
+	if strings.HasPrefix(data, "page_") {
+		handlePageAction(bot, chatID, query.Message.MessageID, strings.TrimPrefix(data, "page_"))
+		return
+	}
+
+	if strings.HasPrefix(data, "occasion_") {
+		processOccasionSelection(bot, chatID, strings.TrimPrefix(data, "occasion_"))
+		return
+	}
+
+	if strings.HasPrefix(data, "feedback_") {
+		processFeedback(bot, chatID, query.Message.MessageID, strings.TrimPrefix(data, "feedback_"))
+		return
+	}
+
+	if strings.HasPrefix(data, "venue_") {
+		processVenueSelection(bot, chatID, strings.TrimPrefix(data, "venue_"))
+		return
+	}
+
+	if strings.HasPrefix(data, "child_") {
+		processChildSeatSelection(bot, chatID, strings.TrimPrefix(data, "child_"))
+		return
+	}
+
+	if strings.HasPrefix(data, "seat_") {
+		processSeatingSelection(bot, chatID, strings.TrimPrefix(data, "seat_"))
+		return
+	}
+
+	if strings.HasPrefix(data, "lang_") {
+		setLanguage(bot, chatID, strings.TrimPrefix(data, "lang_"))
+		return
+	}
+
 	if strings.HasPrefix(data, "edit_") {
 		action := strings.TrimPrefix(data, "edit_")
 		handleEditAction(bot, chatID, action)
@@ -733,66 +2396,133 @@ func handleCallbackQuery(bot *tgbotapi.BotAPI, query *tgbotapi.CallbackQuery) {
 	}
 
 	switch data {
+	case "back":
+		goBack(bot, chatID)
+	case "booking_confirm":
+		confirmReservation(bot, chatID)
+	case "booking_edit":
+		sendMessage(bot, chatID, t(chatID, "refill"), true)
+		previous := userStates[chatID]
+		clearUserState(chatID)
+		state := userStates[chatID]
+		state.StaffBooking = previous.StaffBooking
+		state.VenueID = previous.VenueID
+		userStates[chatID] = state
+		startBooking(bot, chatID)
+	case "reuse_data":
+		reusePreviousData(bot, chatID)
 	case "phone_contact":
 		requestContact(bot, chatID)
 	case "phone_manual":
-		sendMessage(bot, chatID, "Пожалуйста, введите ваш номер телефона (11 цифр):", true)
-		userStates[chatID] = UserState{
-			State:           stateWaitingForManualPhone,
-			Name:            userStates[chatID].Name,
-			PhoneContact:    userStates[chatID].PhoneContact,
-			PhoneManual:     userStates[chatID].PhoneManual,
-			Guests:          userStates[chatID].Guests,
-			Date:            userStates[chatID].Date,
-			Comment:         userStates[chatID].Comment,
-			TempReservation: userStates[chatID].TempReservation,
-		}
+		askForManualPhone(bot, chatID)
 	case "cancel":
 		clearUserState(chatID)
 		showMainMenu(bot, chatID, hasActiveReservations(chatID))
+	case "my_bookings":
+		clearUserState(chatID)
+		showUserReservations(bot, chatID)
 	}
 }
 
-func requestContact(bot *tgbotapi.BotAPI, chatID int64) {
-	msg := tgbotapi.NewMessage(chatID, "Нажмите кнопку ниже, чтобы поделиться контактом:")
-	contactBtn := tgbotapi.NewKeyboardButtonContact("📲 Отправить мой контакт")
+func askForManualPhone(bot Sender, chatID int64) {
+	msg := tgbotapi.NewMessage(chatID, t(chatID, "ask_phone_manual"))
+	msg.ReplyMarkup = tgbotapi.NewReplyKeyboard(
+		tgbotapi.NewKeyboardButtonRow(tgbotapi.NewKeyboardButtonContact(t(chatID, "btn_send_contact"))),
+		tgbotapi.NewKeyboardButtonRow(tgbotapi.NewKeyboardButton(t(chatID, "btn_step_back"))),
+	)
+	deliver(bot, chatID, "запрос телефона", msg)
+	state := userStates[chatID]
+	state.State = stateWaitingForManualPhone
+	userStates[chatID] = state
+}
+
+func requestContact(bot Sender, chatID int64) {
+	msg := tgbotapi.NewMessage(chatID, t(chatID, "ask_contact"))
+	contactBtn := tgbotapi.NewKeyboardButtonContact(t(chatID, "btn_send_contact"))
 	keyboard := tgbotapi.NewReplyKeyboard(
 		tgbotapi.NewKeyboardButtonRow(contactBtn),
+		tgbotapi.NewKeyboardButtonRow(tgbotapi.NewKeyboardButton(t(chatID, "btn_step_back"))),
 	)
 	keyboard.OneTimeKeyboard = true
 	msg.ReplyMarkup = keyboard
-	bot.Send(msg)
-	userStates[chatID] = UserState{
-		State:           stateWaitingForPhone,
-		Name:            userStates[chatID].Name,
-		PhoneContact:    userStates[chatID].PhoneContact,
-		PhoneManual:     userStates[chatID].PhoneManual,
-		Guests:          userStates[chatID].Guests,
-		Date:            userStates[chatID].Date,
-		Comment:         userStates[chatID].Comment,
-		TempReservation: userStates[chatID].TempReservation,
-	}
+	deliver(bot, chatID, "запрос контакта", msg)
+	state := userStates[chatID]
+	state.State = stateWaitingForPhone
+	userStates[chatID] = state
 }
 
-func processDateSelection(bot *tgbotapi.BotAPI, chatID int64, selectedDate string) {
+func processDateSelection(bot Sender, chatID int64, selectedDate string) {
 	state := userStates[chatID]
+
+	parsedDate, err := time.ParseInLocation("02.01.2006", selectedDate, loc)
+	if err != nil {
+		return
+	}
+	if isClosedDate(parsedDate) {
+		sendMessage(bot, chatID, t(chatID, "date_closed"), false)
+		askForDate(bot, chatID)
+		return
+	}
+	if state.State == stateEditingReservationDate && state.TempReservation != nil {
+		state.TempReservation.Date = selectedDate
+		state.State = stateEditingReservationTime
+		userStates[chatID] = state
+		askForTime(bot, chatID)
+		return
+	}
 	state.Date = selectedDate
 	state.State = stateWaitingForTime
 	userStates[chatID] = state
 	askForTime(bot, chatID)
 }
 
-func processTimeSelection(bot *tgbotapi.BotAPI, chatID int64, selectedTime string) {
+func processTimeSelection(bot Sender, chatID int64, selectedTime string) {
 	state := userStates[chatID]
 
+	// Кнопки времени могли устареть, пока пользователь думал
+	date := state.Date
+	if state.State == stateEditingReservationTime && state.TempReservation != nil {
+		date = state.TempReservation.Date
+	}
+	if err := validateBookingTime(userLang(chatID), stateVenue(state), date, selectedTime, clock.Now()); err != nil {
+		// Устаревшая кнопка упирается только в срок брони; время вне сетки
+		// и часов работы кнопками не предлагалось
+		if !offeredSlot(stateVenue(state), date, selectedTime) {
+			slog.Warn("Время брони вне часов работы, данные кнопки подделаны", "chatID", chatID,
+				"username", state.Username, "date", date, "time", selectedTime)
+		}
+		sendMessage(bot, chatID, err.Error(), false)
+		askForTime(bot, chatID)
+		return
+	}
+
+	if state.State == stateEditingReservationTime && state.TempReservation != nil {
+		state.TempReservation.Time = selectedTime
+		userStates[chatID] = state
+		showEditOptions(bot, chatID, *state.TempReservation)
+		return
+	}
+
+	// Администратор может вносить несколько гостей на одно время
+	if existing, found := findDuplicateReservation(chatID, state.Date, selectedTime); found && !state.StaffBooking {
+		sendDuplicateWarning(bot, chatID, existing)
+		askForTime(bot, chatID)
+		return
+	}
+	if err := checkSlotCapacity(userLang(chatID), Reservation{Date: state.Date, Time: selectedTime, Guests: state.Guests, VenueID: state.VenueID}); err != nil {
+		sendMessage(bot, chatID, err.Error(), false)
+		askForTime(bot, chatID)
+		return
+	}
+
 	phone := state.PhoneContact
 	if phone == "" {
 		phone = state.PhoneManual
 	}
 
-	currentTime := time.Now().In(loc)
+	currentTime := clock.Now()
 	reservation := Reservation{
-		ID:        fmt.Sprintf("%d-%d", chatID, currentTime.UnixNano()),
+		ID:        newReservationID(),
 		ChatID:    chatID,
 		Name:      state.Name,
 		Phone:     phone,
@@ -800,85 +2530,217 @@ func processTimeSelection(bot *tgbotapi.BotAPI, chatID int64, selectedTime strin
 		Date:      state.Date,
 		Time:      selectedTime,
 		Comment:   state.Comment,
-		Confirmed: true,
+		Status:    statusConfirmed,
 		CreatedAt: currentTime,
+		Username:  state.Username,
+		Lang:      userLang(chatID),
+
+		SeatingPreference: state.Seating,
+		Occasion:          state.Occasion,
+		Source:            state.Source,
+		NeedsChildSeat:    state.ChildSeat,
+		VenueID:           state.VenueID,
+	}
+	if state.StaffBooking {
+		reservation.CreatedByStaff = true
+		reservation.Username = ""
+		reservation.Source = ""
+	}
+
+	state.State = stateConfirmingReservation
+	state.TempReservation = &reservation
+	userStates[chatID] = state
+
+	showReservationReview(bot, chatID, reservation)
+}
+
+func showReservationReview(bot Sender, chatID int64, reservation Reservation) {
+	reviewMsg := t(chatID, "review",
+		reservation.Name, formatPhone(reservation.Phone), reservation.Guests, reservation.Date, reservation.Time)
+
+	if multiVenue() {
+		reviewMsg += t(chatID, "venue_line", venueByID(reservation.VenueID).Name)
+	}
+	if reservation.Comment != "" && reservation.Comment != "-" {
+		reviewMsg += t(chatID, "comment_line", reservation.Comment)
+	}
+	if reservation.SeatingPreference != "" {
+		reviewMsg += t(chatID, "seating_line", reservation.SeatingPreference)
+	}
+	if reservation.Occasion != "" {
+		reviewMsg += t(chatID, "occasion_line", occasionTitle(userLang(chatID), reservation.Occasion))
+	}
+	if reservation.NeedsChildSeat {
+		reviewMsg += t(chatID, "child_seat_line")
+	}
+
+	msg := tgbotapi.NewMessage(chatID, reviewMsg)
+	buttons := [][]tgbotapi.InlineKeyboardButton{
+		{tgbotapi.NewInlineKeyboardButtonData(t(chatID, "btn_confirm"), "booking_confirm")},
+		{tgbotapi.NewInlineKeyboardButtonData(t(chatID, "btn_edit"), "booking_edit")},
+		{
+			tgbotapi.NewInlineKeyboardButtonData(t(chatID, "btn_step_back"), "back"),
+			tgbotapi.NewInlineKeyboardButtonData(t(chatID, "btn_cancel"), "cancel"),
+		},
+	}
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(buttons...)
+	deliver(bot, chatID, "проверка брони", msg)
+}
+
+func confirmReservation(bot Sender, chatID int64) {
+	state := userStates[chatID]
+	if state.State != stateConfirmingReservation || state.TempReservation == nil {
+		sendMessage(bot, chatID, t(chatID, "booking_error"), false)
+		clearUserState(chatID)
+		showMainMenu(bot, chatID, hasActiveReservations(chatID))
+		return
+	}
+
+	reservation := *state.TempReservation
+
+	// Номер мог быть заблокирован, пока гость заполнял бронь
+	if _, blocked := findBlock(0, reservation.Phone); blocked && !state.StaffBooking {
+		refuseBlockedUser(bot, chatID)
+		return
 	}
 
-	log.Printf("Создана новая бронь: ID=%s, Имя='%s', Телефон='%s'", reservation.ID, reservation.Name, reservation.Phone)
+	// Между выбором времени и подтверждением могло пройти много времени
+	if err := validateBookingTime(userLang(chatID), venueByID(reservation.VenueID), reservation.Date, reservation.Time, clock.Now()); err != nil {
+		sendMessage(bot, chatID, err.Error(), false)
+		state.State = stateWaitingForTime
+		state.TempReservation = nil
+		userStates[chatID] = state
+		askForTime(bot, chatID)
+		return
+	}
+
+	// Повторное нажатие подтверждения или такая же бронь из другого сообщения не должны создавать дубль
+	if existing, found := findDuplicateReservation(chatID, reservation.Date, reservation.Time); found && !reservation.CreatedByStaff {
+		clearUserState(chatID)
+		sendDuplicateWarning(bot, chatID, existing)
+		return
+	}
+	if err := checkSlotCapacity(userLang(chatID), reservation); err != nil {
+		sendMessage(bot, chatID, err.Error(), false)
+		state.State = stateWaitingForTime
+		state.TempReservation = nil
+		userStates[chatID] = state
+		askForTime(bot, chatID)
+		return
+	}
+
+	reservation.Code = assignShortCode(reservation.ID)
+	reservation.DepositAmount = depositFor(reservation)
+	if reservation.DepositAmount > 0 || needsApproval(reservation) {
+		reservation.Status = statusPending
+	}
+
+	// Сначала файл: бронь, которой нет на диске, пропала бы после перезапуска,
+	// поэтому гостю ее не подтверждаем
+	if err := saveReservationToFile(reservation); err != nil {
+		slog.Error("Бронь не сохранена", "chatID", chatID, "reservationID", reservation.ID, "err", err)
+		storageErrors.Inc()
+		clearUserState(chatID)
+		notifyAdmins(bot, reservation.VenueID, adminReservationCard("⚠️ Не удалось сохранить бронь, гостю отказано!", reservation)+
+			fmt.Sprintf("\nОшибка: %v", err))
+		sendMessage(bot, chatID, t(chatID, "save_failed", cfg.ManagerPhone), false)
+		showMainMenu(bot, chatID, hasActiveReservations(chatID))
+		return
+	}
+	slog.Info("Создана новая бронь", "chatID", chatID, "reservationID", reservation.ID, "code", reservation.Code, "name", reservation.Name, "phone", reservation.Phone)
 
 	reservations[reservation.ID] = reservation
-	saveReservationToFile(reservation)
+	reservationCodes[reservation.Code] = reservation.ID
+	if !reservation.CreatedByStaff {
+		rememberProfile(reservation)
+	}
+	bookingsCreated.Inc()
+	publishReservationEvent(eventCreated, reservation)
 
 	// Очищаем состояние пользователя после создания брони
 	clearUserState(chatID)
 
-	if adminChatID != 0 {
-		adminMsg := tgbotapi.NewMessage(adminChatID, fmt.Sprintf(
-			"Новая бронь #%s!\nИмя: %s\nТелефон: %s\nГостей: %d\nДата: %s\nВремя: %s\nКомментарий: %s",
-			reservation.ID, reservation.Name, reservation.Phone, reservation.Guests,
-			reservation.Date, reservation.Time, reservation.Comment))
-		bot.Send(adminMsg)
+	// Бронь с предоплатой подтверждается, а при необходимости уходит на одобрение, после оплаты
+	if reservation.DepositAmount > 0 {
+		notifyAdmins(bot, reservation.VenueID, adminReservationCard(fmt.Sprintf("💳 Новая бронь #%s ждет предоплаты", reservation.Code), reservation))
+		sendDepositInvoice(bot, chatID, reservation)
+		showMainMenu(bot, chatID, true)
+		return
 	}
 
-	confirmationMsg := fmt.Sprintf(
-		"✅ Бронь #%s успешна!\n\nДетали:\nИмя: %s\nТелефон: %s\nГостей: %d\nДата: %s\nВремя: %s",
-		reservation.ID, reservation.Name, reservation.Phone, reservation.Guests, reservation.Date, reservation.Time)
-
-	if reservation.Comment != "" && reservation.Comment != "-" {
-		confirmationMsg += fmt.Sprintf("\nКомментарий: %s", reservation.Comment)
+	if reservation.Status == statusPending {
+		sendToAdmins(bot, reservation.VenueID, adminReservationCard(fmt.Sprintf("🕓 Новая бронь #%s ждет подтверждения!", reservation.Code), reservation),
+			adminApprovalKeyboard(reservation.ID))
+		msg := tgbotapi.NewMessage(chatID, t(chatID, "pending",
+			reservation.Code, reservation.Name, formatPhone(reservation.Phone), reservation.Guests, reservation.Date, reservation.Time))
+		msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(t(chatID, "btn_edit_this"), "edit_select_"+reservation.ID),
+		))
+		deliver(bot, chatID, "бронь ждет подтверждения", msg)
+		showMainMenu(bot, chatID, true)
+		return
 	}
 
-	msg := tgbotapi.NewMessage(chatID, confirmationMsg)
-	msg.ReplyMarkup = tgbotapi.NewReplyKeyboard(
-		tgbotapi.NewKeyboardButtonRow(
-			tgbotapi.NewKeyboardButton("Моя бронь"),
-			tgbotapi.NewKeyboardButton("Забронировать стол"),
-		),
-		tgbotapi.NewKeyboardButtonRow(
-			tgbotapi.NewKeyboardButton("Связаться с нами"),
-		),
-	)
-	bot.Send(msg)
+	sendToAdmins(bot, reservation.VenueID, adminReservationCard(fmt.Sprintf("Новая бронь #%s!", reservation.Code), reservation),
+		adminStatusKeyboard(reservation.ID))
+
+	// Ошибку в брони чаще всего замечают сразу, поэтому правка — прямо под подтверждением
+	msg := tgbotapi.NewMessage(chatID, confirmationText(chatID, reservation))
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData(t(chatID, "btn_edit_this"), "edit_select_"+reservation.ID),
+	))
+	deliver(bot, chatID, "подтверждение брони", msg)
+
+	sendReservationICS(bot, chatID, reservation)
+	showMainMenu(bot, chatID, true)
 }
 
-func handleEditAction(bot *tgbotapi.BotAPI, chatID int64, action string) {
+func handleEditAction(bot Sender, chatID int64, action string) {
 	if strings.HasPrefix(action, "select_") {
-		reservationID := strings.TrimPrefix(action, "select_")
-		if reservation, exists := reservations[reservationID]; exists {
-			userStates[chatID] = UserState{
-				State:           stateEditingReservation,
-				Name:            reservation.Name,
-				PhoneContact:    reservation.Phone,
-				PhoneManual:     reservation.Phone,
-				Guests:          reservation.Guests,
-				Date:            reservation.Date,
-				Comment:         reservation.Comment,
-				TempReservation: &reservation,
-			}
-			showEditOptions(bot, chatID, reservation)
+		if reservation, exists := findOwnReservation(chatID, strings.TrimPrefix(action, "select_")); exists {
+			startEditing(bot, chatID, reservation)
 		}
 	} else if strings.HasPrefix(action, "delete_") {
-		reservationID := strings.TrimPrefix(action, "delete_")
-		if reservation, exists := reservations[reservationID]; exists {
-			delete(reservations, reservationID)
-			deleteReservationFromFile(reservationID)
-
-			if adminChatID != 0 {
-				adminMsg := tgbotapi.NewMessage(adminChatID, fmt.Sprintf(
-					"❌ Бронь #%s удалена!\nИмя: %s\nТелефон: %s\nГостей: %d\nДата: %s\nВремя: %s",
-					reservation.ID, reservation.Name, reservation.Phone, reservation.Guests,
-					reservation.Date, reservation.Time))
-				bot.Send(adminMsg)
+		if reservation, exists := findOwnReservation(chatID, strings.TrimPrefix(action, "delete_")); exists {
+			if refuseLateCancel(bot, chatID, reservation) {
+				return
+			}
+			askDeleteConfirmation(bot, chatID, reservation)
+		}
+	} else if strings.HasPrefix(action, "confirmdelete_") {
+		if reservation, exists := findOwnReservation(chatID, strings.TrimPrefix(action, "confirmdelete_")); exists {
+			// Кнопка подтверждения могла пролежать до самого дедлайна
+			if refuseLateCancel(bot, chatID, reservation) {
+				return
+			}
+			// Отмененную бронь оставляем в истории, чтобы отличать ее от состоявшегося визита
+			reservation.Status = statusCancelled
+			reservation.StatusChangedAt = clock.Now()
+			if err := updateReservationsInFile(reservation); err != nil {
+				slog.Error("Отмена брони не сохранена", "chatID", chatID, "reservationID", reservation.ID, "err", err)
+				storageErrors.Inc()
+				notifyAdmins(bot, reservation.VenueID, adminReservationCard(
+					fmt.Sprintf("⚠️ Не удалось отменить бронь #%s, она осталась активной", reservation.Code), reservation)+
+					fmt.Sprintf("\nОшибка: %v", err))
+				sendMessage(bot, chatID, t(chatID, "cancel_failed", cfg.ManagerPhone), false)
+				clearUserState(chatID)
+				showMainMenu(bot, chatID, hasActiveReservations(chatID))
+				return
 			}
+			reservations[reservation.ID] = reservation
+			bookingsCancelled.Inc()
+			publishReservationEvent(eventDeleted, reservation)
 
-			sendMessage(bot, chatID, fmt.Sprintf("Бронь #%s успешно удалена", reservationID), false)
+			notifyAdmins(bot, reservation.VenueID, adminReservationCard(fmt.Sprintf("❌ Бронь #%s удалена!", reservation.Code), reservation))
+
+			sendMessage(bot, chatID, t(chatID, "deleted", reservation.Code), false)
 			clearUserState(chatID)
 			showMainMenu(bot, chatID, hasActiveReservations(chatID))
 		}
 	} else {
 		state := userStates[chatID]
 		if state.TempReservation == nil {
-			sendMessage(bot, chatID, "Ошибка редактирования. Пожалуйста, начните заново.", false)
+			sendMessage(bot, chatID, t(chatID, "edit_error"), false)
 			clearUserState(chatID)
 			showMainMenu(bot, chatID, hasActiveReservations(chatID))
 			return
@@ -888,143 +2750,419 @@ func handleEditAction(bot *tgbotapi.BotAPI, chatID int64, action string) {
 
 		switch action {
 		case "change_name":
-			userStates[chatID] = UserState{
-				State:           stateEditingReservationName,
-				Name:            state.Name,
-				PhoneContact:    state.PhoneContact,
-				PhoneManual:     state.PhoneManual,
-				Guests:          state.Guests,
-				Date:            state.Date,
-				Comment:         state.Comment,
-				TempReservation: state.TempReservation,
-			}
-			sendMessage(bot, chatID, fmt.Sprintf("Текущее имя: %s. Введите новое имя:", currentReservation.Name), true)
+			state.State = stateEditingReservationName
+			userStates[chatID] = state
+			sendMessage(bot, chatID, t(chatID, "current_name", currentReservation.Name), true)
 			return
 		case "change_phone":
-			userStates[chatID] = UserState{
-				State:           stateEditingReservationPhone,
-				Name:            state.Name,
-				PhoneContact:    state.PhoneContact,
-				PhoneManual:     state.PhoneManual,
-				Guests:          state.Guests,
-				Date:            state.Date,
-				Comment:         state.Comment,
-				TempReservation: state.TempReservation,
-			}
-			sendMessage(bot, chatID, fmt.Sprintf("Текущий телефон: %s. Введите новый телефон:", currentReservation.Phone), true)
+			state.State = stateEditingReservationPhone
+			userStates[chatID] = state
+			sendMessage(bot, chatID, t(chatID, "current_phone", formatPhone(currentReservation.Phone)), true)
 			return
 		case "change_guests":
-			userStates[chatID] = UserState{
-				State:           stateEditingReservationGuests,
-				Name:            state.Name,
-				PhoneContact:    state.PhoneContact,
-				PhoneManual:     state.PhoneManual,
-				Guests:          state.Guests,
-				Date:            state.Date,
-				Comment:         state.Comment,
-				TempReservation: state.TempReservation,
-			}
-			sendMessage(bot, chatID, fmt.Sprintf("Текущее количество гостей: %d. Введите новое количество:", currentReservation.Guests), true)
+			state.State = stateEditingReservationGuests
+			userStates[chatID] = state
+			sendMessage(bot, chatID, t(chatID, "current_guests", currentReservation.Guests), true)
 			return
 		case "change_date":
-			userStates[chatID] = UserState{
-				State:           stateEditingReservationDate,
-				Name:            state.Name,
-				PhoneContact:    state.PhoneContact,
-				PhoneManual:     state.PhoneManual,
-				Guests:          state.Guests,
-				Date:            state.Date,
-				Comment:         state.Comment,
-				TempReservation: state.TempReservation,
-			}
+			state.State = stateEditingReservationDate
+			userStates[chatID] = state
 			askForDate(bot, chatID)
 			return
 		case "change_time":
-			userStates[chatID] = UserState{
-				State:           stateEditingReservationTime,
-				Name:            state.Name,
-				PhoneContact:    state.PhoneContact,
-				PhoneManual:     state.PhoneManual,
-				Guests:          state.Guests,
-				Date:            state.Date,
-				Comment:         state.Comment,
-				TempReservation: state.TempReservation,
-			}
+			state.State = stateEditingReservationTime
+			userStates[chatID] = state
 			askForTime(bot, chatID)
 			return
 		case "change_comment":
-			userStates[chatID] = UserState{
-				State:           stateEditingReservationComment,
-				Name:            state.Name,
-				PhoneContact:    state.PhoneContact,
-				PhoneManual:     state.PhoneManual,
-				Guests:          state.Guests,
-				Date:            state.Date,
-				Comment:         state.Comment,
-				TempReservation: state.TempReservation,
-			}
-			sendMessage(bot, chatID, fmt.Sprintf("Текущий комментарий: %s. Введите новый комментарий:", currentReservation.Comment), true)
+			state.State = stateEditingReservationComment
+			userStates[chatID] = state
+			sendMessage(bot, chatID, t(chatID, "current_comment", currentReservation.Comment), true)
 			return
 		case "confirm":
-			// Сохраняем обновленную бронь
+			// Пока шла правка, бронь могли подтвердить, оплатить, посадить за стол или отменить,
+			// поэтому на свежую версию переносим только поля, которые меняет редактор
+			original, exists := reservations[currentReservation.ID]
+			if !exists || !original.Status.isActive() {
+				slog.Info("Правка неактивной брони отклонена", "chatID", chatID, "reservationID", currentReservation.ID, "status", original.Status)
+				clearUserState(chatID)
+				sendMessage(bot, chatID, t(chatID, "edit_inactive", currentReservation.Code), false)
+				showMainMenu(bot, chatID, hasActiveReservations(chatID))
+				return
+			}
+			edited := currentReservation
+			currentReservation = original
+			currentReservation.Name = edited.Name
+			currentReservation.Phone = edited.Phone
+			currentReservation.Guests = edited.Guests
+			currentReservation.Date = edited.Date
+			currentReservation.Time = edited.Time
+			currentReservation.Comment = edited.Comment
+			moved := original.Date != currentReservation.Date || original.Time != currentReservation.Time
+			// После смены даты прежнее время может выпасть из часов работы нового дня
+			if moved {
+				if err := validateBookingTime(userLang(chatID), venueByID(currentReservation.VenueID),
+					currentReservation.Date, currentReservation.Time, clock.Now()); err != nil {
+					sendMessage(bot, chatID, err.Error(), false)
+					showEditOptions(bot, chatID, currentReservation)
+					return
+				}
+			}
+			// Новые дата и время могут попасть в уже заполненный слот
+			if err := checkSlotCapacity(userLang(chatID), currentReservation); err != nil {
+				sendMessage(bot, chatID, err.Error(), false)
+				showEditOptions(bot, chatID, currentReservation)
+				return
+			}
+
+			// Больше гостей или другой день могут потребовать предоплаты или решения
+			// администратора заново; правку администратора правила не касаются
+			if currentReservation.ChatID == chatID && currentReservation.Status != statusSeated &&
+				(original.Date != currentReservation.Date || original.Guests != currentReservation.Guests) {
+				if !currentReservation.DepositPaid {
+					currentReservation.DepositAmount = depositFor(currentReservation)
+				}
+				currentReservation.Status = statusConfirmed
+				if (currentReservation.DepositAmount > 0 && !currentReservation.DepositPaid) || needsApproval(currentReservation) {
+					currentReservation.Status = statusPending
+				}
+			}
+			// Новый счет: прежний выставлен на другую сумму или не выставлялся вовсе
+			invoice := currentReservation.DepositAmount > 0 && !currentReservation.DepositPaid &&
+				(currentReservation.DepositAmount != original.DepositAmount || original.Status != statusPending)
+			if currentReservation.Status != original.Status || invoice {
+				// От этого времени считается DEPOSIT_TIMEOUT
+				currentReservation.StatusChangedAt = clock.Now()
+			}
+
+			// После переноса визита напоминание нужно отправить заново
+			if moved {
+				currentReservation.ReminderSent = false
+				// Стол на новое время может быть уже отдан другой брони
+				if currentReservation.Table != "" {
+					if other, taken := tableConflict(currentReservation, currentReservation.Table); taken {
+						slog.Info("Стол снят с перенесенной брони", "reservationID", currentReservation.ID, "table", currentReservation.Table, "conflict", other.ID)
+						currentReservation.Table = ""
+					}
+				}
+			}
+
+			// Сохраняем обновленную бронь; если файл не записался, остается прежняя версия
+			if err := updateReservationsInFile(currentReservation); err != nil {
+				slog.Error("Изменения брони не сохранены", "chatID", chatID, "reservationID", currentReservation.ID, "err", err)
+				storageErrors.Inc()
+				clearUserState(chatID)
+				notifyAdmins(bot, currentReservation.VenueID, adminReservationCard(
+					fmt.Sprintf("⚠️ Не удалось сохранить изменения брони #%s, бронь осталась прежней", currentReservation.Code), currentReservation)+
+					fmt.Sprintf("\nОшибка: %v", err))
+				sendMessage(bot, chatID, t(chatID, "edit_failed", cfg.ManagerPhone), false)
+				showMainMenu(bot, chatID, hasActiveReservations(chatID))
+				return
+			}
 			reservations[currentReservation.ID] = currentReservation
-			updateReservationInFile(currentReservation)
+			bookingsEdited.Inc()
+			publishReservationEvent(eventUpdated, currentReservation)
+			if !currentReservation.CreatedByStaff {
+				rememberProfile(currentReservation)
+			}
 
 			// Очищаем состояние пользователя после редактирования
 			clearUserState(chatID)
 
-			if adminChatID != 0 {
-				adminMsg := tgbotapi.NewMessage(adminChatID, fmt.Sprintf(
-					"✏️ Бронь #%s отредактирована!\nИмя: %s\nТелефон: %s\nГостей: %d\nДата: %s\nВремя: %s\nКомментарий: %s",
-					currentReservation.ID, currentReservation.Name, currentReservation.Phone, currentReservation.Guests,
-					currentReservation.Date, currentReservation.Time, currentReservation.Comment))
-				bot.Send(adminMsg)
+			pending := currentReservation.Status == statusPending && original.Status != statusPending
+			switch {
+			case invoice:
+				notifyAdmins(bot, currentReservation.VenueID, adminReservationCard(
+					fmt.Sprintf("💳 Бронь #%s отредактирована и ждет предоплаты", currentReservation.Code), currentReservation))
+			case pending:
+				sendToAdmins(bot, currentReservation.VenueID, adminReservationCard(
+					fmt.Sprintf("🕓 Бронь #%s отредактирована и ждет подтверждения!", currentReservation.Code), currentReservation),
+					adminApprovalKeyboard(currentReservation.ID))
+			default:
+				notifyAdmins(bot, currentReservation.VenueID, adminReservationCard(
+					fmt.Sprintf("✏️ Бронь #%s отредактирована!", currentReservation.Code), currentReservation))
+			}
+
+			// Бронь, которую правил администратор, меняется у гостя без его участия
+			if currentReservation.ChatID != chatID && !currentReservation.CreatedByStaff {
+				r := currentReservation
+				sendMessage(bot, r.ChatID, tr(r.Lang, "edited_by_staff",
+					r.Code, r.Name, formatPhone(r.Phone), r.Guests, r.Date, r.Time), false)
 			}
 
-			sendMessage(bot, chatID, "✅ Изменения сохранены!", false)
+			sendMessage(bot, chatID, t(chatID, "changes_saved"), false)
+			r := currentReservation
+			switch {
+			case invoice:
+				sendDepositInvoice(bot, chatID, r)
+			case pending:
+				sendMessage(bot, chatID, t(chatID, "pending", r.Code, r.Name, formatPhone(r.Phone), r.Guests, r.Date, r.Time), false)
+			case original.Status == statusPending && r.Status == statusConfirmed:
+				deliver(bot, chatID, "подтверждение брони", tgbotapi.NewMessage(chatID, confirmationText(chatID, r)))
+			}
 			showMainMenu(bot, chatID, true)
 		}
 	}
 }
 
-func showEditOptions(bot *tgbotapi.BotAPI, chatID int64, reservation Reservation) {
-	msg := tgbotapi.NewMessage(chatID, fmt.Sprintf(
-		"Редактирование брони #%s:\n\nИмя: %s\nТелефон: %s\nГостей: %d\nДата: %s\nВремя: %s\nКомментарий: %s\n\nЧто хотите изменить?",
-		reservation.ID, reservation.Name, reservation.Phone, reservation.Guests, reservation.Date, reservation.Time, reservation.Comment))
+// Гость может менять только свои активные брони, администратор — любые активные
+func findOwnReservation(chatID int64, ref string) (Reservation, bool) {
+	reservation, exists := findReservation(ref)
+	if !exists || !reservation.Status.isActive() || (reservation.ChatID != chatID && !canSeeReservation(chatID, reservation)) {
+		return Reservation{}, false
+	}
+	return reservation, true
+}
+
+func startEditing(bot Sender, chatID int64, reservation Reservation) {
+	state := userStates[chatID]
+	state.State = stateEditingReservation
+	state.Name = reservation.Name
+	state.PhoneContact = reservation.Phone
+	state.PhoneManual = reservation.Phone
+	state.Guests = reservation.Guests
+	state.Date = reservation.Date
+	state.Comment = reservation.Comment
+	state.TempReservation = &reservation
+	userStates[chatID] = state
+	showEditOptions(bot, chatID, reservation)
+}
+
+// Незадолго до визита гость отменяет бронь только звонком; администратор — без ограничений
+func refuseLateCancel(bot Sender, chatID int64, reservation Reservation) bool {
+	if isAdmin(chatID) || !cancelDeadlinePassed(reservation, clock.Now()) {
+		return false
+	}
+	slog.Info("Отмена брони после дедлайна отклонена", "chatID", chatID, "reservationID", reservation.ID)
+	sendMessage(bot, chatID, t(chatID, "cancel_too_late", cfg.CancelDeadlineHours, cfg.ManagerPhone), false)
+	return true
+}
+
+// Дедлайн считается от времени визита в loc; ровно на границе отменять уже нельзя
+func cancelDeadlinePassed(r Reservation, now time.Time) bool {
+	if cfg.CancelDeadlineHours <= 0 {
+		return false
+	}
+	reservationTime, err := reservationDateTime(r)
+	if err != nil {
+		return false
+	}
+	return !now.Before(reservationTime.Add(-time.Duration(cfg.CancelDeadlineHours) * time.Hour))
+}
+
+// Имя и комментарий для экрана правки: чужую бронь открывает администратор, ему — через adminField
+func viewerFields(chatID int64, r Reservation) (string, string) {
+	if r.ChatID == chatID {
+		return r.Name, r.Comment
+	}
+	return adminField(r.Name, adminNameLimit), adminField(r.Comment, adminCommentLimit)
+}
+
+func askDeleteConfirmation(bot Sender, chatID int64, reservation Reservation) {
+	name, _ := viewerFields(chatID, reservation)
+	msg := tgbotapi.NewMessage(chatID, t(chatID, "delete_confirm",
+		reservation.Code, name, formatPhone(reservation.Phone), reservation.Guests, reservation.Date, reservation.Time))
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(t(chatID, "btn_yes_delete"), "edit_confirmdelete_"+reservation.ID),
+			tgbotapi.NewInlineKeyboardButtonData(t(chatID, "btn_no"), "cancel"),
+		),
+	)
+	deliver(bot, chatID, "подтверждение удаления", msg)
+}
+
+func showEditOptions(bot Sender, chatID int64, reservation Reservation) {
+	name, comment := viewerFields(chatID, reservation)
+	msg := tgbotapi.NewMessage(chatID, t(chatID, "edit_options",
+		reservation.Code, name, formatPhone(reservation.Phone), reservation.Guests, reservation.Date, reservation.Time, comment))
 
 	buttons := [][]tgbotapi.InlineKeyboardButton{
-		{tgbotapi.NewInlineKeyboardButtonData("Изменить имя", "edit_change_name")},
-		{tgbotapi.NewInlineKeyboardButtonData("Изменить телефон", "edit_change_phone")},
-		{tgbotapi.NewInlineKeyboardButtonData("Изменить количество гостей", "edit_change_guests")},
-		{tgbotapi.NewInlineKeyboardButtonData("Изменить дату", "edit_change_date")},
-		{tgbotapi.NewInlineKeyboardButtonData("Изменить время", "edit_change_time")},
-		{tgbotapi.NewInlineKeyboardButtonData("Изменить комментарий", "edit_change_comment")},
-		{tgbotapi.NewInlineKeyboardButtonData("✅ Подтвердить изменения", "edit_confirm")},
-		{tgbotapi.NewInlineKeyboardButtonData("❌ Отмена", "cancel")},
+		{tgbotapi.NewInlineKeyboardButtonData(t(chatID, "btn_change_name"), "edit_change_name")},
+		{tgbotapi.NewInlineKeyboardButtonData(t(chatID, "btn_change_phone"), "edit_change_phone")},
+		{tgbotapi.NewInlineKeyboardButtonData(t(chatID, "btn_change_guests"), "edit_change_guests")},
+		{tgbotapi.NewInlineKeyboardButtonData(t(chatID, "btn_change_date"), "edit_change_date")},
+		{tgbotapi.NewInlineKeyboardButtonData(t(chatID, "btn_change_time"), "edit_change_time")},
+		{tgbotapi.NewInlineKeyboardButtonData(t(chatID, "btn_change_comment"), "edit_change_comment")},
+		{tgbotapi.NewInlineKeyboardButtonData(t(chatID, "btn_confirm_changes"), "edit_confirm")},
+		{tgbotapi.NewInlineKeyboardButtonData(t(chatID, "btn_cancel"), "cancel")},
 	}
 
 	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(buttons...)
-	bot.Send(msg)
+	deliver(bot, chatID, "редактирование брони", msg)
 }
 
-func sendMessage(bot *tgbotapi.BotAPI, chatID int64, text string, hideKeyboard bool) {
+func sendMessage(bot Sender, chatID int64, text string, hideKeyboard bool) {
 	msg := tgbotapi.NewMessage(chatID, text)
 	if hideKeyboard {
 		msg.ReplyMarkup = tgbotapi.NewRemoveKeyboard(true)
 	}
-	bot.Send(msg)
+	deliver(bot, chatID, "сообщение", msg)
+}
+
+// csvColumns сопоставляет имя колонки с ее позицией в файле, чтобы порядок
+// и количество колонок могли меняться без поломки старых файлов
+type csvColumns map[string]int
+
+func newCSVColumns(header []string) csvColumns {
+	columns := make(csvColumns, len(header))
+	for i, name := range header {
+		columns[strings.TrimSpace(name)] = i
+	}
+	return columns
+}
+
+func (c csvColumns) get(record []string, name string) string {
+	i, ok := c[name]
+	if !ok || i >= len(record) {
+		return ""
+	}
+	return record[i]
+}
+
+// Переставляет поля записи в порядок текущего заголовка; отсутствующие остаются пустыми
+func (c csvColumns) normalize(record []string) []string {
+	row := make([]string, len(reservationHeaders))
+	for i, name := range reservationHeaders {
+		row[i] = c.get(record, name)
+	}
+	return row
 }
 
-func saveReservationToFile(reservation Reservation) {
-	file, err := os.OpenFile(reservationsFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+func parseReservationRecord(columns csvColumns, record []string) (Reservation, error) {
+	id := columns.get(record, "ID")
+	if id == "" {
+		return Reservation{}, errors.New("пустой ID")
+	}
+
+	chatID, err := strconv.ParseInt(columns.get(record, "ChatID"), 10, 64)
 	if err != nil {
-		log.Printf("Ошибка при открытии файла для записи: %v", err)
-		return
+		return Reservation{}, fmt.Errorf("ошибка парсинга ChatID в брони %s: %v", id, err)
 	}
-	defer file.Close()
 
-	writer := csv.NewWriter(file)
-	record := []string{
+	name := columns.get(record, "Name")
+	if name == "" {
+		return Reservation{}, fmt.Errorf("пустое имя в брони %s", id)
+	}
+
+	guests, err := strconv.Atoi(columns.get(record, "Guests"))
+	if err != nil {
+		return Reservation{}, fmt.Errorf("ошибка парсинга количества гостей в брони %s: %v", id, err)
+	}
+
+	// Файлы без колонки Status переводим по старому флагу Confirmed
+	status := ReservationStatus(columns.get(record, "Status"))
+	if status == "" {
+		status = statusConfirmed
+		if value := columns.get(record, "Confirmed"); value != "" {
+			confirmed, err := strconv.ParseBool(value)
+			if err != nil {
+				return Reservation{}, fmt.Errorf("ошибка парсинга статуса подтверждения в брони %s: %v", id, err)
+			}
+			if !confirmed {
+				status = statusPending
+			}
+		}
+	}
+	if _, ok := statusTitles[status]; !ok {
+		return Reservation{}, fmt.Errorf("неизвестный статус %q в брони %s", status, id)
+	}
+
+	var createdAt time.Time
+	if value := columns.get(record, "CreatedAt"); value != "" {
+		if createdAt, err = time.Parse(time.RFC3339, value); err != nil {
+			return Reservation{}, fmt.Errorf("ошибка парсинга даты создания в брони %s: %v", id, err)
+		}
+	}
+
+	createdByStaff := false
+	if value := columns.get(record, "CreatedByStaff"); value != "" {
+		if createdByStaff, err = strconv.ParseBool(value); err != nil {
+			return Reservation{}, fmt.Errorf("ошибка парсинга признака брони от администратора в брони %s: %v", id, err)
+		}
+	}
+
+	feedback := 0
+	if value := columns.get(record, "Feedback"); value != "" {
+		if feedback, err = strconv.Atoi(value); err != nil {
+			return Reservation{}, fmt.Errorf("ошибка парсинга оценки в брони %s: %v", id, err)
+		}
+	}
+
+	depositAmount := 0
+	if value := columns.get(record, "DepositAmount"); value != "" {
+		if depositAmount, err = strconv.Atoi(value); err != nil {
+			return Reservation{}, fmt.Errorf("ошибка парсинга суммы предоплаты в брони %s: %v", id, err)
+		}
+	}
+	depositPaid := false
+	if value := columns.get(record, "DepositPaid"); value != "" {
+		if depositPaid, err = strconv.ParseBool(value); err != nil {
+			return Reservation{}, fmt.Errorf("ошибка парсинга признака предоплаты в брони %s: %v", id, err)
+		}
+	}
+
+	reminderSent := false
+	if value := columns.get(record, "ReminderSent"); value != "" {
+		if reminderSent, err = strconv.ParseBool(value); err != nil {
+			return Reservation{}, fmt.Errorf("ошибка парсинга признака напоминания в брони %s: %v", id, err)
+		}
+	}
+
+	needsChildSeat := false
+	if value := columns.get(record, "NeedsChildSeat"); value != "" {
+		if needsChildSeat, err = strconv.ParseBool(value); err != nil {
+			return Reservation{}, fmt.Errorf("ошибка парсинга детского стула в брони %s: %v", id, err)
+		}
+	}
+
+	var statusChangedAt time.Time
+	if value := columns.get(record, "StatusChangedAt"); value != "" {
+		if statusChangedAt, err = time.Parse(time.RFC3339, value); err != nil {
+			return Reservation{}, fmt.Errorf("ошибка парсинга даты смены статуса в брони %s: %v", id, err)
+		}
+	}
+
+	return Reservation{
+		ID:        id,
+		ChatID:    chatID,
+		Name:      name,
+		Phone:     columns.get(record, "Phone"),
+		Guests:    guests,
+		Date:      columns.get(record, "Date"),
+		Time:      columns.get(record, "Time"),
+		Comment:   columns.get(record, "Comment"),
+		Status:    status,
+		CreatedAt: createdAt,
+		Username:  columns.get(record, "Username"),
+
+		StatusChangedAt: statusChangedAt,
+		Code:            strings.ToUpper(columns.get(record, "Code")),
+		Lang:            columns.get(record, "Lang"),
+
+		SeatingPreference: columns.get(record, "SeatingPreference"),
+		Occasion:          columns.get(record, "Occasion"),
+		Source:            columns.get(record, "Source"),
+		CreatedByStaff:    createdByStaff,
+		NeedsChildSeat:    needsChildSeat,
+		VenueID:           columns.get(record, "VenueID"),
+		ReminderSent:      reminderSent,
+		Feedback:          feedback,
+		Table:             columns.get(record, "Table"),
+		DepositAmount:     depositAmount,
+		DepositPaid:       depositPaid,
+		PaymentChargeID:   columns.get(record, "PaymentChargeID"),
+	}, nil
+}
+
+func formatOptionalTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+func reservationRecord(reservation Reservation) []string {
+	return []string{
 		reservation.ID,
 		strconv.FormatInt(reservation.ChatID, 10),
 		reservation.Name,
@@ -1033,96 +3171,105 @@ func saveReservationToFile(reservation Reservation) {
 		reservation.Date,
 		reservation.Time,
 		reservation.Comment,
-		strconv.FormatBool(reservation.Confirmed),
+		strconv.FormatBool(reservation.Status != statusPending),
 		reservation.CreatedAt.Format(time.RFC3339),
+		reservation.Username,
+		string(reservation.Status),
+		formatOptionalTime(reservation.StatusChangedAt),
+		reservation.Code,
+		reservation.Lang,
+		reservation.SeatingPreference,
+		reservation.Occasion,
+		reservation.Source,
+		strconv.FormatBool(reservation.CreatedByStaff),
+		strconv.FormatBool(reservation.NeedsChildSeat),
+		reservation.VenueID,
+		strconv.FormatBool(reservation.ReminderSent),
+		strconv.Itoa(reservation.Feedback),
+		reservation.Table,
+		strconv.Itoa(reservation.DepositAmount),
+		strconv.FormatBool(reservation.DepositPaid),
+		reservation.PaymentChargeID,
 	}
+}
 
-	if err := writer.Write(record); err != nil {
-		log.Printf("Ошибка записи брони в файл: %v", err)
+// Файл только для чтения или занятый другим процессом — ошибка, а не тихая потеря брони
+func saveReservationToFile(reservation Reservation) error {
+	if cfg.DryRun {
+		return nil
+	}
+	file, err := os.OpenFile(cfg.ReservationsFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("ошибка при открытии файла для записи: %w", err)
 	}
-	writer.Flush()
 
+	writer := csv.NewWriter(file)
+	writer.Write(reservationRecord(reservation))
+	writer.Flush()
 	if err := writer.Error(); err != nil {
-		log.Printf("Ошибка при сохранении файла: %v", err)
+		file.Close()
+		return fmt.Errorf("ошибка записи брони в файл: %w", err)
+	}
+	// На заполненном диске ошибка может проявиться только при закрытии
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("ошибка при сохранении файла: %w", err)
 	}
 
-	log.Printf("Бронь сохранена в файл: ID=%s, Имя='%s'", reservation.ID, reservation.Name)
+	slog.Debug("Бронь сохранена в файл", "reservationID", reservation.ID, "name", reservation.Name)
+	return nil
 }
 
-func updateReservationInFile(reservation Reservation) {
-	file, err := os.OpenFile(reservationsFile, os.O_RDWR|os.O_CREATE, 0644)
-	if err != nil {
-		log.Printf("Ошибка при открытии файла для обновления: %v", err)
-		return
+func updateReservationsInFile(updated ...Reservation) error {
+	if cfg.DryRun {
+		return nil
 	}
-	defer file.Close()
-
-	reader := csv.NewReader(file)
-	reader.Comma = ','
-	reader.FieldsPerRecord = -1
-
-	if _, err := reader.Read(); err != nil {
-		log.Printf("Ошибка чтения заголовка: %v", err)
-		return
+	byID := make(map[string]Reservation, len(updated))
+	ids := make([]string, 0, len(updated))
+	for _, r := range updated {
+		byID[r.ID] = r
+		ids = append(ids, r.ID)
 	}
 
-	records, err := reader.ReadAll()
+	err := rewriteReservationsFile(func(id string, columns csvColumns, record []string) []string {
+		if r, ok := byID[id]; ok {
+			return reservationRecord(r)
+		}
+		return columns.normalize(record)
+	})
 	if err != nil {
-		log.Printf("Ошибка чтения файла для обновления: %v", err)
-		return
+		return fmt.Errorf("обновление броней %v: %w", ids, err)
 	}
+	slog.Debug("Брони обновлены в файле", "reservationIDs", ids)
+	return nil
+}
 
-	file.Truncate(0)
-	file.Seek(0, 0)
-	writer := csv.NewWriter(file)
-
-	headers := []string{
-		"ID",
-		"ChatID",
-		"Name",
-		"Phone",
-		"Guests",
-		"Date",
-		"Time",
-		"Comment",
-		"Confirmed",
-		"CreatedAt",
+func deleteReservationsFromFile(ids ...string) error {
+	if cfg.DryRun {
+		return nil
 	}
-	writer.Write(headers)
-
-	for _, record := range records {
-		if len(record) > 0 && record[0] == reservation.ID {
-			record = []string{
-				reservation.ID,
-				strconv.FormatInt(reservation.ChatID, 10),
-				reservation.Name,
-				reservation.Phone,
-				strconv.Itoa(reservation.Guests),
-				reservation.Date,
-				reservation.Time,
-				reservation.Comment,
-				strconv.FormatBool(reservation.Confirmed),
-				reservation.CreatedAt.Format(time.RFC3339),
-			}
-		}
-		if len(record) > 0 {
-			writer.Write(record)
-		}
+	removed := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		removed[id] = true
 	}
-	writer.Flush()
 
-	if err := writer.Error(); err != nil {
-		log.Printf("Ошибка при сохранении файла после обновления: %v", err)
+	err := rewriteReservationsFile(func(id string, columns csvColumns, record []string) []string {
+		if removed[id] {
+			return nil
+		}
+		return columns.normalize(record)
+	})
+	if err != nil {
+		return fmt.Errorf("удаление броней %v: %w", ids, err)
 	}
-
-	log.Printf("Бронь обновлена в файле: ID=%s, Имя='%s'", reservation.ID, reservation.Name)
+	slog.Debug("Брони удалены из файла", "reservationIDs", ids)
+	return nil
 }
 
-func deleteReservationFromFile(id string) {
-	file, err := os.OpenFile(reservationsFile, os.O_RDWR|os.O_CREATE, 0644)
+// Переписывает файл броней целиком; rewrite возвращает новую строку или nil, чтобы ее удалить
+func rewriteReservationsFile(rewrite func(id string, columns csvColumns, record []string) []string) error {
+	file, err := os.Open(cfg.ReservationsFile)
 	if err != nil {
-		log.Printf("Ошибка при открытии файла для удаления: %v", err)
-		return
+		return fmt.Errorf("ошибка при открытии файла броней: %w", err)
 	}
 	defer file.Close()
 
@@ -1130,43 +3277,56 @@ func deleteReservationFromFile(id string) {
 	reader.Comma = ','
 	reader.FieldsPerRecord = -1
 
-	if _, err := reader.Read(); err != nil {
-		log.Printf("Ошибка чтения заголовка: %v", err)
-		return
+	header, err := reader.Read()
+	if err != nil {
+		return fmt.Errorf("ошибка чтения заголовка: %w", err)
 	}
+	columns := newCSVColumns(header)
 
 	records, err := reader.ReadAll()
 	if err != nil {
-		log.Printf("Ошибка чтения файла для удаления: %v", err)
-		return
+		return fmt.Errorf("ошибка чтения файла броней: %w", err)
 	}
 
-	file.Truncate(0)
-	file.Seek(0, 0)
-	writer := csv.NewWriter(file)
-
-	headers := []string{
-		"ID",
-		"ChatID",
-		"Name",
-		"Phone",
-		"Guests",
-		"Date",
-		"Time",
-		"Comment",
-		"Confirmed",
-		"CreatedAt",
-	}
-	writer.Write(headers)
+	file.Close()
 
+	var rows [][]string
 	for _, record := range records {
-		if len(record) > 0 && record[0] != id {
-			writer.Write(record)
+		id := columns.get(record, "ID")
+		if id == "" {
+			continue
+		}
+		if row := rewrite(id, columns, record); row != nil {
+			rows = append(rows, row)
 		}
 	}
-	writer.Flush()
+	return replaceReservationsFile(rows)
+}
 
-	if err := writer.Error(); err != nil {
-		log.Printf("Ошибка при сохранении файла после удаления: %v", err)
+// Пишем во временный файл и переименовываем: сбой посреди записи оставляет прежний файл целым
+func replaceReservationsFile(rows [][]string) error {
+	tmpFile := cfg.ReservationsFile + ".tmp"
+	file, err := os.OpenFile(tmpFile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return fmt.Errorf("ошибка создания временного файла броней: %w", err)
+	}
+
+	writer := csv.NewWriter(file)
+	writer.Write(reservationHeaders)
+	writer.WriteAll(rows)
+	err = writer.Error()
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmpFile, cfg.ReservationsFile)
+	}
+	if err != nil {
+		os.Remove(tmpFile)
+		return fmt.Errorf("ошибка при сохранении файла броней: %w", err)
 	}
+	return nil
 }
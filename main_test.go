@@ -0,0 +1,978 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	testGuestID int64 = 100
+	testAdminID int64 = 900
+)
+
+// Фоновые циклы читают часы из своих горутин, поэтому под блокировкой
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func (c *fakeClock) set(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = now
+}
+
+type testBot struct {
+	t *testing.T
+	*fakeSender
+	clock *fakeClock
+}
+
+// Конфигурация из loadConfig со значениями по умолчанию, файлы во временном
+// каталоге, пустые карты состояния и часы, стоящие на now. env дополняет и
+// переопределяет переменные окружения теста
+func setupTest(t *testing.T, now string, env map[string]string) *testBot {
+	t.Helper()
+	dir := t.TempDir()
+	vars := map[string]string{
+		"TELEGRAM_BOT_TOKEN":       "test",
+		"ADMIN_CHAT_IDS":           "900",
+		"TIMEZONE":                 "Europe/Moscow",
+		"RESERVATIONS_FILE":        filepath.Join(dir, "reservations.csv"),
+		"USER_STATES_FILE":         filepath.Join(dir, "user_states.json"),
+		"PROFILES_FILE":            filepath.Join(dir, "profiles.json"),
+		"BLOCKLIST_FILE":           filepath.Join(dir, "blocklist.json"),
+		"ARCHIVE_FILE":             filepath.Join(dir, "archive.csv"),
+		"BLACKOUT_DATES_FILE":      filepath.Join(dir, "blackout_dates.txt"),
+		"DAILY_SUMMARY_STATE_FILE": filepath.Join(dir, "daily_summary_sent.txt"),
+		"MENU_FILE":                filepath.Join(dir, "menu.pdf"),
+		"RATE_LIMIT_PER_MINUTE":    "0",
+		"ASK_CHILD_SEAT":           "false",
+		"QUIET_HOURS":              "",
+		"VENUES_FILE":              "",
+	}
+	for key, value := range env {
+		vars[key] = value
+	}
+	for key, value := range vars {
+		t.Setenv(key, value)
+	}
+
+	savedCfg, savedLoc, savedClock, savedProfiles := cfg, loc, clock, profiles
+	t.Cleanup(func() { cfg, loc, clock, profiles = savedCfg, savedLoc, savedClock, savedProfiles })
+
+	c, err := loadConfig()
+	if err != nil {
+		t.Fatalf("loadConfig: %v", err)
+	}
+	cfg = c
+	loc = loadLocation(cfg.TimeZone)
+	start, err := time.ParseInLocation("02.01.2006 15:04", now, loc)
+	if err != nil {
+		t.Fatalf("время теста %q: %v", now, err)
+	}
+	fc := &fakeClock{now: start}
+	clock = fc
+
+	userStates = make(map[int64]UserState)
+	reservations = make(map[string]Reservation)
+	reservationCodes = make(map[string]string)
+	profiles = &fileProfileStore{path: cfg.ProfilesFile, profiles: make(map[int64]UserProfile)}
+	blocklist = nil
+	blockedChats = make(map[int64]bool)
+	rateLimiters = make(map[int64]*userLimiter)
+	lastCallbacks = make(map[int64]handledCallback)
+	supportThreads = make(map[supportKey]supportThread)
+	deferredFeedback = make(map[string]bool)
+	phoneCodeSends = make(map[int64][]time.Time)
+	pendingBroadcasts = make(map[int64]string)
+	menuFileID = ""
+	initReservationsFile()
+
+	return &testBot{t: t, fakeSender: &fakeSender{}, clock: fc}
+}
+
+func testChat(chatID int64) *tgbotapi.Chat {
+	return &tgbotapi.Chat{ID: chatID, Type: "private"}
+}
+
+func testUser(chatID int64) *tgbotapi.User {
+	return &tgbotapi.User{ID: chatID, FirstName: "Гость", LanguageCode: "ru"}
+}
+
+// Сообщение от пользователя, как его обрабатывает цикл обновлений в main
+func (b *testBot) say(chatID int64, text string) {
+	b.t.Helper()
+	message := &tgbotapi.Message{MessageID: 1, From: testUser(chatID), Chat: testChat(chatID), Text: text}
+	if strings.HasPrefix(text, "/") {
+		command, _, _ := strings.Cut(text, " ")
+		message.Entities = []tgbotapi.MessageEntity{{Type: "bot_command", Offset: 0, Length: len(command)}}
+	}
+	statesMu.Lock()
+	defer statesMu.Unlock()
+	handleMessage(b, message)
+}
+
+func (b *testBot) press(chatID int64, data string) {
+	b.t.Helper()
+	query := &tgbotapi.CallbackQuery{
+		ID:      "callback",
+		From:    testUser(chatID),
+		Message: &tgbotapi.Message{MessageID: 1, Chat: testChat(chatID)},
+		Data:    data,
+	}
+	statesMu.Lock()
+	defer statesMu.Unlock()
+	handleCallbackQuery(b, query)
+}
+
+// Нажимает последнюю присланную кнопку с данными, начинающимися с prefix
+func (b *testBot) pressButton(chatID int64, prefix string) {
+	b.t.Helper()
+	data, ok := b.button(chatID, prefix)
+	if !ok {
+		b.t.Fatalf("нет кнопки %q, последнее сообщение: %q", prefix, b.lastText(chatID))
+	}
+	b.press(chatID, data)
+}
+
+// Проходит мастер бронирования до выбора даты
+func (b *testBot) fillGuestDetails(chatID int64, guests string) {
+	b.t.Helper()
+	b.say(chatID, "/start")
+	b.say(chatID, t(chatID, "btn_book"))
+	b.say(chatID, "Анна")
+	b.pressButton(chatID, "phone_manual")
+	b.say(chatID, "8 999 123-45-67")
+	b.say(chatID, guests)
+	if len(cfg.SeatingOptions) > 0 {
+		b.pressButton(chatID, "seat_0")
+	}
+	b.pressButton(chatID, "occasion_birthday")
+	b.say(chatID, "У окна")
+}
+
+// Проходит мастер бронирования до экрана проверки брони
+func (b *testBot) fillBooking(chatID int64, guests, date, timeStr string) {
+	b.t.Helper()
+	b.fillGuestDetails(chatID, guests)
+	b.pressButton(chatID, "date_"+date)
+	b.pressButton(chatID, "time_"+timeStr)
+	if userStates[chatID].State != stateConfirmingReservation {
+		b.t.Fatalf("после выбора времени состояние %d, последнее сообщение: %q", userStates[chatID].State, b.lastText(chatID))
+	}
+}
+
+// Бронь гостя через весь мастер; возвращает созданную бронь
+func (b *testBot) book(chatID int64, guests, date, timeStr string) Reservation {
+	b.t.Helper()
+	before := len(reservations)
+	b.fillBooking(chatID, guests, date, timeStr)
+	b.press(chatID, "booking_confirm")
+	if len(reservations) != before+1 {
+		b.t.Fatalf("бронь не создана, последнее сообщение: %q", b.lastText(chatID))
+	}
+	for _, r := range reservations {
+		if r.ChatID == chatID && r.Date == date && r.Time == timeStr && r.Status.isActive() {
+			return r
+		}
+	}
+	b.t.Fatalf("бронь на %s %s не найдена", date, timeStr)
+	return Reservation{}
+}
+
+// Перечитывает брони из файла, как после перезапуска бота
+func reloadReservations(t *testing.T) {
+	t.Helper()
+	reservations = make(map[string]Reservation)
+	reservationCodes = make(map[string]string)
+	loadReservationsFromFile()
+}
+
+func TestBookingFlow(t *testing.T) {
+	b := setupTest(t, "14.10.2026 12:00", nil)
+
+	r := b.book(testGuestID, "4", "15.10.2026", "19:00")
+
+	if r.Name != "Анна" || r.Phone != "+79991234567" || r.Guests != 4 || r.Comment != "У окна" ||
+		r.Occasion != "birthday" || r.SeatingPreference != cfg.SeatingOptions[0] || r.Status != statusConfirmed {
+		t.Fatalf("бронь записана неверно: %+v", r)
+	}
+	if state := userStates[testGuestID]; state.State != stateMainMenu || state.TempReservation != nil {
+		t.Fatalf("после брони состояние не сброшено: %+v", state)
+	}
+	if !b.received(testGuestID, r.Code) {
+		t.Fatalf("гостю не пришло подтверждение с кодом %s: %q", r.Code, b.texts(testGuestID))
+	}
+	if !b.received(testAdminID, "Новая бронь #"+r.Code) {
+		t.Fatalf("администратор не получил уведомление: %q", b.texts(testAdminID))
+	}
+
+	reloadReservations(t)
+	if saved, ok := reservations[r.ID]; !ok || saved.Code != r.Code || saved.Guests != 4 || saved.Time != "19:00" {
+		t.Fatalf("бронь не сохранилась в файл: %+v", saved)
+	}
+}
+
+func TestEditFlow(t *testing.T) {
+	b := setupTest(t, "14.10.2026 12:00", nil)
+	r := b.book(testGuestID, "4", "15.10.2026", "19:00")
+	b.reset()
+	b.clock.advance(time.Minute)
+
+	b.press(testGuestID, "edit_select_"+r.ID)
+	b.pressButton(testGuestID, "edit_change_guests")
+	b.say(testGuestID, "6")
+	b.pressButton(testGuestID, "edit_change_time")
+	b.pressButton(testGuestID, "time_20:00")
+	b.pressButton(testGuestID, "edit_confirm")
+
+	edited := reservations[r.ID]
+	if edited.Guests != 6 || edited.Time != "20:00" || edited.Date != r.Date || edited.Code != r.Code {
+		t.Fatalf("изменения не применены: %+v", edited)
+	}
+	if !b.received(testGuestID, tr(userLang(testGuestID), "changes_saved")) {
+		t.Fatalf("гость не получил подтверждение изменений: %q", b.texts(testGuestID))
+	}
+	if !b.received(testAdminID, "Бронь #"+r.Code+" отредактирована") {
+		t.Fatalf("администратор не получил уведомление о правке: %q", b.texts(testAdminID))
+	}
+
+	reloadReservations(t)
+	if saved := reservations[r.ID]; saved.Guests != 6 || saved.Time != "20:00" {
+		t.Fatalf("изменения не сохранились в файл: %+v", saved)
+	}
+}
+
+func TestConfiguredTimezoneLoads(t *testing.T) {
+	setupTest(t, "14.10.2026 12:00", map[string]string{"TIMEZONE": "Asia/Yekaterinburg"})
+	if loc.String() != "Asia/Yekaterinburg" {
+		t.Fatalf("loc = %s, ожидался Asia/Yekaterinburg", loc)
+	}
+	if _, offset := time.Date(2026, 1, 1, 12, 0, 0, 0, loc).Zone(); offset != 5*60*60 {
+		t.Fatalf("смещение %d с, ожидалось +05:00", offset)
+	}
+
+	// Битый ZONEINFO не мешает: остаются системная и встроенная база
+	t.Setenv("ZONEINFO", filepath.Join(t.TempDir(), "нет"))
+	if got := loadLocation(defaultTimeZone); got.String() != defaultTimeZone {
+		t.Fatalf("loadLocation(%q) = %s", defaultTimeZone, got)
+	}
+	if got := loadLocation("Mars/Olympus_Mons"); got != time.UTC {
+		t.Fatalf("неизвестный пояс: %s, ожидался UTC", got)
+	}
+}
+
+func TestLoadLegacyReservationsFile(t *testing.T) {
+	setupTest(t, "14.10.2026 12:00", nil)
+	legacy := "ID,ChatID,Name,Phone,Guests,Date,Time,Comment,Confirmed,CreatedAt\n" +
+		"old-1,100,Анна,+79991234567,4,15.10.2026,19:00,У окна,true,2026-10-01T10:00:00+03:00\n" +
+		"old-2,101,Борис,+79997654321,2,16.10.2026,20:30,-,false,2026-10-02T11:30:00+03:00\n"
+	if err := os.WriteFile(cfg.ReservationsFile, []byte(legacy), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	initReservationsFile()
+	reloadReservations(t)
+
+	if len(reservations) != 2 {
+		t.Fatalf("загружено %d броней, ожидалось 2", len(reservations))
+	}
+	first, second := reservations["old-1"], reservations["old-2"]
+	if first.ChatID != 100 || first.Name != "Анна" || first.Guests != 4 || first.Date != "15.10.2026" ||
+		first.Time != "19:00" || first.Comment != "У окна" || first.Status != statusConfirmed {
+		t.Fatalf("old-1 загружена неверно: %+v", first)
+	}
+	if second.Status != statusPending {
+		t.Fatalf("Confirmed=false должен стать %q, получено %q", statusPending, second.Status)
+	}
+	if !first.CreatedAt.Equal(time.Date(2026, 10, 1, 7, 0, 0, 0, time.UTC)) {
+		t.Fatalf("CreatedAt = %s", first.CreatedAt)
+	}
+	// Новые колонки пустые и получают значения по умолчанию
+	if first.Code == "" || reservationCodes[first.Code] != "old-1" || first.VenueID != "" || first.ReminderSent || first.Feedback != 0 {
+		t.Fatalf("поля новой схемы: %+v", first)
+	}
+
+	// Файл переписан под текущий заголовок без потери строк
+	data, err := os.ReadFile(cfg.ReservationsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header, _, _ := strings.Cut(string(data), "\n")
+	if header != strings.Join(reservationHeaders, ",") {
+		t.Fatalf("заголовок после миграции: %s", header)
+	}
+	if n := strings.Count(strings.TrimSpace(string(data)), "\n"); n != 2 {
+		t.Fatalf("после миграции %d строк броней, ожидалось 2", n)
+	}
+}
+
+func TestLoadExtendedReservationsFile(t *testing.T) {
+	setupTest(t, "14.10.2026 12:00", nil)
+	want := Reservation{
+		ID: "new-1", ChatID: 100, Name: "Анна", Phone: "+79991234567", Guests: 4,
+		Date: "15.10.2026", Time: "19:00", Comment: "У окна", Status: statusSeated,
+		CreatedAt: time.Date(2026, 10, 1, 10, 0, 0, 0, loc), Username: "anna",
+		StatusChangedAt: time.Date(2026, 10, 15, 19, 5, 0, 0, loc), Code: "AB12",
+		Lang: "en", SeatingPreference: "На террасе", Occasion: "birthday", Source: "promo",
+		CreatedByStaff: true, NeedsChildSeat: true, VenueID: "center", ReminderSent: true,
+		Feedback: 5, Table: "7", DepositAmount: 150000, DepositPaid: true, PaymentChargeID: "charge-1",
+	}
+
+	// Колонки в обратном порядке и одна неизвестная: читаем по именам из заголовка
+	record := reservationRecord(want)
+	header := []string{"FutureColumn"}
+	row := []string{"что-то новое"}
+	for i := len(reservationHeaders) - 1; i >= 0; i-- {
+		header = append(header, reservationHeaders[i])
+		row = append(row, record[i])
+	}
+	file, err := os.Create(cfg.ReservationsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writer := csv.NewWriter(file)
+	writer.Write(header)
+	writer.Write(row)
+	writer.Flush()
+	if err := errors.Join(writer.Error(), file.Close()); err != nil {
+		t.Fatal(err)
+	}
+
+	reloadReservations(t)
+	got, ok := reservations[want.ID]
+	if !ok {
+		t.Fatal("бронь не загружена")
+	}
+	if !got.CreatedAt.Equal(want.CreatedAt) || !got.StatusChangedAt.Equal(want.StatusChangedAt) {
+		t.Fatalf("время: %s, %s", got.CreatedAt, got.StatusChangedAt)
+	}
+	got.CreatedAt, got.StatusChangedAt = want.CreatedAt, want.StatusChangedAt
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("загружено:\n%+v\nожидалось:\n%+v", got, want)
+	}
+}
+
+// Кнопки времени, присланные последним сообщением с выбором времени
+func (b *testBot) timeButtons(chatID int64) []string {
+	b.t.Helper()
+	list := b.messages(chatID)
+	for i := len(list) - 1; i >= 0; i-- {
+		markup, ok := list[i].Markup.(tgbotapi.InlineKeyboardMarkup)
+		if !ok {
+			continue
+		}
+		var slots []string
+		for _, row := range markup.InlineKeyboard {
+			for _, button := range row {
+				if data := *button.CallbackData; strings.HasPrefix(data, "time_") && data != "time_manual" {
+					slots = append(slots, strings.TrimPrefix(data, "time_"))
+				}
+			}
+		}
+		if len(slots) > 0 {
+			return slots
+		}
+	}
+	return nil
+}
+
+func TestStaleTimeButtonRefused(t *testing.T) {
+	b := setupTest(t, "14.10.2026 16:25", nil)
+	b.fillGuestDetails(testGuestID, "2")
+	b.pressButton(testGuestID, "date_14.10.2026")
+	if slots := b.timeButtons(testGuestID); len(slots) == 0 || slots[0] != "18:30" {
+		t.Fatalf("в 16:25 первый слот %v, ожидался 18:30", slots)
+	}
+
+	// Гость думал десять минут: 18:30 уже ближе двух часов
+	b.clock.advance(10 * time.Minute)
+	b.press(testGuestID, "time_18:30")
+
+	state := userStates[testGuestID]
+	if state.State != stateWaitingForTime || state.TempReservation != nil {
+		t.Fatalf("устаревшее время принято: %+v", state)
+	}
+	if !b.received(testGuestID, tr(langRU, "time_min_lead", durationTitle(langRU, cfg.MinBookingLead))) {
+		t.Fatalf("нет отказа по сроку брони: %q", b.texts(testGuestID))
+	}
+	if slots := b.timeButtons(testGuestID); len(slots) == 0 || slots[0] != "19:00" {
+		t.Fatalf("после отказа первый слот %v, ожидался 19:00", slots)
+	}
+}
+
+func TestStaleReviewNotConfirmed(t *testing.T) {
+	b := setupTest(t, "14.10.2026 16:25", nil)
+	b.fillBooking(testGuestID, "2", "14.10.2026", "18:30")
+
+	b.clock.advance(6 * time.Minute)
+	b.press(testGuestID, "booking_confirm")
+
+	if len(reservations) != 0 {
+		t.Fatalf("создана бронь на прошедший срок: %+v", reservations)
+	}
+	if state := userStates[testGuestID]; state.State != stateWaitingForTime {
+		t.Fatalf("после отказа состояние %d, ожидался выбор времени", state.State)
+	}
+}
+
+// Сохраняет бронь в файл и карты, как после confirmReservation; пустые поля заполняет
+func addReservation(t *testing.T, r Reservation) Reservation {
+	t.Helper()
+	if r.ID == "" {
+		r.ID = newReservationID()
+	}
+	if r.ChatID == 0 {
+		r.ChatID = testGuestID
+	}
+	if r.Name == "" {
+		r.Name = "Анна"
+	}
+	if r.Phone == "" {
+		r.Phone = "+79991234567"
+	}
+	if r.Guests == 0 {
+		r.Guests = 2
+	}
+	if r.Status == "" {
+		r.Status = statusConfirmed
+	}
+	if r.CreatedAt.IsZero() {
+		r.CreatedAt = clock.Now()
+	}
+	r.Code = assignShortCode(r.ID)
+	if err := saveReservationToFile(r); err != nil {
+		t.Fatalf("saveReservationToFile: %v", err)
+	}
+	reservations[r.ID] = r
+	reservationCodes[r.Code] = r.ID
+	return r
+}
+
+func TestClockDrivesSlotsAndActiveReservations(t *testing.T) {
+	b := setupTest(t, "14.10.2026 12:00", nil)
+	r := addReservation(t, Reservation{Date: "14.10.2026", Time: "19:00"})
+
+	b.fillGuestDetails(testGuestID, "2")
+	b.pressButton(testGuestID, "date_14.10.2026")
+	if slots := b.timeButtons(testGuestID); len(slots) == 0 || slots[0] != "16:00" {
+		t.Fatalf("в 12:00 первый слот %v, ожидалось открытие в 16:00", slots)
+	}
+	if active := getUserActiveReservations(testGuestID); len(active) != 1 || active[0].ID != r.ID {
+		t.Fatalf("в 12:00 активные брони %+v", active)
+	}
+
+	b.clock.advance(8*time.Hour + 10*time.Minute)
+	b.pressButton(testGuestID, "date_14.10.2026")
+	if slots := b.timeButtons(testGuestID); len(slots) == 0 || slots[0] != "22:30" {
+		t.Fatalf("в 20:10 первый слот %v, ожидался 22:30", slots)
+	}
+	if active := getUserActiveReservations(testGuestID); len(active) != 0 {
+		t.Fatalf("в 20:10 прошедшая бронь осталась активной: %+v", active)
+	}
+}
+
+// Сколько сообщений чату содержат want
+func (b *testBot) count(chatID int64, want string) int {
+	n := 0
+	for _, text := range b.texts(chatID) {
+		if strings.Contains(text, want) {
+			n++
+		}
+	}
+	return n
+}
+
+func TestDoubleSubmitCreatesOneReservation(t *testing.T) {
+	b := setupTest(t, "14.10.2026 12:00", nil)
+	b.fillBooking(testGuestID, "2", "15.10.2026", "19:00")
+
+	// Двойной тап: второе нажатие приходит сразу, третье — уже после паузы
+	b.press(testGuestID, "booking_confirm")
+	b.press(testGuestID, "booking_confirm")
+	b.clock.advance(2 * callbackDebounce)
+	b.press(testGuestID, "booking_confirm")
+
+	if len(reservations) != 1 {
+		t.Fatalf("создано %d броней, ожидалась одна", len(reservations))
+	}
+	if n := b.count(testAdminID, "Новая бронь #"); n != 1 {
+		t.Fatalf("администратор получил %d уведомлений о новой брони", n)
+	}
+}
+
+func TestSecondReviewOfSameSlotIsDuplicate(t *testing.T) {
+	b := setupTest(t, "14.10.2026 12:00", nil)
+	b.fillBooking(testGuestID, "2", "15.10.2026", "19:00")
+	// Второй экран проверки той же брони, например открытый на другом устройстве
+	review := userStates[testGuestID]
+	second := *review.TempReservation
+	second.ID = newReservationID()
+
+	b.press(testGuestID, "booking_confirm")
+	review.TempReservation = &second
+	userStates[testGuestID] = review
+	b.clock.advance(time.Minute)
+	b.press(testGuestID, "booking_confirm")
+
+	if len(reservations) != 1 {
+		t.Fatalf("создано %d броней, ожидалась одна", len(reservations))
+	}
+	var existing Reservation
+	for _, r := range reservations {
+		existing = r
+	}
+	if !b.received(testGuestID, tr(langRU, "duplicate", existing.Code, existing.Date, existing.Time)) {
+		t.Fatalf("нет предупреждения о дубле: %q", b.texts(testGuestID))
+	}
+	if state := userStates[testGuestID]; state.State == stateConfirmingReservation {
+		t.Fatal("после дубля остался экран подтверждения")
+	}
+}
+
+func TestEditIntoFullSlotRefused(t *testing.T) {
+	b := setupTest(t, "14.10.2026 12:00", map[string]string{"MAX_GUESTS_PER_SLOT": "6"})
+	addReservation(t, Reservation{ChatID: 101, Name: "Борис", Guests: 4, Date: "15.10.2026", Time: "20:00"})
+	r := addReservation(t, Reservation{Guests: 4, Date: "15.10.2026", Time: "19:00"})
+
+	b.press(testGuestID, "edit_select_"+r.ID)
+	b.pressButton(testGuestID, "edit_change_time")
+	b.pressButton(testGuestID, "time_20:00")
+	b.pressButton(testGuestID, "edit_confirm")
+
+	if saved := reservations[r.ID]; saved.Time != "19:00" {
+		t.Fatalf("бронь перенесена в заполненный слот: %+v", saved)
+	}
+	if !b.received(testGuestID, tr(langRU, "slot_full", "15.10.2026", "20:00")) {
+		t.Fatalf("нет отказа о заполненном слоте: %q", b.texts(testGuestID))
+	}
+	reloadReservations(t)
+	if saved := reservations[r.ID]; saved.Time != "19:00" {
+		t.Fatalf("в файле бронь перенесена: %+v", saved)
+	}
+
+	// Своя бронь в подсчете слота не участвует: 6 гостей в 19:00 ровно до лимита
+	b.clock.advance(time.Minute)
+	b.press(testGuestID, "edit_select_"+r.ID)
+	b.pressButton(testGuestID, "edit_change_guests")
+	b.say(testGuestID, "6")
+	b.pressButton(testGuestID, "edit_confirm")
+	if saved := reservations[r.ID]; saved.Guests != 6 || saved.Time != "19:00" {
+		t.Fatalf("правка в пределах лимита не сохранена: %+v", saved)
+	}
+}
+
+// Очистка под своей блокировкой, обработчики пишут брони, метрики читают их:
+// под -race любое обращение к reservations мимо statesMu здесь всплывет
+func TestCleanupConcurrentWithHandlers(t *testing.T) {
+	b := setupTest(t, "14.10.2026 12:00", nil)
+	const perWorker = 100
+
+	var wg sync.WaitGroup
+	wg.Add(4)
+	go func() {
+		defer wg.Done()
+		var lastPurge time.Time
+		for i := 0; i < perWorker; i++ {
+			lastPurge = cleanupPass(b, lastPurge)
+			b.clock.advance(10 * time.Minute)
+		}
+	}()
+	for worker := 0; worker < 2; worker++ {
+		go func() {
+			defer wg.Done()
+			for i := 0; i < perWorker; i++ {
+				statesMu.Lock()
+				// Визиты от «уже прошедшего» до «через пару часов» относительно текущих часов
+				visit := clock.Now().Add(time.Duration(i%8-4) * 30 * time.Minute).Truncate(30 * time.Minute)
+				r := addReservation(t, Reservation{Date: visit.Format("02.01.2006"), Time: visit.Format("15:04")})
+				if i%3 == 0 {
+					r.Status = statusCancelled
+					if err := updateReservationsInFile(r); err != nil {
+						t.Error(err)
+					}
+					reservations[r.ID] = r
+				}
+				statesMu.Unlock()
+			}
+		}()
+	}
+	go func() {
+		defer wg.Done()
+		for i := 0; i < perWorker; i++ {
+			statesMu.RLock()
+			for _, r := range reservations {
+				_ = r.Status.isActive()
+			}
+			statesMu.RUnlock()
+		}
+	}()
+	wg.Wait()
+
+	// Последний проход после всех записей: прошедших активных броней не остается
+	cleanupPass(b, time.Time{})
+	if len(reservations) != 2*perWorker {
+		t.Fatalf("в памяти %d броней, ожидалось %d", len(reservations), 2*perWorker)
+	}
+	for _, r := range reservations {
+		if upcoming, _ := isUpcoming(r, clock.Now()); r.Status.isActive() && !upcoming {
+			t.Fatalf("прошедшая бронь осталась активной: %+v", r)
+		}
+	}
+	memory := make(map[string]ReservationStatus, len(reservations))
+	for id, r := range reservations {
+		memory[id] = r.Status
+	}
+	reloadReservations(t)
+	for id, status := range memory {
+		if reservations[id].Status != status {
+			t.Fatalf("бронь %s: в файле %q, в памяти %q", id, reservations[id].Status, status)
+		}
+	}
+}
+
+func TestReservationTTLBoundary(t *testing.T) {
+	b := setupTest(t, "14.10.2026 12:00", nil)
+	r := addReservation(t, Reservation{Date: "14.10.2026", Time: "19:00"})
+	future := addReservation(t, Reservation{Date: "10.01.2027", Time: "19:00"})
+	visit, _ := reservationDateTime(r)
+	end := visit.Add(cfg.ReservationTTL)
+
+	tests := []struct {
+		name   string
+		now    time.Time
+		active bool
+	}{
+		{"время визита", visit, true},
+		{"за секунду до конца TTL", end.Add(-time.Second), true},
+		{"ровно конец TTL", end, false},
+		{"после конца TTL", end.Add(time.Minute), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b.clock.set(tt.now)
+			if upcoming, ok := isUpcoming(r, tt.now); !ok || upcoming != tt.active {
+				t.Fatalf("isUpcoming = %v, %v; ожидалось %v", upcoming, ok, tt.active)
+			}
+			active := getUserActiveReservations(testGuestID)
+			if got := len(active) == 2; got != tt.active {
+				t.Fatalf("активные брони %+v", active)
+			}
+			if expired := expiredReservationIDs(tt.now); (len(expired) == 1 && expired[0] == r.ID) == tt.active {
+				t.Fatalf("истекшие брони %v", expired)
+			}
+		})
+	}
+
+	// Очистка завершает бронь по тому же правилу, а дальняя бронь остается активной
+	b.clock.set(end.Add(-time.Second))
+	cleanupPass(b, clock.Now())
+	if reservations[r.ID].Status != statusConfirmed {
+		t.Fatalf("бронь завершена до конца TTL: %s", reservations[r.ID].Status)
+	}
+	b.clock.set(end)
+	cleanupPass(b, clock.Now())
+	if reservations[r.ID].Status != statusCompleted || reservations[future.ID].Status != statusConfirmed {
+		t.Fatalf("после TTL: %s, дальняя бронь: %s", reservations[r.ID].Status, reservations[future.ID].Status)
+	}
+}
+
+func TestCancelDeadlineBoundary(t *testing.T) {
+	b := setupTest(t, "14.10.2026 12:00", map[string]string{"CANCEL_DEADLINE_HOURS": "2"})
+	r := addReservation(t, Reservation{Date: "14.10.2026", Time: "19:00"})
+	deadline := time.Date(2026, 10, 14, 17, 0, 0, 0, loc)
+	tooLate := tr(langRU, "cancel_too_late", 2, cfg.ManagerPhone)
+
+	if cancelDeadlinePassed(r, deadline.Add(-time.Second)) || !cancelDeadlinePassed(r, deadline) {
+		t.Fatal("граница дедлайна должна быть ровно за 2 часа до визита")
+	}
+
+	// За секунду до дедлайна гость получает подтверждение удаления, но жмет его уже на границе
+	b.clock.set(deadline.Add(-time.Second))
+	b.press(testGuestID, "edit_delete_"+r.ID)
+	if _, ok := b.button(testGuestID, "edit_confirmdelete_"+r.ID); !ok || b.received(testGuestID, tooLate) {
+		t.Fatalf("до дедлайна отмена недоступна: %q", b.texts(testGuestID))
+	}
+	b.clock.set(deadline)
+	b.pressButton(testGuestID, "edit_confirmdelete_")
+	if reservations[r.ID].Status != statusConfirmed || !b.received(testGuestID, tooLate) {
+		t.Fatalf("отмена на границе дедлайна: %s, %q", reservations[r.ID].Status, b.texts(testGuestID))
+	}
+
+	// Администратор отменяет и после дедлайна
+	b.clock.advance(time.Hour)
+	b.press(testAdminID, "edit_delete_"+r.ID)
+	b.pressButton(testAdminID, "edit_confirmdelete_")
+	if reservations[r.ID].Status != statusCancelled {
+		t.Fatalf("администратор не смог отменить бронь: %s", reservations[r.ID].Status)
+	}
+}
+
+func TestLateEveningNoSlotsToday(t *testing.T) {
+	// Последняя бронь в 23:30, а до нее меньше двух часов
+	b := setupTest(t, "14.10.2026 21:45", nil)
+	b.fillGuestDetails(testGuestID, "2")
+	b.pressButton(testGuestID, "date_14.10.2026")
+
+	if slots := b.timeButtons(testGuestID); len(slots) != 0 {
+		t.Fatalf("поздно вечером предложены слоты %v", slots)
+	}
+	if got := b.lastText(testGuestID); got != tr(langRU, "no_slots_today") {
+		t.Fatalf("последнее сообщение %q", got)
+	}
+	if buttons := b.lastButtons(testGuestID); !reflect.DeepEqual(buttons, []string{"back", "cancel"}) {
+		t.Fatalf("кнопки под сообщением %v, ожидались выбор даты и отмена", buttons)
+	}
+
+	// Кнопка возвращает к выбору даты, а на завтра слоты есть
+	b.pressButton(testGuestID, "back")
+	if state := userStates[testGuestID]; state.State != stateWaitingForDate {
+		t.Fatalf("после кнопки состояние %d, ожидался выбор даты", state.State)
+	}
+	b.pressButton(testGuestID, "date_15.10.2026")
+	if slots := b.timeButtons(testGuestID); len(slots) == 0 || slots[0] != "16:00" {
+		t.Fatalf("на завтра слоты %v", slots)
+	}
+}
+
+func TestLateEveningNoSlotsWhileEditing(t *testing.T) {
+	b := setupTest(t, "14.10.2026 12:00", nil)
+	r := addReservation(t, Reservation{Date: "15.10.2026", Time: "19:00"})
+	b.clock.set(time.Date(2026, 10, 14, 22, 0, 0, 0, loc))
+
+	b.press(testGuestID, "edit_select_"+r.ID)
+	b.pressButton(testGuestID, "edit_change_date")
+	b.pressButton(testGuestID, "date_14.10.2026")
+
+	if got := b.lastText(testGuestID); got != tr(langRU, "no_slots_today") {
+		t.Fatalf("последнее сообщение %q", got)
+	}
+	if buttons := b.lastButtons(testGuestID); !reflect.DeepEqual(buttons, []string{"edit_change_date", "cancel"}) {
+		t.Fatalf("при правке кнопки %v, ожидался возврат к выбору даты брони", buttons)
+	}
+}
+
+func TestBookingNotConfirmedWhenFileUnwritable(t *testing.T) {
+	b := setupTest(t, "14.10.2026 12:00", nil)
+	b.fillBooking(testGuestID, "4", "15.10.2026", "19:00")
+
+	// Каталог на месте файла: открыть его на дозапись нельзя даже под root
+	if err := os.Remove(cfg.ReservationsFile); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(cfg.ReservationsFile, 0755); err != nil {
+		t.Fatal(err)
+	}
+	b.press(testGuestID, "booking_confirm")
+
+	if len(reservations) != 0 || len(reservationCodes) != 0 {
+		t.Fatalf("несохраненная бронь осталась в памяти: %+v", reservations)
+	}
+	if !b.received(testGuestID, tr(langRU, "save_failed", cfg.ManagerPhone)) {
+		t.Fatalf("гость не узнал о сбое: %q", b.texts(testGuestID))
+	}
+	if b.received(testGuestID, "#") {
+		t.Fatalf("гостю пришел код несохраненной брони: %q", b.texts(testGuestID))
+	}
+	if !b.received(testAdminID, "⚠️ Не удалось сохранить бронь") {
+		t.Fatalf("администратор не получил предупреждение: %q", b.texts(testAdminID))
+	}
+	if state := userStates[testGuestID]; state.TempReservation != nil {
+		t.Fatalf("черновик брони не сброшен: %+v", state)
+	}
+}
+
+func TestEditKeepsOldVersionWhenRewriteFails(t *testing.T) {
+	b := setupTest(t, "14.10.2026 12:00", nil)
+	r := b.book(testGuestID, "4", "15.10.2026", "19:00")
+	before, err := os.ReadFile(cfg.ReservationsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.reset()
+
+	// Временный файл не создать — перезапись срывается до переименования
+	tmpFile := cfg.ReservationsFile + ".tmp"
+	if err := os.Mkdir(tmpFile, 0755); err != nil {
+		t.Fatal(err)
+	}
+	b.press(testGuestID, "edit_select_"+r.ID)
+	b.pressButton(testGuestID, "edit_change_guests")
+	b.say(testGuestID, "6")
+	b.pressButton(testGuestID, "edit_confirm")
+
+	if got := reservations[r.ID]; got.Guests != 4 {
+		t.Fatalf("в памяти изменения, которых нет в файле: %+v", got)
+	}
+	if !b.received(testGuestID, tr(langRU, "edit_failed", cfg.ManagerPhone)) {
+		t.Fatalf("гость не узнал о сбое: %q", b.texts(testGuestID))
+	}
+	if !b.received(testAdminID, "⚠️ Не удалось сохранить изменения брони #"+r.Code) {
+		t.Fatalf("администратор не получил предупреждение: %q", b.texts(testAdminID))
+	}
+	after, err := os.ReadFile(cfg.ReservationsFile)
+	if err != nil || string(after) != string(before) {
+		t.Fatalf("файл броней поврежден при сбое: %v", err)
+	}
+
+	// Временный файл записан, но переименование не удалось: он удаляется
+	if err := os.Remove(tmpFile); err != nil {
+		t.Fatal(err)
+	}
+	cfg.ReservationsFile = filepath.Join(t.TempDir(), "reservations.csv")
+	if err := os.MkdirAll(filepath.Join(cfg.ReservationsFile, "busy"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := replaceReservationsFile(nil); err == nil {
+		t.Fatal("переименование поверх непустого каталога прошло без ошибки")
+	}
+	if _, err := os.Stat(cfg.ReservationsFile + ".tmp"); !os.IsNotExist(err) {
+		t.Fatalf("временный файл остался после сбоя: %v", err)
+	}
+}
+
+// Изменение брони, сделанное, пока гость ее правил, — как будто его внес администратор
+func changeReservation(t *testing.T, r Reservation) {
+	t.Helper()
+	if err := updateReservationsInFile(r); err != nil {
+		t.Fatal(err)
+	}
+	reservations[r.ID] = r
+}
+
+func TestEditKeepsChangesMadeMeanwhile(t *testing.T) {
+	b := setupTest(t, "14.10.2026 12:00", nil)
+	r := b.book(testGuestID, "4", "15.10.2026", "19:00")
+	b.press(testGuestID, "edit_select_"+r.ID)
+	b.pressButton(testGuestID, "edit_change_guests")
+	b.say(testGuestID, "6")
+
+	meanwhile := reservations[r.ID]
+	meanwhile.Status = statusSeated
+	meanwhile.Table = "5"
+	meanwhile.DepositPaid = true
+	meanwhile.DepositAmount = 100000
+	meanwhile.PaymentChargeID = "charge_1"
+	changeReservation(t, meanwhile)
+
+	b.pressButton(testGuestID, "edit_confirm")
+	reloadReservations(t)
+	got := reservations[r.ID]
+	if got.Guests != 6 {
+		t.Fatalf("правка гостя не сохранена: %+v", got)
+	}
+	if got.Status != statusSeated || got.Table != "5" || !got.DepositPaid || got.DepositAmount != 100000 || got.PaymentChargeID != "charge_1" {
+		t.Fatalf("правка затерла изменения администратора: %+v", got)
+	}
+}
+
+func TestEditOfReservationFinishedMeanwhileRefused(t *testing.T) {
+	for _, status := range []ReservationStatus{statusCancelled, statusCompleted, statusNoShow} {
+		t.Run(string(status), func(t *testing.T) {
+			b := setupTest(t, "14.10.2026 12:00", nil)
+			r := b.book(testGuestID, "4", "15.10.2026", "19:00")
+			b.press(testGuestID, "edit_select_"+r.ID)
+			b.pressButton(testGuestID, "edit_change_guests")
+			b.say(testGuestID, "6")
+
+			meanwhile := reservations[r.ID]
+			meanwhile.Status = status
+			changeReservation(t, meanwhile)
+			b.pressButton(testGuestID, "edit_confirm")
+
+			reloadReservations(t)
+			if got := reservations[r.ID]; got.Status != status || got.Guests != 4 {
+				t.Fatalf("правка вернула бронь в работу: %+v", got)
+			}
+			if !b.received(testGuestID, tr(langRU, "edit_inactive", r.Code)) {
+				t.Fatalf("гость не узнал, что бронь уже не активна: %q", b.texts(testGuestID))
+			}
+		})
+	}
+}
+
+func TestStaleManualTimeButtonRefused(t *testing.T) {
+	b := setupTest(t, "14.10.2026 12:00", nil)
+	press := func(step string) {
+		t.Helper()
+		before := userStates[testGuestID].State
+		b.reset()
+		// Повтор той же кнопки сразу отсекается как двойное нажатие
+		b.clock.advance(time.Minute)
+		b.press(testGuestID, "time_manual")
+		if got := userStates[testGuestID].State; got != before {
+			t.Fatalf("%s: кнопка перевела из состояния %d в %d", step, before, got)
+		}
+		if !b.received(testGuestID, tr(langRU, "button_outdated")) {
+			t.Fatalf("%s: нет ответа об устаревшей кнопке: %q", step, b.texts(testGuestID))
+		}
+	}
+
+	b.say(testGuestID, "/start")
+	press("главное меню")
+	b.say(testGuestID, tr(langRU, "btn_book"))
+	press("ввод имени")
+
+	// На шаге выбора времени кнопка работает
+	b.fillGuestDetails(testGuestID, "2")
+	b.pressButton(testGuestID, "date_15.10.2026")
+	b.pressButton(testGuestID, "time_manual")
+	if got := userStates[testGuestID].State; got != stateWaitingForManualTime {
+		t.Fatalf("на шаге времени кнопка не открыла ввод: %d", got)
+	}
+	b.say(testGuestID, "19:00")
+	if got := userStates[testGuestID].State; got != stateConfirmingReservation {
+		t.Fatalf("после ввода времени состояние %d: %q", got, b.lastText(testGuestID))
+	}
+}
+
+// Исправленное сообщение, как его обрабатывает цикл обновлений в main
+func (b *testBot) edit(chatID int64, text string) {
+	b.t.Helper()
+	message := &tgbotapi.Message{MessageID: 1, From: testUser(chatID), Chat: testChat(chatID), Text: text}
+	statesMu.Lock()
+	defer statesMu.Unlock()
+	handleEditedMessage(b, message)
+}
+
+func TestEditedMessageFromBlockedUserIgnored(t *testing.T) {
+	b := setupTest(t, "14.10.2026 12:00", nil)
+	b.say(testGuestID, "/start")
+	b.edit(testGuestID, "привет")
+	if !b.received(testGuestID, tr(langRU, "edit_ignored")) {
+		t.Fatalf("обычный гость не получил ответ на правку: %q", b.texts(testGuestID))
+	}
+
+	b.say(testAdminID, fmt.Sprintf("/block %d", testGuestID))
+	b.reset()
+	b.edit(testGuestID, "привет еще раз")
+	if b.received(testGuestID, tr(langRU, "edit_ignored")) {
+		t.Fatalf("заблокированному гостю ответили на правку: %q", b.texts(testGuestID))
+	}
+	if !b.received(testGuestID, tr(langRU, "user_blocked", cfg.ManagerPhone)) {
+		t.Fatalf("заблокированный гость не получил отказ: %q", b.texts(testGuestID))
+	}
+}
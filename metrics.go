@@ -0,0 +1,76 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	bookingsCreated = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "bot_bookings_created_total",
+		Help: "Созданные бронирования",
+	})
+	bookingsEdited = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "bot_bookings_edited_total",
+		Help: "Отредактированные бронирования",
+	})
+	bookingsCancelled = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "bot_bookings_cancelled_total",
+		Help: "Отмененные гостями бронирования",
+	})
+	sendErrors = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "bot_send_errors_total",
+		Help: "Ошибки отправки сообщений",
+	})
+	storageErrors = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "bot_storage_errors_total",
+		Help: "Ошибки записи файла бронирований",
+	})
+	updateDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "bot_update_duration_seconds",
+		Help:    "Время обработки одного обновления",
+		Buckets: prometheus.DefBuckets,
+	})
+
+	_ = promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "bot_active_reservations",
+		Help: "Активные бронирования",
+	}, func() float64 {
+		statesMu.RLock()
+		defer statesMu.RUnlock()
+
+		count := 0
+		for _, r := range reservations {
+			if r.Status.isActive() {
+				count++
+			}
+		}
+		return float64(count)
+	})
+)
+
+func startMetricsServer(c Config) {
+	if c.MetricsAddr == "" {
+		return
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	server := &http.Server{
+		Addr:              c.MetricsAddr,
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	go func() {
+		slog.Info("Метрики доступны", "addr", c.MetricsAddr, "path", "/metrics")
+		if err := server.ListenAndServe(); err != nil {
+			slog.Error("Ошибка сервера метрик", "err", err)
+		}
+	}()
+}
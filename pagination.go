@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	userListPageSize  = 5
+	adminListPageSize = 10
+)
+
+// Границы страницы; номер страницы приводится к допустимому диапазону
+func pageBounds(total, page, size int) (start, end, current, pages int) {
+	pages = (total + size - 1) / size
+	if pages == 0 {
+		pages = 1
+	}
+	if page < 0 {
+		page = 0
+	}
+	if page >= pages {
+		page = pages - 1
+	}
+	start = page * size
+	end = start + size
+	if end > total {
+		end = total
+	}
+	return start, end, page, pages
+}
+
+// Кнопки листания; в callback передаются тип списка, фильтр и номер страницы
+func pageNavRow(kind, filter string, page, pages int) []tgbotapi.InlineKeyboardButton {
+	if pages <= 1 {
+		return nil
+	}
+
+	var row []tgbotapi.InlineKeyboardButton
+	if page > 0 {
+		row = append(row, tgbotapi.NewInlineKeyboardButtonData("◀", fmt.Sprintf("page_%s_%s_%d", kind, filter, page-1)))
+	}
+	if page < pages-1 {
+		row = append(row, tgbotapi.NewInlineKeyboardButtonData("▶", fmt.Sprintf("page_%s_%s_%d", kind, filter, page+1)))
+	}
+	return row
+}
+
+// Отправляет новую страницу или редактирует уже показанное сообщение
+func sendPage(bot Sender, chatID int64, messageID int, text string, rows [][]tgbotapi.InlineKeyboardButton) {
+	if messageID == 0 {
+		msg := tgbotapi.NewMessage(chatID, text)
+		if len(rows) > 0 {
+			msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
+		}
+		deliver(bot, chatID, "страница списка", msg)
+		return
+	}
+
+	edit := tgbotapi.NewEditMessageText(chatID, messageID, text)
+	if len(rows) > 0 {
+		markup := tgbotapi.NewInlineKeyboardMarkup(rows...)
+		edit.ReplyMarkup = &markup
+	}
+	deliver(bot, chatID, "страница списка", edit)
+}
+
+func handlePageAction(bot Sender, chatID int64, messageID int, action string) {
+	parts := strings.SplitN(action, "_", 3)
+	if len(parts) != 3 {
+		return
+	}
+	kind, filter := parts[0], parts[1]
+	page, err := strconv.Atoi(parts[2])
+	if err != nil {
+		return
+	}
+
+	switch kind {
+	case "my":
+		showUserReservationsPage(bot, chatID, messageID, page)
+	case "date":
+		if isAdmin(chatID) {
+			sendReservationsForDatePage(bot, chatID, messageID, filter, page)
+		}
+	case "find":
+		if isAdmin(chatID) {
+			findReservationsByPhonePage(bot, chatID, messageID, filter, page)
+		}
+	}
+}
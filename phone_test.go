@@ -0,0 +1,51 @@
+package main
+
+import "testing"
+
+func TestNormalizePhone(t *testing.T) {
+	region := cfg.PhoneRegion
+	cfg.PhoneRegion = "RU"
+	t.Cleanup(func() { cfg.PhoneRegion = region })
+
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"через 8", "89991234567", "+79991234567"},
+		{"через 8 с дефисами", "8-999-123-45-67", "+79991234567"},
+		{"через 8 со скобками", "8 (999) 123-45-67", "+79991234567"},
+		{"с +7", "+7 (999) 123-45-67", "+79991234567"},
+		{"с 7 без плюса", "7 999 123 45 67", "+79991234567"},
+		{"без кода страны", "999 123 45 67", "+79991234567"},
+		{"пробелы по краям", "  +79991234567 \n", "+79991234567"},
+		{"бесплатный 8-800", "8 800 555 35 35", "+78005553535"},
+		{"Великобритания", "+44 20 7946 0958", "+442079460958"},
+		{"Германия", "+49 30 901820", "+4930901820"},
+		{"США", "+1 (212) 736-5000", "+12127365000"},
+
+		{"10 цифр с +7", "+7 999 123 45 6", ""},
+		{"12 цифр с +7", "+7 999 123 45 678", ""},
+		{"12 цифр через 8", "8999 123 45 678", ""},
+		{"буквы внутри", "8999abc4567", ""},
+		{"буква в конце", "+7999123456x7", ""},
+		{"кириллица", "8 999 123 45 67 доб. 12", ""},
+		{"только буквы", "телефон", ""},
+		{"пусто", "", ""},
+		{"только плюс", "+", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := normalizePhone(tt.input)
+			if tt.want == "" {
+				if err == nil {
+					t.Fatalf("normalizePhone(%q) = %q, ожидалась ошибка", tt.input, got)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Fatalf("normalizePhone(%q) = %q, %v; ожидалось %q", tt.input, got, err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	phoneCodeDigits   = 6
+	phoneCodeTTL      = 5 * time.Minute
+	phoneCodeResend   = time.Minute
+	phoneCodeWindow   = time.Hour
+	phoneCodeMaxSends = 3 // SMS с кодом на пользователя за phoneCodeWindow
+	phoneCodeMaxTries = 5
+)
+
+var (
+	// Время отправленных кодов по чатам; доступ под statesMu. Хранится вне UserState,
+	// чтобы сброс мастера бронирования не обнулял лимит
+	phoneCodeSends  = make(map[int64][]time.Time)
+	phoneCodeSender smsProvider
+)
+
+// VERIFY_PHONE: номер, введенный вручную или присланный чужим контактом, гость
+// подтверждает кодом из SMS. В DRY_RUN код только пишется в лог. Возвращает,
+// осталась ли проверка включенной
+func startPhoneVerification(c Config) bool {
+	if !c.VerifyPhone || c.DryRun {
+		return c.VerifyPhone
+	}
+	provider, err := newSMSProvider(c)
+	if err != nil {
+		slog.Error("Проверка телефона по SMS отключена", "err", err)
+		return false
+	}
+	phoneCodeSender = provider
+	slog.Info("Проверка телефона по SMS включена", "provider", c.SMSProvider)
+	return true
+}
+
+// Номер из профиля уже использовался в прошлой брони, повторно его не проверяем.
+// Бронь за гостя администратор вносит со слов гостя, код ему прислать некому
+func phoneNeedsVerification(chatID int64, phone string) bool {
+	if !cfg.VerifyPhone || isAdmin(chatID) || userStates[chatID].StaffBooking {
+		return false
+	}
+	if profile, ok := getProfile(chatID); ok && profile.Phone == phone {
+		return false
+	}
+	return true
+}
+
+func requestPhoneCode(bot Sender, chatID int64, phone string, forEdit bool) {
+	state := userStates[chatID]
+	state.State = stateWaitingForPhoneCode
+	state.PendingPhone = phone
+	state.PhoneCodeForEdit = forEdit
+	state.PhoneCode = ""
+	userStates[chatID] = state
+	sendPhoneCode(bot, chatID)
+}
+
+func sendPhoneCode(bot Sender, chatID int64) {
+	state := userStates[chatID]
+	now := clock.Now()
+
+	sends := recentPhoneCodeSends(chatID, now)
+	if n := len(sends); n > 0 && now.Sub(sends[n-1]) < phoneCodeResend {
+		wait := phoneCodeResend - now.Sub(sends[n-1])
+		sendPhoneCodePrompt(bot, chatID, t(chatID, "code_wait", int(wait.Seconds())+1))
+		return
+	}
+	if len(sends) >= phoneCodeMaxSends {
+		slog.Warn("Превышен лимит SMS с кодом", "chatID", chatID, "phone", state.PendingPhone)
+		sendMessage(bot, chatID, t(chatID, "code_limit", cfg.ManagerPhone), false)
+		cancelPhoneCode(bot, chatID)
+		return
+	}
+
+	code, err := newPhoneCode()
+	if err != nil {
+		slog.Error("Ошибка генерации кода подтверждения", "err", err)
+		sendMessage(bot, chatID, t(chatID, "code_failed", cfg.ManagerPhone), false)
+		cancelPhoneCode(bot, chatID)
+		return
+	}
+	state.PhoneCode = code
+	state.PhoneCodeExpires = now.Add(phoneCodeTTL)
+	state.PhoneCodeTries = 0
+	userStates[chatID] = state
+	phoneCodeSends[chatID] = append(sends, now)
+
+	deliverPhoneCode(bot, chatID, state.PendingPhone, tr(userLang(chatID), "sms_phone_code", code, venueByID(state.VenueID).Name))
+	sendPhoneCodePrompt(bot, chatID, t(chatID, "code_sent", formatPhone(state.PendingPhone), int(phoneCodeTTL.Minutes())))
+}
+
+// SMS уходит в фоне: провайдер может отвечать до smsTimeout, а обработка
+// обновлений идет под statesMu
+func deliverPhoneCode(bot Sender, chatID int64, phone, text string) {
+	if cfg.DryRun || phoneCodeSender == nil {
+		slog.Warn("DRY_RUN: SMS с кодом не отправлено", "chatID", chatID, "phone", phone, "text", text)
+		return
+	}
+	go func() {
+		response, err := phoneCodeSender.Send(phone, text)
+		if err == nil {
+			slog.Info("SMS с кодом подтверждения отправлено", "chatID", chatID, "response", response)
+			return
+		}
+		slog.Error("Ошибка отправки SMS с кодом", "chatID", chatID, "err", err, "response", response)
+		statesMu.Lock()
+		defer statesMu.Unlock()
+		if userStates[chatID].State == stateWaitingForPhoneCode {
+			sendMessage(bot, chatID, t(chatID, "code_failed", cfg.ManagerPhone), false)
+			cancelPhoneCode(bot, chatID)
+		}
+	}()
+}
+
+func sendPhoneCodePrompt(bot Sender, chatID int64, text string) {
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.ReplyMarkup = tgbotapi.NewReplyKeyboard(
+		tgbotapi.NewKeyboardButtonRow(tgbotapi.NewKeyboardButton(t(chatID, "btn_resend_code"))),
+		tgbotapi.NewKeyboardButtonRow(tgbotapi.NewKeyboardButton(t(chatID, "btn_step_back"))),
+	)
+	deliver(bot, chatID, "запрос кода подтверждения", msg)
+}
+
+func checkPhoneCode(bot Sender, chatID int64, input string) {
+	state := userStates[chatID]
+	if state.PhoneCode == "" || clock.Now().After(state.PhoneCodeExpires) {
+		sendPhoneCodePrompt(bot, chatID, t(chatID, "code_expired"))
+		return
+	}
+
+	code := nonDigits.ReplaceAllString(input, "")
+	if subtle.ConstantTimeCompare([]byte(code), []byte(state.PhoneCode)) != 1 {
+		state.PhoneCodeTries++
+		userStates[chatID] = state
+		if state.PhoneCodeTries >= phoneCodeMaxTries {
+			slog.Warn("Исчерпаны попытки ввода кода подтверждения", "chatID", chatID, "phone", state.PendingPhone)
+			sendMessage(bot, chatID, t(chatID, "code_too_many"), false)
+			cancelPhoneCode(bot, chatID)
+			return
+		}
+		sendMessage(bot, chatID, t(chatID, "code_wrong", phoneCodeMaxTries-state.PhoneCodeTries), false)
+		return
+	}
+
+	phone, forEdit := state.PendingPhone, state.PhoneCodeForEdit
+	resetPhoneCode(&state)
+	slog.Info("Телефон подтвержден кодом из SMS", "chatID", chatID, "phone", phone)
+
+	if forEdit && state.TempReservation != nil {
+		state.State = stateEditingReservation
+		state.TempReservation.Phone = phone
+		userStates[chatID] = state
+		showEditOptions(bot, chatID, *state.TempReservation)
+		return
+	}
+	state.State = stateWaitingForGuests
+	state.PhoneManual = phone
+	state.PhoneContact = ""
+	userStates[chatID] = state
+	askForGuests(bot, chatID)
+}
+
+// Возврат к вводу номера: при бронировании — к выбору способа, при правке — к списку полей
+func cancelPhoneCode(bot Sender, chatID int64) {
+	state := userStates[chatID]
+	forEdit := state.PhoneCodeForEdit
+	resetPhoneCode(&state)
+
+	if forEdit && state.TempReservation != nil {
+		state.State = stateEditingReservation
+		userStates[chatID] = state
+		showEditOptions(bot, chatID, *state.TempReservation)
+		return
+	}
+	state.State = stateWaitingForPhone
+	state.PhoneContact = ""
+	state.PhoneManual = ""
+	userStates[chatID] = state
+	askForPhone(bot, chatID)
+}
+
+func resetPhoneCode(state *UserState) {
+	state.PendingPhone = ""
+	state.PhoneCode = ""
+	state.PhoneCodeExpires = time.Time{}
+	state.PhoneCodeTries = 0
+	state.PhoneCodeForEdit = false
+}
+
+func recentPhoneCodeSends(chatID int64, now time.Time) []time.Time {
+	var recent []time.Time
+	for _, at := range phoneCodeSends[chatID] {
+		if now.Sub(at) < phoneCodeWindow {
+			recent = append(recent, at)
+		}
+	}
+	if len(recent) == 0 {
+		delete(phoneCodeSends, chatID)
+	}
+	return recent
+}
+
+func prunePhoneCodeSends(now time.Time) {
+	for chatID := range phoneCodeSends {
+		recentPhoneCodeSends(chatID, now)
+	}
+}
+
+func newPhoneCode() (string, error) {
+	limit := big.NewInt(1)
+	for i := 0; i < phoneCodeDigits; i++ {
+		limit.Mul(limit, big.NewInt(10))
+	}
+	n, err := rand.Int(rand.Reader, limit)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%0*d", phoneCodeDigits, n), nil
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"os"
+	"time"
+)
+
+// Постоянные данные гостя; в отличие от UserState не сбрасываются после брони
+type UserProfile struct {
+	ChatID    int64
+	Name      string
+	Phone     string
+	Lang      string
+	UpdatedAt time.Time
+}
+
+type ProfileStore interface {
+	Get(chatID int64) (UserProfile, bool)
+	Save(profile UserProfile)
+}
+
+// Профили в JSON-файле рядом с бронями; доступ под statesMu
+type fileProfileStore struct {
+	path     string
+	profiles map[int64]UserProfile
+}
+
+var profiles ProfileStore = &fileProfileStore{profiles: make(map[int64]UserProfile)}
+
+func loadProfileStore(path string) *fileProfileStore {
+	store := &fileProfileStore{path: path, profiles: make(map[int64]UserProfile)}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			slog.Error("Ошибка при открытии файла профилей", "err", err)
+		}
+		return store
+	}
+	if err := json.Unmarshal(data, &store.profiles); err != nil {
+		slog.Error("Ошибка чтения файла профилей", "err", err)
+	}
+	slog.Info("Загружены профили гостей", "count", len(store.profiles))
+	return store
+}
+
+func (s *fileProfileStore) Get(chatID int64) (UserProfile, bool) {
+	profile, ok := s.profiles[chatID]
+	return profile, ok
+}
+
+func (s *fileProfileStore) Save(profile UserProfile) {
+	profile.UpdatedAt = clock.Now()
+	s.profiles[profile.ChatID] = profile
+	if s.path == "" {
+		return
+	}
+
+	data, err := json.Marshal(s.profiles)
+	if err != nil {
+		slog.Error("Ошибка сериализации профилей", "err", err)
+		return
+	}
+	tmpFile := s.path + ".tmp"
+	if err := os.WriteFile(tmpFile, data, 0644); err != nil {
+		slog.Error("Ошибка записи файла профилей", "err", err)
+		return
+	}
+	if err := os.Rename(tmpFile, s.path); err != nil {
+		slog.Error("Ошибка сохранения файла профилей", "err", err)
+	}
+}
+
+func getProfile(chatID int64) (UserProfile, bool) {
+	return profiles.Get(chatID)
+}
+
+func saveProfile(profile UserProfile) {
+	profiles.Save(profile)
+}
+
+// Запоминает имя и телефон из завершенной брони
+func rememberProfile(r Reservation) {
+	profile, _ := getProfile(r.ChatID)
+	profile.ChatID = r.ChatID
+	profile.Name = r.Name
+	profile.Phone = r.Phone
+	if r.Lang != "" {
+		profile.Lang = r.Lang
+	}
+	saveProfile(profile)
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Тихие часы [From, To) в минутах от полуночи по loc; From > To — окно через полночь
+type quietHours struct {
+	From, To int
+	Enabled  bool
+}
+
+// Формат: "23:00-09:00"; пустое значение отключает тихие часы
+func parseQuietHours(value string) (quietHours, error) {
+	if strings.TrimSpace(value) == "" {
+		return quietHours{}, nil
+	}
+	from, to, ok := strings.Cut(value, "-")
+	if !ok {
+		return quietHours{}, fmt.Errorf("ожидалось ЧЧ:ММ-ЧЧ:ММ, получено %q", value)
+	}
+	start, err := parseClock(from)
+	if err != nil {
+		return quietHours{}, err
+	}
+	end, err := parseClock(to)
+	if err != nil {
+		return quietHours{}, err
+	}
+	if start == end {
+		return quietHours{}, fmt.Errorf("начало и конец тихих часов совпадают: %q", value)
+	}
+	return quietHours{From: start, To: end, Enabled: true}, nil
+}
+
+func (q quietHours) contains(t time.Time) bool {
+	if !q.Enabled {
+		return false
+	}
+	t = t.In(loc)
+	minute := t.Hour()*60 + t.Minute()
+	if q.From < q.To {
+		return minute >= q.From && minute < q.To
+	}
+	return minute >= q.From || minute < q.To
+}
+
+// Начало и конец окна, в которое попадает t; вызывать, только если contains(t)
+func (q quietHours) window(t time.Time) (time.Time, time.Time) {
+	t = t.In(loc)
+	day := truncateToDay(t)
+	if q.From > q.To && t.Hour()*60+t.Minute() < q.To {
+		day = day.AddDate(0, 0, -1)
+	}
+	start := day.Add(time.Duration(q.From) * time.Minute)
+	end := day.Add(time.Duration(q.To) * time.Minute)
+	if q.From > q.To {
+		end = day.AddDate(0, 0, 1).Add(time.Duration(q.To) * time.Minute)
+	}
+	return start, end
+}
+
+// Ближайший момент не раньше t вне тихих часов
+func (q quietHours) nextAllowed(t time.Time) time.Time {
+	if !q.contains(t) {
+		return t
+	}
+	_, end := q.window(t)
+	return end
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseQuietHours(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    quietHours
+		wantErr bool
+	}{
+		{"", quietHours{}, false},
+		{"  ", quietHours{}, false},
+		{"23:00-09:00", quietHours{From: 23 * 60, To: 9 * 60, Enabled: true}, false},
+		{" 13:30 - 15:00 ", quietHours{From: 13*60 + 30, To: 15 * 60, Enabled: true}, false},
+		{"00:00-23:59", quietHours{From: 0, To: 23*60 + 59, Enabled: true}, false},
+		{"23:00", quietHours{}, true},
+		{"23:00-", quietHours{}, true},
+		{"24:00-09:00", quietHours{}, true},
+		{"23:00-9", quietHours{}, true},
+		{"09:00-09:00", quietHours{}, true},
+	}
+	for _, tt := range tests {
+		got, err := parseQuietHours(tt.value)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseQuietHours(%q) = %+v, %v; ожидалось %+v, ошибка %v", tt.value, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestQuietHoursBoundaries(t *testing.T) {
+	setupTest(t, "14.10.2026 12:00", nil)
+	at := func(day, hour, minute int) time.Time { return time.Date(2026, 10, day, hour, minute, 0, 0, loc) }
+	night, _ := parseQuietHours("23:00-09:00")
+	lunch, _ := parseQuietHours("13:00-15:00")
+
+	tests := []struct {
+		name  string
+		q     quietHours
+		now   time.Time
+		quiet bool
+		next  time.Time
+	}{
+		{"за минуту до начала", night, at(14, 22, 59), false, at(14, 22, 59)},
+		{"начало окна", night, at(14, 23, 0), true, at(15, 9, 0)},
+		{"перед полуночью", night, at(14, 23, 59), true, at(15, 9, 0)},
+		{"полночь", night, at(15, 0, 0), true, at(15, 9, 0)},
+		{"за минуту до конца", night, at(15, 8, 59), true, at(15, 9, 0)},
+		{"конец окна", night, at(15, 9, 0), false, at(15, 9, 0)},
+		{"секунды внутри последней минуты", night, at(15, 8, 59).Add(59 * time.Second), true, at(15, 9, 0)},
+		{"днем", night, at(15, 12, 0), false, at(15, 12, 0)},
+		{"за минуту до дневного окна", lunch, at(14, 12, 59), false, at(14, 12, 59)},
+		{"начало дневного окна", lunch, at(14, 13, 0), true, at(14, 15, 0)},
+		{"конец дневного окна", lunch, at(14, 15, 0), false, at(14, 15, 0)},
+		{"ночью вне дневного окна", lunch, at(14, 23, 30), false, at(14, 23, 30)},
+		{"другой часовой пояс", night, at(14, 23, 30).UTC(), true, at(15, 9, 0)},
+		{"окно отключено", quietHours{}, at(14, 23, 30), false, at(14, 23, 30)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.q.contains(tt.now); got != tt.quiet {
+				t.Fatalf("contains(%s) = %v", tt.now, got)
+			}
+			if got := tt.q.nextAllowed(tt.now); !got.Equal(tt.next) {
+				t.Fatalf("nextAllowed(%s) = %s, ожидалось %s", tt.now, got, tt.next)
+			}
+		})
+	}
+
+	// Окно через полночь определяется по дню, на который приходится его начало
+	start, end := night.window(at(15, 3, 0))
+	if !start.Equal(at(14, 23, 0)) || !end.Equal(at(15, 9, 0)) {
+		t.Fatalf("окно для 03:00: %s — %s", start, end)
+	}
+	start, end = night.window(at(14, 23, 30))
+	if !start.Equal(at(14, 23, 0)) || !end.Equal(at(15, 9, 0)) {
+		t.Fatalf("окно для 23:30: %s — %s", start, end)
+	}
+}
+
+func TestRemindersMovedOutOfQuietHours(t *testing.T) {
+	b := setupTest(t, "10.10.2026 12:00", map[string]string{"REMINDER_BEFORE": "3h", "QUIET_HOURS": "23:00-09:00"})
+	at := func(day, hour, minute int) time.Time { return time.Date(2026, 10, day, hour, minute, 0, 0, loc) }
+	// Напоминание в 19:00 до окна уходит вовремя
+	evening := addReservation(t, Reservation{ChatID: 101, Date: "14.10.2026", Time: "22:00"})
+	// В 08:00 внутри окна переносится на его конец
+	morning := addReservation(t, Reservation{ChatID: 102, Date: "15.10.2026", Time: "11:00"})
+	// К концу окна визит уже начнется — напоминание уходит за минуту до начала окна
+	early := addReservation(t, Reservation{ChatID: 103, Date: "15.10.2026", Time: "08:00"})
+
+	tests := []struct {
+		now  time.Time
+		want map[Reservation]int
+	}{
+		{at(14, 18, 59), map[Reservation]int{evening: 0, morning: 0, early: 0}},
+		{at(14, 19, 0), map[Reservation]int{evening: 1, morning: 0, early: 0}},
+		{at(14, 22, 58), map[Reservation]int{evening: 1, morning: 0, early: 0}},
+		{at(14, 22, 59), map[Reservation]int{evening: 1, morning: 0, early: 1}},
+		{at(15, 8, 0), map[Reservation]int{evening: 1, morning: 0, early: 1}},
+		{at(15, 8, 59), map[Reservation]int{evening: 1, morning: 0, early: 1}},
+		{at(15, 9, 0), map[Reservation]int{evening: 1, morning: 1, early: 1}},
+	}
+	for _, tt := range tests {
+		b.clock.set(tt.now)
+		sendDueReminders(b)
+		for r, want := range tt.want {
+			if got := b.reminders(r); got != want {
+				t.Fatalf("%s: напоминаний по брони на %s %s — %d, ожидалось %d", tt.now.Format("02.01 15:04"), r.Date, r.Time, got, want)
+			}
+		}
+	}
+}
+
+func TestNoReminderDuringQuietHoursAfterRestart(t *testing.T) {
+	b := setupTest(t, "10.10.2026 12:00", map[string]string{"REMINDER_BEFORE": "3h", "QUIET_HOURS": "23:00-09:00"})
+	// Бот лежал с 19:00 и поднялся ночью: просроченное напоминание не будит гостя,
+	// а к концу окна визит уже начался
+	r := addReservation(t, Reservation{Date: "14.10.2026", Time: "22:00"})
+	r2 := addReservation(t, Reservation{ChatID: 102, Date: "15.10.2026", Time: "01:00"})
+	for _, now := range []time.Time{
+		time.Date(2026, 10, 14, 23, 0, 0, 0, loc),
+		time.Date(2026, 10, 15, 0, 59, 0, 0, loc),
+		time.Date(2026, 10, 15, 9, 0, 0, 0, loc),
+	} {
+		b.clock.set(now)
+		sendDueReminders(b)
+	}
+	if b.reminders(r) != 0 || b.reminders(r2) != 0 {
+		t.Fatalf("напоминания в тихие часы или после визита: %q, %q", b.texts(r.ChatID), b.texts(r2.ChatID))
+	}
+}
+
+func TestSummaryTriggerOutsideQuietHours(t *testing.T) {
+	tests := []struct {
+		summary, quiet string
+		want           string
+	}{
+		{"08:00", "", "14.10.2026 08:00"},
+		{"08:00", "23:00-09:00", "14.10.2026 09:00"},
+		{"08:59", "23:00-09:00", "14.10.2026 09:00"},
+		{"09:00", "23:00-09:00", "14.10.2026 09:00"},
+		{"22:59", "23:00-09:00", "14.10.2026 22:59"},
+		{"23:30", "23:00-09:00", "15.10.2026 09:00"},
+		{"14:00", "13:00-15:00", "14.10.2026 15:00"},
+	}
+	for _, tt := range tests {
+		setupTest(t, "14.10.2026 12:00", map[string]string{"DAILY_SUMMARY_TIME": tt.summary, "QUIET_HOURS": tt.quiet})
+		day := time.Date(2026, 10, 14, 0, 0, 0, 0, loc)
+		want, _ := time.ParseInLocation("02.01.2006 15:04", tt.want, loc)
+		if got := summaryTrigger(day); !got.Equal(want) {
+			t.Errorf("сводка в %s при тихих часах %q: %s, ожидалось %s", tt.summary, tt.quiet, got, want)
+		}
+	}
+}
+
+func TestFeedbackDeferredUntilQuietHoursEnd(t *testing.T) {
+	b := setupTest(t, "14.10.2026 12:00", map[string]string{
+		"ASK_FEEDBACK": "true", "RESERVATION_TTL": "2h", "QUIET_HOURS": "23:00-09:00",
+	})
+	r := addReservation(t, Reservation{Date: "14.10.2026", Time: "22:00"})
+
+	// Визит завершается в полночь внутри окна: просьба об оценке откладывается
+	b.clock.set(time.Date(2026, 10, 15, 0, 0, 0, 0, loc))
+	cleanupPass(b, clock.Now())
+	if reservations[r.ID].Status != statusCompleted {
+		t.Fatalf("бронь не завершена: %s", reservations[r.ID].Status)
+	}
+	b.clock.set(time.Date(2026, 10, 15, 8, 59, 0, 0, loc))
+	cleanupPass(b, clock.Now())
+	if _, asked := b.button(r.ChatID, "feedback_"); asked {
+		t.Fatal("просьба об оценке ушла в тихие часы")
+	}
+
+	b.clock.set(time.Date(2026, 10, 15, 9, 0, 0, 0, loc))
+	cleanupPass(b, clock.Now())
+	cleanupPass(b, clock.Now())
+	if _, asked := b.button(r.ChatID, "feedback_5_"+r.ID); !asked || len(b.texts(r.ChatID)) != 1 {
+		t.Fatalf("после тихих часов просьба об оценке: %q", b.texts(r.ChatID))
+	}
+}
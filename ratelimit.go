@@ -0,0 +1,79 @@
+package main
+
+import (
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+const (
+	rateLimitWarnInterval = time.Minute
+	rateLimiterIdleTTL    = 10 * time.Minute
+	callbackDebounce      = time.Second
+)
+
+type userLimiter struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+	warnedAt time.Time
+}
+
+type handledCallback struct {
+	data string
+	at   time.Time
+}
+
+// Доступ только под statesMu, как и к остальным картам состояния
+var (
+	rateLimiters  = make(map[int64]*userLimiter)
+	lastCallbacks = make(map[int64]handledCallback)
+)
+
+// Возвращает разрешение на обработку и нужно ли предупредить пользователя
+func allowRequest(chatID int64) (allowed bool, warn bool) {
+	if isAdmin(chatID) || cfg.RateLimitPerMinute <= 0 {
+		return true, false
+	}
+
+	now := clock.Now()
+	entry, exists := rateLimiters[chatID]
+	if !exists {
+		entry = &userLimiter{
+			limiter: rate.NewLimiter(rate.Limit(float64(cfg.RateLimitPerMinute)/60), cfg.RateLimitBurst),
+		}
+		rateLimiters[chatID] = entry
+	}
+	entry.lastSeen = now
+
+	if entry.limiter.AllowN(now, 1) {
+		return true, false
+	}
+
+	// Предупреждаем не чаще раза в минуту, чтобы не отвечать на каждый спам
+	if now.Sub(entry.warnedAt) < rateLimitWarnInterval {
+		return false, false
+	}
+	entry.warnedAt = now
+	return false, true
+}
+
+func pruneRateLimiters(now time.Time) {
+	for chatID, entry := range rateLimiters {
+		if now.Sub(entry.lastSeen) > rateLimiterIdleTTL {
+			delete(rateLimiters, chatID)
+		}
+	}
+	for chatID, last := range lastCallbacks {
+		if now.Sub(last.at) > callbackDebounce {
+			delete(lastCallbacks, chatID)
+		}
+	}
+}
+
+// Та же кнопка повторно в пределах callbackDebounce — двойной тап, а не новое действие
+func isDuplicateCallback(chatID int64, data string) bool {
+	now := clock.Now()
+	last, exists := lastCallbacks[chatID]
+	lastCallbacks[chatID] = handledCallback{data: data, at: now}
+	return exists && last.data == data && now.Sub(last.at) < callbackDebounce
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"log/slog"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const reminderCheckInterval = time.Minute
+
+// Напоминание уходит один раз: флаг ReminderSent хранится в файле броней,
+// поэтому перезапуск бота не рассылает напоминания повторно
+func runReminders(bot Sender) {
+	if cfg.ReminderBefore <= 0 {
+		return
+	}
+	slog.Info("Напоминания о визите включены", "before", cfg.ReminderBefore)
+
+	for {
+		sendDueReminders(bot)
+		time.Sleep(reminderCheckInterval)
+	}
+}
+
+func sendDueReminders(bot Sender) {
+	statesMu.Lock()
+	defer statesMu.Unlock()
+	now := clock.Now()
+	var reminded []Reservation
+	for _, r := range dueReminders(now) {
+		if !isChatBlocked(r.ChatID) {
+			text := tr(r.Lang, "reminder", r.Code, venueByID(r.VenueID).Name, r.Date, r.Time, r.Guests)
+			if r.Table != "" {
+				text += tr(r.Lang, "table_line", r.Table)
+			}
+			msg := tgbotapi.NewMessage(r.ChatID, text)
+			deliver(bot, r.ChatID, "напоминание о визите", msg)
+		}
+		// Отмечаем и неудачные отправки, чтобы не повторять их каждую минуту
+		r.ReminderSent = true
+		reservations[r.ID] = r
+		reminded = append(reminded, r)
+	}
+	if len(reminded) > 0 {
+		// Флаг в памяти уже стоит, так что до перезапуска повторов не будет
+		if err := updateReservationsInFile(reminded...); err != nil {
+			slog.Error("Не удалось сохранить отметку о напоминаниях", "err", err)
+			storageErrors.Inc()
+		}
+		slog.Info("Отправлены напоминания о визите", "count", len(reminded))
+	}
+}
+
+// Брони гостей, до визита по которым осталось не больше ReminderBefore.
+// В тихие часы не уходит ничего, даже просроченное (например, после перезапуска ночью):
+// такое напоминание отправится в конце окна, а если визит к тому времени начался — не отправится
+func dueReminders(now time.Time) []Reservation {
+	if cfg.QuietHours.contains(now) {
+		return nil
+	}
+	var due []Reservation
+	for _, r := range reservations {
+		if r.ReminderSent || r.CreatedByStaff || r.Status != statusConfirmed {
+			continue
+		}
+		visit, err := reservationDateTime(r)
+		if err != nil || !visit.After(now) || now.Before(reminderTime(visit)) {
+			continue
+		}
+		// Бронь оформлена уже внутри окна — гость и так помнит о визите
+		if visit.Sub(r.CreatedAt) <= cfg.ReminderBefore {
+			continue
+		}
+		due = append(due, r)
+	}
+	return due
+}
+
+// Время напоминания, попавшее в QUIET_HOURS, переносится на конец тихих часов.
+// Если к тому времени визит уже начнется, напоминание уходит перед началом окна;
+// бронь, оформленная уже внутри окна, в этом случае остается без напоминания
+func reminderTime(visit time.Time) time.Time {
+	at := visit.Add(-cfg.ReminderBefore)
+	if !cfg.QuietHours.contains(at) {
+		return at
+	}
+	start, end := cfg.QuietHours.window(at)
+	if end.Before(visit) {
+		return end
+	}
+	return start.Add(-reminderCheckInterval)
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// Сколько напоминаний о брони r получил ее гость
+func (b *testBot) reminders(r Reservation) int {
+	prefix, _, _ := strings.Cut(tr(r.Lang, "reminder", r.Code, venueByID(r.VenueID).Name, r.Date, r.Time, r.Guests), "\n")
+	return b.count(r.ChatID, prefix)
+}
+
+func TestReminderSentSurvivesRestart(t *testing.T) {
+	b := setupTest(t, "10.10.2026 12:00", map[string]string{"REMINDER_BEFORE": "3h"})
+	sent := addReservation(t, Reservation{ChatID: 101, Date: "14.10.2026", Time: "19:00", ReminderSent: true})
+	pending := addReservation(t, Reservation{ChatID: 102, Date: "14.10.2026", Time: "19:00"})
+
+	// Перезапуск незадолго до визита: флаг читается из файла
+	b.clock.set(time.Date(2026, 10, 14, 16, 30, 0, 0, loc))
+	reloadReservations(t)
+	if !reservations[sent.ID].ReminderSent || reservations[pending.ID].ReminderSent {
+		t.Fatalf("флаги после загрузки: %v, %v", reservations[sent.ID].ReminderSent, reservations[pending.ID].ReminderSent)
+	}
+
+	sendDueReminders(b)
+	if n := b.reminders(sent); n != 0 {
+		t.Fatalf("повторное напоминание после перезапуска: %d", n)
+	}
+	if n := b.reminders(pending); n != 1 {
+		t.Fatalf("напоминаний по второй брони %d, ожидалось одно", n)
+	}
+
+	// Еще один перезапуск и проход через минуту: флаг второй брони тоже сохранен
+	b.clock.advance(reminderCheckInterval)
+	reloadReservations(t)
+	sendDueReminders(b)
+	if n := b.reminders(pending); n != 1 || !reservations[pending.ID].ReminderSent {
+		t.Fatalf("после второго перезапуска напоминаний %d", n)
+	}
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf16"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	sendAttempts = 3
+	// Дольше не ждём: сообщение успеет потерять смысл
+	maxRetryAfter  = 30 * time.Second
+	retryQueueSize = 1000
+)
+
+// Sender — то, что обработчикам нужно от Telegram; *tgbotapi.BotAPI ему
+// удовлетворяет, а в тестах его можно подменить заглушкой
+type Sender interface {
+	Send(c tgbotapi.Chattable) (tgbotapi.Message, error)
+	Request(c tgbotapi.Chattable) (*tgbotapi.APIResponse, error)
+}
+
+// Чаты, где бот получил 403: гость заблокировал бота или удалил аккаунт.
+// Своя блокировка, потому что рассылка шлёт сообщения без statesMu
+var (
+	blockedMu    sync.Mutex
+	blockedChats = make(map[int64]bool)
+)
+
+// Обработчики отправляют под statesMu, поэтому после ответа 429 ждать на месте нельзя:
+// сообщение уходит в очередь, которую runSendRetries повторяет без блокировки.
+// Пока у чата есть сообщения в очереди, следующие встают за ними, чтобы не сбить порядок
+var errSendQueued = errors.New("отправка отложена из-за лимита Telegram")
+
+type queuedSend struct {
+	chatID  int64
+	what    string
+	c       tgbotapi.Chattable
+	at      time.Time
+	attempt int
+	onSent  func(tgbotapi.Message)
+}
+
+var (
+	retryMu      sync.Mutex
+	retryQueue   = make(chan queuedSend, retryQueueSize)
+	queuedByChat = make(map[int64]int)
+)
+
+// Отправляет c сразу или ставит в очередь повторов (тогда возвращает errSendQueued).
+// onSent получает отправленное сообщение; из очереди он вызывается под statesMu
+func safeSend(bot Sender, chatID int64, what string, c tgbotapi.Chattable, onSent func(tgbotapi.Message)) error {
+	retryMu.Lock()
+	waiting := queuedByChat[chatID] > 0
+	retryMu.Unlock()
+	if waiting {
+		return enqueueSend(queuedSend{chatID: chatID, what: what, c: c, at: time.Now(), attempt: 1, onSent: onSent}, errSendQueued)
+	}
+
+	sent, err := bot.Send(c)
+	if err == nil {
+		if onSent != nil {
+			onSent(sent)
+		}
+		return nil
+	}
+	if wait, ok := retryAfter(err); ok {
+		slog.Warn("Превышен лимит Telegram, отправка отложена", "chatID", chatID, "what", what, "retryAfter", wait)
+		return enqueueSend(queuedSend{chatID: chatID, what: what, c: c, at: time.Now().Add(wait), attempt: 2, onSent: onSent}, err)
+	}
+	return err
+}
+
+// Если очередь переполнена, отправка считается неудавшейся с ошибкой failErr
+func enqueueSend(item queuedSend, failErr error) error {
+	retryMu.Lock()
+	defer retryMu.Unlock()
+	select {
+	case retryQueue <- item:
+		queuedByChat[item.chatID]++
+		return errSendQueued
+	default:
+		slog.Error("Очередь повторных отправок переполнена", "chatID", item.chatID, "what", item.what)
+		return failErr
+	}
+}
+
+// Пауза, которую Telegram просит выдержать перед повтором, если она не слишком длинная
+func retryAfter(err error) (time.Duration, bool) {
+	var apiErr *tgbotapi.Error
+	if !errors.As(err, &apiErr) || apiErr.RetryAfter <= 0 {
+		return 0, false
+	}
+	wait := time.Duration(apiErr.RetryAfter) * time.Second
+	return wait, wait <= maxRetryAfter
+}
+
+// Единственная горутина повторов: ждёт, ничего не блокируя, и сохраняет порядок очереди
+func runSendRetries(bot Sender) {
+	for item := range retryQueue {
+		var (
+			sent tgbotapi.Message
+			err  error
+		)
+		for ; item.attempt <= sendAttempts; item.attempt++ {
+			time.Sleep(time.Until(item.at))
+			if sent, err = bot.Send(item.c); err == nil {
+				break
+			}
+			wait, ok := retryAfter(err)
+			if !ok {
+				break
+			}
+			slog.Warn("Превышен лимит Telegram, повтор отправки", "chatID", item.chatID, "what", item.what,
+				"retryAfter", wait, "attempt", item.attempt)
+			item.at = time.Now().Add(wait)
+		}
+
+		if err != nil {
+			reportSendError(item.chatID, item.what, err)
+		} else if item.onSent != nil {
+			statesMu.Lock()
+			item.onSent(sent)
+			statesMu.Unlock()
+		}
+
+		retryMu.Lock()
+		if queuedByChat[item.chatID]--; queuedByChat[item.chatID] <= 0 {
+			delete(queuedByChat, item.chatID)
+		}
+		retryMu.Unlock()
+	}
+}
+
+// Отправка с логированием ошибки; what описывает, что именно не удалось отправить.
+// Отложенная из-за лимита отправка ошибкой не считается: о ней сообщит очередь
+func deliver(bot Sender, chatID int64, what string, c tgbotapi.Chattable) error {
+	err := safeSend(bot, chatID, what, c, nil)
+	if err == nil || errors.Is(err, errSendQueued) {
+		return nil
+	}
+	reportSendError(chatID, what, err)
+	return err
+}
+
+func reportSendError(chatID int64, what string, err error) {
+	sendErrors.Inc()
+	if isBlockedError(err) {
+		markChatBlocked(chatID, true)
+		slog.Info("Пользователь заблокировал бота", "chatID", chatID, "what", what)
+		return
+	}
+	slog.Error("Ошибка отправки сообщения", "chatID", chatID, "what", what, "err", err)
+}
+
+func isBlockedError(err error) bool {
+	var apiErr *tgbotapi.Error
+	return errors.As(err, &apiErr) && apiErr.Code == http.StatusForbidden
+}
+
+func markChatBlocked(chatID int64, blocked bool) {
+	blockedMu.Lock()
+	defer blockedMu.Unlock()
+	if blocked {
+		blockedChats[chatID] = true
+	} else {
+		delete(blockedChats, chatID)
+	}
+}
+
+func isChatBlocked(chatID int64) bool {
+	blockedMu.Lock()
+	defer blockedMu.Unlock()
+	return blockedChats[chatID]
+}
+
+// Telegram считает длину сообщения в UTF-16
+const maxMessageLength = 4096
+
+// Длинный текст отправляется несколькими сообщениями, разрезанными по строкам
+func sendLong(bot Sender, chatID int64, text string) {
+	for _, chunk := range splitMessage(text, maxMessageLength) {
+		if deliver(bot, chatID, "длинное сообщение", tgbotapi.NewMessage(chatID, chunk)) != nil {
+			return
+		}
+	}
+}
+
+func splitMessage(text string, limit int) []string {
+	var chunks, lines []string
+	size := 0
+	flush := func() {
+		if len(lines) > 0 {
+			chunks = append(chunks, strings.Join(lines, "\n"))
+			lines, size = nil, 0
+		}
+	}
+
+	for _, line := range strings.Split(text, "\n") {
+		// Строку длиннее лимита приходится резать посимвольно
+		for utf16Len(line) > limit {
+			flush()
+			head, rest := cutUTF16(line, limit)
+			chunks = append(chunks, head)
+			line = rest
+		}
+
+		lineSize := utf16Len(line)
+		if len(lines) > 0 && size+1+lineSize > limit {
+			flush()
+		}
+		if len(lines) > 0 {
+			size++
+		}
+		lines = append(lines, line)
+		size += lineSize
+	}
+	flush()
+	return chunks
+}
+
+func utf16Len(s string) int {
+	n := 0
+	for _, r := range s {
+		n += utf16.RuneLen(r)
+	}
+	return n
+}
+
+// Делит строку так, чтобы первая часть занимала не больше limit единиц UTF-16
+func cutUTF16(s string, limit int) (string, string) {
+	n := 0
+	for i, r := range s {
+		if n+utf16.RuneLen(r) > limit {
+			return s[:i], s[i:]
+		}
+		n += utf16.RuneLen(r)
+	}
+	return s, ""
+}
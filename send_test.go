@@ -0,0 +1,202 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"unicode/utf8"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Заглушка Telegram: запоминает все исходящие сообщения; fail позволяет
+// вернуть ошибку на выбранное сообщение. Рассылка и очистка шлют из своих горутин
+type fakeSender struct {
+	mu       sync.Mutex
+	sent     []tgbotapi.Chattable
+	requests []tgbotapi.Chattable
+	lastID   int
+	fail     func(c tgbotapi.Chattable) error
+}
+
+func (f *fakeSender) Send(c tgbotapi.Chattable) (tgbotapi.Message, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.fail != nil {
+		if err := f.fail(c); err != nil {
+			return tgbotapi.Message{}, err
+		}
+	}
+	f.sent = append(f.sent, c)
+	f.lastID++
+	return tgbotapi.Message{MessageID: f.lastID}, nil
+}
+
+func (f *fakeSender) Request(c tgbotapi.Chattable) (*tgbotapi.APIResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests = append(f.requests, c)
+	return &tgbotapi.APIResponse{Ok: true}, nil
+}
+
+// Отправленное сообщение с текстом и разметкой; файлы и прочее — только с chatID
+type sentMessage struct {
+	ChatID int64
+	Text   string
+	Markup interface{}
+}
+
+func (f *fakeSender) messages(chatID int64) []sentMessage {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var list []sentMessage
+	for _, c := range f.sent {
+		var m sentMessage
+		switch c := c.(type) {
+		case tgbotapi.MessageConfig:
+			m = sentMessage{ChatID: c.ChatID, Text: c.Text, Markup: c.ReplyMarkup}
+		case tgbotapi.EditMessageTextConfig:
+			m = sentMessage{ChatID: c.ChatID, Text: c.Text}
+			if c.ReplyMarkup != nil {
+				m.Markup = *c.ReplyMarkup
+			}
+		case tgbotapi.DocumentConfig:
+			m = sentMessage{ChatID: c.ChatID}
+		case tgbotapi.PhotoConfig:
+			m = sentMessage{ChatID: c.ChatID}
+		default:
+			continue
+		}
+		if m.ChatID == chatID {
+			list = append(list, m)
+		}
+	}
+	return list
+}
+
+func (f *fakeSender) texts(chatID int64) []string {
+	var texts []string
+	for _, m := range f.messages(chatID) {
+		if m.Text != "" {
+			texts = append(texts, m.Text)
+		}
+	}
+	return texts
+}
+
+// Есть ли среди сообщений чату текст, содержащий want
+func (f *fakeSender) received(chatID int64, want string) bool {
+	for _, text := range f.texts(chatID) {
+		if strings.Contains(text, want) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *fakeSender) lastText(chatID int64) string {
+	texts := f.texts(chatID)
+	if len(texts) == 0 {
+		return ""
+	}
+	return texts[len(texts)-1]
+}
+
+// Данные кнопки с префиксом prefix из последнего сообщения с такой кнопкой
+func (f *fakeSender) button(chatID int64, prefix string) (string, bool) {
+	list := f.messages(chatID)
+	for i := len(list) - 1; i >= 0; i-- {
+		markup, ok := list[i].Markup.(tgbotapi.InlineKeyboardMarkup)
+		if !ok {
+			continue
+		}
+		for _, row := range markup.InlineKeyboard {
+			for _, b := range row {
+				if b.CallbackData != nil && strings.HasPrefix(*b.CallbackData, prefix) {
+					return *b.CallbackData, true
+				}
+			}
+		}
+	}
+	return "", false
+}
+
+// Данные всех кнопок последнего сообщения чату
+func (f *fakeSender) lastButtons(chatID int64) []string {
+	list := f.messages(chatID)
+	if len(list) == 0 {
+		return nil
+	}
+	markup, ok := list[len(list)-1].Markup.(tgbotapi.InlineKeyboardMarkup)
+	if !ok {
+		return nil
+	}
+	var data []string
+	for _, row := range markup.InlineKeyboard {
+		for _, b := range row {
+			if b.CallbackData != nil {
+				data = append(data, *b.CallbackData)
+			}
+		}
+	}
+	return data
+}
+
+func (f *fakeSender) reset() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.sent = nil
+	f.requests = nil
+}
+
+func TestSendLongSplitsSyntheticList(t *testing.T) {
+	b := setupTest(t, "14.10.2026 12:00", nil)
+	var lines []string
+	for i := 0; i < 600; i++ {
+		// Эмодзи занимает две единицы UTF-16, на них и считает лимит Telegram
+		lines = append(lines, fmt.Sprintf("🍽 %03d. 19:00 — Анна Иванова, гостей: 4, тел.: +7 999 123-45-67", i))
+	}
+	// Одна строка длиннее лимита режется посимвольно
+	lines = append(lines, strings.Repeat("я🙂", maxMessageLength))
+	text := strings.Join(lines, "\n")
+
+	sendLong(b, testAdminID, text)
+
+	chunks := b.texts(testAdminID)
+	if len(chunks) < 2 {
+		t.Fatalf("длинный список ушел %d сообщениями", len(chunks))
+	}
+	for i, chunk := range chunks {
+		if n := utf16Len(chunk); n > maxMessageLength || n == 0 {
+			t.Fatalf("сообщение %d длиной %d UTF-16", i, n)
+		}
+		if !utf8.ValidString(chunk) {
+			t.Fatalf("сообщение %d разрезано посреди символа", i)
+		}
+	}
+	// Порядок сохранен, строки не потеряны: длинная строка склеивается без разделителя
+	joined := strings.Join(chunks, "\n")
+	if strings.ReplaceAll(joined, "\n", "") != strings.ReplaceAll(text, "\n", "") {
+		t.Fatal("склеенные сообщения не совпадают с исходным текстом")
+	}
+	for _, line := range lines[:600] {
+		if !strings.Contains(joined, line) {
+			t.Fatalf("строка разрезана или потеряна: %q", line)
+		}
+	}
+}
+
+func TestSendLongStopsAfterFailure(t *testing.T) {
+	b := setupTest(t, "14.10.2026 12:00", nil)
+	b.fail = func(c tgbotapi.Chattable) error {
+		if len(b.sent) == 1 {
+			return &tgbotapi.Error{Code: 400, Message: "Bad Request"}
+		}
+		return nil
+	}
+	sendLong(b, testAdminID, strings.Repeat(strings.Repeat("x", 100)+"\n", 200))
+	if n := len(b.texts(testAdminID)); n != 1 {
+		t.Fatalf("после ошибки отправлено %d сообщений, ожидалось только первое", n)
+	}
+}
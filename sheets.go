@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2/google"
+)
+
+const (
+	sheetsAPIBase    = "https://sheets.googleapis.com/v4/spreadsheets/"
+	sheetsQueueSize  = 100
+	sheetsReqTimeout = 15 * time.Second
+)
+
+type sheetsClient struct {
+	http    *http.Client
+	sheetID string
+	sheet   string
+}
+
+type sheetValues struct {
+	Values [][]string `json:"values"`
+}
+
+// Подключает выгрузку в Google Таблицу, если заданы ID таблицы и ключ сервисного аккаунта
+func startSheetsSync(c Config) {
+	if c.GoogleSheetID == "" {
+		return
+	}
+
+	credentials, err := os.ReadFile(c.GoogleCredentialsFile)
+	if err != nil {
+		slog.Error("Не удалось прочитать ключ Google", "path", c.GoogleCredentialsFile, "err", err)
+		return
+	}
+	jwt, err := google.JWTConfigFromJSON(credentials, "https://www.googleapis.com/auth/spreadsheets")
+	if err != nil {
+		slog.Error("Некорректный ключ Google", "err", err)
+		return
+	}
+
+	client := &sheetsClient{
+		http:    jwt.Client(context.Background()),
+		sheetID: c.GoogleSheetID,
+		sheet:   c.GoogleSheetName,
+	}
+	client.http.Timeout = sheetsReqTimeout
+
+	// Одна горутина сохраняет порядок событий по каждой брони
+	queue := make(chan reservationEvent, sheetsQueueSize)
+	go func() {
+		for event := range queue {
+			if err := client.sync(event); err != nil {
+				slog.Error("Ошибка синхронизации с Google Таблицей", "reservationID", event.Reservation.ID, "event", event.Type, "err", err)
+			}
+		}
+	}()
+
+	eventSinks = append(eventSinks, func(event reservationEvent) {
+		select {
+		case queue <- event:
+		default:
+			slog.Warn("Очередь Google Таблицы переполнена, событие пропущено", "reservationID", event.Reservation.ID)
+		}
+	})
+	slog.Info("Синхронизация с Google Таблицей включена", "sheet", c.GoogleSheetName)
+}
+
+func (c *sheetsClient) sync(event reservationEvent) error {
+	r := event.Reservation
+	if event.Type == eventDeleted {
+		r.Status = statusCancelled
+	}
+
+	ids, err := c.get(c.rangeRef("A:A"))
+	if err != nil {
+		return err
+	}
+	if len(ids) == 0 {
+		if err := c.append([][]string{reservationHeaders}); err != nil {
+			return err
+		}
+	}
+
+	for i, row := range ids {
+		if len(row) > 0 && row[0] == r.ID {
+			return c.put(c.rangeRef(fmt.Sprintf("A%d", i+1)), [][]string{reservationRecord(r)})
+		}
+	}
+	return c.append([][]string{reservationRecord(r)})
+}
+
+func (c *sheetsClient) rangeRef(cells string) string {
+	return "'" + strings.ReplaceAll(c.sheet, "'", "''") + "'!" + cells
+}
+
+func (c *sheetsClient) valuesURL(rangeRef, suffix string) string {
+	return sheetsAPIBase + url.PathEscape(c.sheetID) + "/values/" + url.PathEscape(rangeRef) + suffix
+}
+
+func (c *sheetsClient) get(rangeRef string) ([][]string, error) {
+	var result sheetValues
+	if err := c.do(http.MethodGet, c.valuesURL(rangeRef, ""), nil, &result); err != nil {
+		return nil, err
+	}
+	return result.Values, nil
+}
+
+func (c *sheetsClient) append(values [][]string) error {
+	target := c.valuesURL(c.rangeRef("A1"), ":append?valueInputOption=RAW&insertDataOption=INSERT_ROWS")
+	return c.do(http.MethodPost, target, sheetValues{Values: values}, nil)
+}
+
+func (c *sheetsClient) put(rangeRef string, values [][]string) error {
+	return c.do(http.MethodPut, c.valuesURL(rangeRef, "?valueInputOption=RAW"), sheetValues{Values: values}, nil)
+}
+
+func (c *sheetsClient) do(method, target string, body, result interface{}) error {
+	var payload io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		payload = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, target, payload)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("Sheets API %s: %s", resp.Status, strings.TrimSpace(string(message)))
+	}
+	if result != nil {
+		return json.NewDecoder(resp.Body).Decode(result)
+	}
+	return nil
+}
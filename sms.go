@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	smsQueueSize      = 50
+	smsTimeout        = 10 * time.Second
+	twilioAPITemplate = "https://api.twilio.com/2010-04-01/Accounts/%s/Messages.json"
+)
+
+// Провайдер SMS возвращает сырой ответ сервиса, чтобы его можно было залогировать
+type smsProvider interface {
+	Send(to, text string) (string, error)
+}
+
+type twilioProvider struct {
+	client     *http.Client
+	endpoint   string
+	accountSID string
+	authToken  string
+	from       string
+}
+
+func (p twilioProvider) Send(to, text string) (string, error) {
+	form := url.Values{"To": {to}, "From": {p.from}, "Body": {text}}
+	req, err := http.NewRequest(http.MethodPost, p.endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.SetBasicAuth(p.accountSID, p.authToken)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 2048))
+	if resp.StatusCode/100 != 2 {
+		return string(body), fmt.Errorf("ответ %s", resp.Status)
+	}
+	return string(body), nil
+}
+
+func newSMSProvider(c Config) (smsProvider, error) {
+	switch c.SMSProvider {
+	case "twilio":
+		endpoint := c.SMSAPIURL
+		if endpoint == "" {
+			endpoint = fmt.Sprintf(twilioAPITemplate, url.PathEscape(c.SMSAccountSID))
+		}
+		return twilioProvider{
+			client:     &http.Client{Timeout: smsTimeout},
+			endpoint:   endpoint,
+			accountSID: c.SMSAccountSID,
+			authToken:  c.SMSAuthToken,
+			from:       c.SMSFrom,
+		}, nil
+	}
+	return nil, fmt.Errorf("неизвестный SMS_PROVIDER: %q", c.SMSProvider)
+}
+
+// Отправляет гостю SMS с подтверждением новой брони, если задан SMS_PROVIDER
+func startSMSConfirmations(c Config) {
+	if c.SMSProvider == "" {
+		return
+	}
+	provider, err := newSMSProvider(c)
+	if err != nil {
+		slog.Error("SMS-подтверждения отключены", "err", err)
+		return
+	}
+
+	queue := make(chan Reservation, smsQueueSize)
+	go func() {
+		for r := range queue {
+			sendSMSConfirmation(provider, r, c.ManagerPhone)
+		}
+	}()
+
+	eventSinks = append(eventSinks, func(event reservationEvent) {
+		// Брони, ждущие администратора, еще не подтверждены
+		if event.Type != eventCreated || event.Reservation.Status != statusConfirmed {
+			return
+		}
+		select {
+		case queue <- event.Reservation:
+		default:
+			slog.Warn("Очередь SMS переполнена, подтверждение пропущено", "reservationID", event.Reservation.ID)
+		}
+	})
+	slog.Info("SMS-подтверждения включены", "provider", c.SMSProvider)
+}
+
+func sendSMSConfirmation(provider smsProvider, r Reservation, managerPhone string) {
+	to, err := normalizePhone(r.Phone)
+	if err != nil {
+		slog.Warn("Не удалось привести номер к E.164 для SMS", "reservationID", r.ID, "err", err)
+		return
+	}
+
+	text := tr(r.Lang, "sms_confirmed", venueByID(r.VenueID).Name, r.Code, r.Date, r.Time, r.Guests, managerPhone)
+	response, err := provider.Send(to, text)
+	if err != nil {
+		slog.Error("Ошибка отправки SMS", "reservationID", r.ID, "err", err, "response", response)
+		return
+	}
+	slog.Info("SMS-подтверждение отправлено", "reservationID", r.ID, "response", response)
+}
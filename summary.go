@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+)
+
+func runDailySummary(bot Sender) {
+	if !cfg.DailySummaryEnabled || cfg.DryRun {
+		return
+	}
+
+	for {
+		now := clock.Now()
+		today := truncateToDay(now)
+		trigger := summaryTrigger(today)
+
+		// Если бот перезапустился после времени отправки, досылаем сводку,
+		// но только если за сегодня она еще не уходила
+		if now.Before(trigger) {
+			time.Sleep(trigger.Sub(now))
+		} else if lastDailySummaryDate() == today.Format("02.01.2006") {
+			time.Sleep(summaryTrigger(today.AddDate(0, 0, 1)).Sub(now))
+			continue
+		}
+
+		statesMu.Lock()
+		date := clock.Now().Format("02.01.2006")
+		if lastDailySummaryDate() != date {
+			// У администратора заведения в сводке только его брони
+			for _, adminID := range allAdminChatIDs() {
+				sendLong(bot, adminID, buildDailySummary(adminID, date))
+			}
+			saveDailySummaryDate(date)
+			slog.Info("Ежедневная сводка отправлена", "date", date)
+		}
+		statesMu.Unlock()
+	}
+}
+
+// DAILY_SUMMARY_TIME внутри QUIET_HOURS сдвигается на конец тихих часов
+func summaryTrigger(day time.Time) time.Time {
+	return cfg.QuietHours.nextAllowed(day.Add(time.Duration(cfg.DailySummaryMinutes) * time.Minute))
+}
+
+// В итогах только подтвержденные брони; ждущие одобрения или предоплаты идут
+// отдельным списком, а гости, которых уже посадили, в сводку не попадают
+func buildDailySummary(adminID int64, date string) string {
+	var confirmed, pending []Reservation
+	for _, r := range getReservationsForDate(adminID, date) {
+		switch r.Status {
+		case statusConfirmed:
+			confirmed = append(confirmed, r)
+		case statusPending:
+			pending = append(pending, r)
+		}
+	}
+	if len(confirmed) == 0 && len(pending) == 0 {
+		return fmt.Sprintf("☀️ Сводка на %s: бронирований нет.", date)
+	}
+
+	covers := 0
+	for _, r := range confirmed {
+		covers += r.Guests
+	}
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("☀️ Сводка на %s\nБронирований: %d, гостей: %d\n", date, len(confirmed), covers))
+	writeSummaryLines(&sb, confirmed)
+	if len(pending) > 0 {
+		sb.WriteString(fmt.Sprintf("\n\n🕓 Не подтверждены (%d):\n", len(pending)))
+		writeSummaryLines(&sb, pending)
+	}
+	return sb.String()
+}
+
+func writeSummaryLines(sb *strings.Builder, list []Reservation) {
+	for _, r := range list {
+		sb.WriteString(fmt.Sprintf("\n%s — %s, гостей: %d, тел.: %s", r.Time, adminField(r.Name, adminNameLimit), r.Guests, formatPhone(r.Phone)))
+		if r.Comment != "" && r.Comment != "-" {
+			sb.WriteString(fmt.Sprintf("\n   Комментарий: %s", adminField(r.Comment, adminCommentLimit)))
+		}
+		sb.WriteString(strings.ReplaceAll(venueLine(r), "\n", "\n   "))
+	}
+}
+
+func lastDailySummaryDate() string {
+	data, err := os.ReadFile(cfg.DailySummaryStateFile)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+func saveDailySummaryDate(date string) {
+	if err := os.WriteFile(cfg.DailySummaryStateFile, []byte(date+"\n"), 0644); err != nil {
+		slog.Error("Ошибка сохранения даты ежедневной сводки", "err", err)
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Сколько помним, какому гостю принадлежит пересланный вопрос
+const supportThreadTTL = 7 * 24 * time.Hour
+
+const supportQuestionTitle = "💬 Вопрос от гостя"
+
+// Сообщение с вопросом определяется чатом администратора и ID сообщения в нём
+type supportKey struct {
+	AdminID   int64
+	MessageID int
+}
+
+type supportThread struct {
+	ChatID int64
+	At     time.Time
+}
+
+// Куда отправлять ответы администраторов на пересланные вопросы
+var supportThreads = make(map[supportKey]supportThread)
+
+func showContactOptions(bot Sender, chatID int64) {
+	// Карточка позволяет позвонить или сохранить номер одним нажатием;
+	// текст с номером ниже остается для клиентов, где карточка выглядит плохо
+	if phone, err := normalizePhone(cfg.ManagerPhone); err == nil {
+		deliver(bot, chatID, "карточка контакта", tgbotapi.NewContact(chatID, phone, cfg.ManagerName))
+	}
+
+	msg := tgbotapi.NewMessage(chatID, t(chatID, "contact_phone", cfg.ManagerPhone))
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData(t(chatID, "btn_ask_question"), "support_ask"),
+	))
+	deliver(bot, chatID, "контакты", msg)
+}
+
+func askSupportQuestion(bot Sender, chatID int64) {
+	state := userStates[chatID]
+	state.State = stateWaitingForSupport
+	userStates[chatID] = state
+	sendPrompt(bot, chatID, t(chatID, "ask_question"))
+}
+
+func forwardSupportMessage(bot Sender, chatID int64, message *tgbotapi.Message) {
+	question := strings.TrimSpace(message.Text)
+	if question == "" {
+		sendPrompt(bot, chatID, t(chatID, "ask_question"))
+		return
+	}
+
+	name := strings.TrimSpace(message.From.FirstName + " " + message.From.LastName)
+	text := fmt.Sprintf("%s\nИмя: %s", supportQuestionTitle, adminField(name, adminNameLimit))
+	if message.From.UserName != "" {
+		text += "\nTelegram: @" + message.From.UserName
+	}
+	text += "\n\n" + question + "\n\nОтветьте на это сообщение, чтобы написать гостю."
+
+	forwarded := 0
+	for _, adminID := range cfg.AdminChatIDs {
+		err := safeSend(bot, adminID, "вопрос гостя", tgbotapi.NewMessage(adminID, text), func(sent tgbotapi.Message) {
+			supportThreads[supportKey{adminID, sent.MessageID}] = supportThread{ChatID: chatID, At: clock.Now()}
+		})
+		if err != nil && !errors.Is(err, errSendQueued) {
+			sendErrors.Inc()
+			slog.Error("Ошибка пересылки вопроса администратору", "chatID", adminID, "err", err)
+			continue
+		}
+		forwarded++
+	}
+
+	clearUserState(chatID)
+	if forwarded == 0 {
+		sendMessage(bot, chatID, t(chatID, "question_failed", cfg.ManagerPhone), false)
+	} else {
+		sendMessage(bot, chatID, t(chatID, "question_sent"), false)
+	}
+	showMainMenu(bot, chatID, hasActiveReservations(chatID))
+}
+
+// Ответ администратора реплаем на пересланный вопрос уходит гостю
+func relaySupportReply(bot Sender, message *tgbotapi.Message) bool {
+	original := message.ReplyToMessage
+	if original == nil || original.From == nil || original.From.ID != botID {
+		return false
+	}
+
+	adminID := message.Chat.ID
+	thread, ok := supportThreads[supportKey{adminID, original.MessageID}]
+	if !ok {
+		// Вопрос старше supportThreadTTL или пришёл до перезапуска бота
+		if strings.HasPrefix(original.Text, supportQuestionTitle) {
+			sendMessage(bot, adminID, "Вопрос слишком старый: не удалось определить гостя. Свяжитесь с ним по телефону.", false)
+			return true
+		}
+		return false
+	}
+
+	answer := strings.TrimSpace(message.Text)
+	if answer == "" {
+		sendMessage(bot, adminID, "Ответ гостю можно отправить только текстом.", false)
+		return true
+	}
+
+	msg := tgbotapi.NewMessage(thread.ChatID, t(thread.ChatID, "staff_reply", answer))
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData(t(thread.ChatID, "btn_ask_question"), "support_ask"),
+	))
+	if err := deliver(bot, thread.ChatID, "ответ администратора", msg); err != nil {
+		sendMessage(bot, adminID, "Не удалось доставить ответ гостю.", false)
+		return true
+	}
+	sendMessage(bot, adminID, "Ответ отправлен гостю.", false)
+	return true
+}
+
+func pruneSupportThreads(now time.Time) {
+	for key, thread := range supportThreads {
+		if now.Sub(thread.At) > supportThreadTTL {
+			delete(supportThreads, key)
+		}
+	}
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"sort"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	tableNameLimit   = 16
+	tableSuggestions = 6
+)
+
+type tableSpec struct {
+	Name  string
+	Seats int
+}
+
+// Формат: "1:2, 2:2, 3:4, 7:6" — номер стола и число мест за ним
+func parseTableMap(value string) ([]tableSpec, error) {
+	var tables []tableSpec
+	seen := make(map[string]bool)
+	for _, entry := range strings.Split(value, ",") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		name, seats, ok := strings.Cut(entry, ":")
+		name = strings.TrimSpace(name)
+		n, err := strconv.Atoi(strings.TrimSpace(seats))
+		if !ok || err != nil || n <= 0 || name == "" {
+			return nil, fmt.Errorf("ожидалось номер:мест, получено %q", strings.TrimSpace(entry))
+		}
+		if len([]rune(name)) > tableNameLimit {
+			return nil, fmt.Errorf("некорректный номер стола %q", name)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("стол %s указан дважды", name)
+		}
+		seen[name] = true
+		tables = append(tables, tableSpec{Name: name, Seats: n})
+	}
+	return tables, nil
+}
+
+// Другая активная бронь заведения, которая занимает этот стол одновременно с r
+func tableConflict(r Reservation, table string) (Reservation, bool) {
+	visit, err := reservationDateTime(r)
+	if err != nil {
+		return Reservation{}, false
+	}
+	// У старых броней VenueID пустой, поэтому заведения сравниваем после venueByID
+	venueID := venueByID(r.VenueID).ID
+	for _, other := range reservations {
+		if other.ID == r.ID || other.Table != table || other.Date != r.Date ||
+			venueByID(other.VenueID).ID != venueID || !other.Status.isActive() {
+			continue
+		}
+		otherVisit, err := reservationDateTime(other)
+		if err != nil {
+			continue
+		}
+		if gap := visit.Sub(otherVisit); gap < cfg.EventDuration && gap > -cfg.EventDuration {
+			return other, true
+		}
+	}
+	return Reservation{}, false
+}
+
+// Индексы в TableList заведения свободных на время брони столов, где хватает мест;
+// сначала самые маленькие
+func suggestTables(r Reservation) []int {
+	tables := venueByID(r.VenueID).TableList
+	var free []int
+	for i, table := range tables {
+		if table.Seats < r.Guests || table.Name == r.Table {
+			continue
+		}
+		if _, taken := tableConflict(r, table.Name); !taken {
+			free = append(free, i)
+		}
+	}
+	sort.SliceStable(free, func(i, j int) bool { return tables[free[i]].Seats < tables[free[j]].Seats })
+	if len(free) > tableSuggestions {
+		free = free[:tableSuggestions]
+	}
+	return free
+}
+
+func askTable(bot Sender, adminID int64, reservationID string) {
+	r, exists := reservations[reservationID]
+	if !exists || !canSeeReservation(adminID, r) {
+		sendMessage(bot, adminID, "Бронь не найдена.", false)
+		return
+	}
+
+	text := fmt.Sprintf("🍽 Стол для брони #%s: %s %s, гостей: %d.", r.Code, r.Date, r.Time, r.Guests)
+	if r.Table != "" {
+		text += "\nСейчас: №" + r.Table
+	}
+	// В данных кнопки индекс стола, а не номер: номер до 16 символов в UTF-8 вместе
+	// с ID брони не помещается в 64 байта
+	tables := venueByID(r.VenueID).TableList
+	var rows [][]tgbotapi.InlineKeyboardButton
+	var row []tgbotapi.InlineKeyboardButton
+	for _, i := range suggestTables(r) {
+		row = append(row, tgbotapi.NewInlineKeyboardButtonData(
+			fmt.Sprintf("№%s (%d мест)", tables[i].Name, tables[i].Seats), fmt.Sprintf("tableset_%s_%d", r.ID, i)))
+		if len(row) == 3 {
+			rows = append(rows, row)
+			row = nil
+		}
+	}
+	if row != nil {
+		rows = append(rows, row)
+	}
+	if len(tables) > 0 && len(rows) == 0 {
+		text += "\nСвободных столов на это время нет."
+	}
+	if r.Table != "" {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("Снять стол", "tableset_"+r.ID+"_-")))
+	}
+	text += fmt.Sprintf("\nДругой стол: /table %s <номер>", r.Code)
+
+	msg := tgbotapi.NewMessage(adminID, text)
+	if len(rows) > 0 {
+		msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
+	}
+	deliver(bot, adminID, "выбор стола", msg)
+}
+
+// /table <код> — подсказать стол, /table <код> <номер> — назначить, /table <код> - — снять
+func handleTableCommand(bot Sender, adminID int64, args string) {
+	fields := strings.Fields(args)
+	if len(fields) == 0 {
+		sendMessage(bot, adminID, "Использование: /table <код брони> [номер стола или -]", false)
+		return
+	}
+	r, exists := findReservation(fields[0])
+	if !exists || !canSeeReservation(adminID, r) {
+		sendMessage(bot, adminID, fmt.Sprintf("Бронь %s не найдена.", fields[0]), false)
+		return
+	}
+	if len(fields) == 1 {
+		askTable(bot, adminID, r.ID)
+		return
+	}
+	setTable(bot, adminID, r.ID, strings.Join(fields[1:], " "))
+}
+
+// tableset_<id>_<индекс в TableList> или tableset_<id>_- из подсказки askTable
+func handleTableCallback(bot Sender, adminID int64, data string) {
+	if id, ok := strings.CutPrefix(data, "table_"); ok {
+		askTable(bot, adminID, id)
+		return
+	}
+	id, value, ok := strings.Cut(strings.TrimPrefix(data, "tableset_"), "_")
+	if !ok {
+		return
+	}
+	if value == "-" {
+		setTable(bot, adminID, id, value)
+		return
+	}
+	r, exists := reservations[id]
+	tables := venueByID(r.VenueID).TableList
+	index, err := strconv.Atoi(value)
+	if !exists || err != nil || index < 0 || index >= len(tables) {
+		sendMessage(bot, adminID, "Стол не найден, откройте выбор стола заново.", false)
+		return
+	}
+	setTable(bot, adminID, id, tables[index].Name)
+}
+
+func setTable(bot Sender, adminID int64, reservationID, table string) {
+	r, exists := reservations[reservationID]
+	if !exists || !canSeeReservation(adminID, r) {
+		sendMessage(bot, adminID, "Бронь не найдена.", false)
+		return
+	}
+	if !r.Status.isActive() {
+		sendMessage(bot, adminID, fmt.Sprintf("Бронь #%s уже не активна: %s.", r.Code, statusTitles[r.Status]), false)
+		return
+	}
+
+	table = strings.TrimPrefix(strings.TrimSpace(table), "№")
+	if table == "-" {
+		table = ""
+	}
+	if len([]rune(table)) > tableNameLimit || adminField(table, tableNameLimit) != table {
+		sendMessage(bot, adminID, fmt.Sprintf("Номер стола — до %d символов в одну строку.", tableNameLimit), false)
+		return
+	}
+	if table != "" {
+		if other, taken := tableConflict(r, table); taken {
+			sendMessage(bot, adminID, fmt.Sprintf("Стол №%s в это время занят бронью #%s (%s).", table, other.Code, other.Time), false)
+			return
+		}
+	}
+
+	r.Table = table
+	if err := updateReservationsInFile(r); err != nil {
+		slog.Error("Стол не сохранен", "adminID", adminID, "reservationID", r.ID, "err", err)
+		storageErrors.Inc()
+		sendMessage(bot, adminID, fmt.Sprintf("⚠️ Не удалось сохранить стол для брони #%s: %v", r.Code, err), false)
+		return
+	}
+	reservations[r.ID] = r
+	publishReservationEvent(eventUpdated, r)
+	slog.Info("Брони назначен стол", "adminID", adminID, "reservationID", r.ID, "table", table)
+
+	if table == "" {
+		sendMessage(bot, adminID, fmt.Sprintf("Стол для брони #%s снят.", r.Code), false)
+		return
+	}
+	sendMessage(bot, adminID, fmt.Sprintf("🍽 Бронь #%s (%s, %s %s): стол №%s.", r.Code, adminField(r.Name, adminNameLimit), r.Date, r.Time, table), false)
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Venue — одно заведение сети. Без VENUES_FILE заведение одно и собирается
+// из VENUE_* и общих настроек; его ID пустой, как у броней, созданных до
+// появления нескольких заведений
+type Venue struct {
+	ID               string  `json:"id"`
+	Name             string  `json:"name"`
+	Address          string  `json:"address"`
+	Latitude         float64 `json:"latitude"`
+	Longitude        float64 `json:"longitude"`
+	AdminChatIDs     []int64 `json:"admin_chat_ids"`      // пусто — уведомления получают ADMIN_CHAT_IDS
+	MaxGuestsSetting *int    `json:"max_guests_per_slot"` // нет поля — MAX_GUESTS_PER_SLOT, 0 — без ограничения
+	Open             string  `json:"open"`
+	LastBooking      string  `json:"last_booking"`
+	Hours            string  `json:"hours"`        // часы по дням недели в формате WORKING_HOURS
+	Confirmation     string  `json:"confirmation"` // шаблон подтверждения, см. CONFIRMATION_TEMPLATE
+	Tables           string  `json:"tables"`       // столы в формате TABLES
+
+	LocationSet        bool                        `json:"-"`
+	MaxGuestsPerSlot   int                         `json:"-"` // 0 — вместимость слота не ограничена
+	OpenMinutes        int                         `json:"-"`
+	LastBookingMinutes int                         `json:"-"`
+	WeekdayHours       map[time.Weekday]hoursRange `json:"-"`
+	TableList          []tableSpec                 `json:"-"`
+	confirmation       *template.Template
+}
+
+func defaultVenue(c Config) Venue {
+	return Venue{
+		Name:               c.VenueName,
+		Address:            c.VenueAddress,
+		Latitude:           c.VenueLatitude,
+		Longitude:          c.VenueLongitude,
+		LocationSet:        c.VenueLocationSet,
+		MaxGuestsPerSlot:   c.MaxGuestsPerSlot,
+		OpenMinutes:        openingMinutes,
+		LastBookingMinutes: lastBookingMinutes,
+		WeekdayHours:       c.WorkingHours,
+		Confirmation:       c.ConfirmationTemplate,
+		TableList:          c.Tables,
+	}
+}
+
+// Дни без своих часов принимают брони с Open до LastBooking
+func (v Venue) hoursOn(day time.Weekday) hoursRange {
+	if hours, ok := v.WeekdayHours[day]; ok {
+		return hours
+	}
+	return hoursRange{Open: v.OpenMinutes, LastBooking: v.LastBookingMinutes}
+}
+
+func (v Venue) hoursOnDate(date string) hoursRange {
+	day, err := time.ParseInLocation("02.01.2006", date, loc)
+	if err != nil {
+		return hoursRange{Open: v.OpenMinutes, LastBooking: v.LastBookingMinutes}
+	}
+	return v.hoursOn(day.Weekday())
+}
+
+// Файл — JSON-массив заведений; незаданные поля берутся из общих настроек:
+//
+//	[{"id": "center", "name": "На Тверской", "max_guests_per_slot": 0}, {"id": "park", "name": "В парке"}]
+//
+// У max_guests_per_slot отсутствие поля и 0 различаются: без поля действует
+// MAX_GUESTS_PER_SLOT, а 0 снимает ограничение для этого заведения
+func loadVenues(path string, c Config) ([]Venue, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения файла заведений: %w", err)
+	}
+	var venues []Venue
+	if err := json.Unmarshal(data, &venues); err != nil {
+		return nil, fmt.Errorf("ошибка разбора файла заведений %s: %w", path, err)
+	}
+
+	seen := make(map[string]bool)
+	for i := range venues {
+		v := &venues[i]
+		v.ID = strings.TrimSpace(v.ID)
+		if v.ID == "" || !startPayload.MatchString(v.ID) {
+			return nil, fmt.Errorf("заведение %d: некорректный id %q", i+1, v.ID)
+		}
+		if seen[v.ID] {
+			return nil, fmt.Errorf("заведение %s указано дважды", v.ID)
+		}
+		seen[v.ID] = true
+		if v.Name == "" {
+			return nil, fmt.Errorf("заведение %s: не указано название", v.ID)
+		}
+		if v.Latitude != 0 || v.Longitude != 0 {
+			if v.Latitude < -90 || v.Latitude > 90 || v.Longitude < -180 || v.Longitude > 180 {
+				return nil, fmt.Errorf("заведение %s: некорректные координаты", v.ID)
+			}
+			v.LocationSet = true
+		}
+		v.MaxGuestsPerSlot = c.MaxGuestsPerSlot
+		if v.MaxGuestsSetting != nil {
+			if *v.MaxGuestsSetting < 0 {
+				return nil, fmt.Errorf("заведение %s: отрицательный max_guests_per_slot", v.ID)
+			}
+			v.MaxGuestsPerSlot = *v.MaxGuestsSetting
+		}
+
+		v.OpenMinutes, v.LastBookingMinutes = openingMinutes, lastBookingMinutes
+		if v.Open != "" {
+			if v.OpenMinutes, err = parseClock(v.Open); err != nil {
+				return nil, fmt.Errorf("заведение %s, open: %w", v.ID, err)
+			}
+		}
+		if v.LastBooking != "" {
+			if v.LastBookingMinutes, err = parseClock(v.LastBooking); err != nil {
+				return nil, fmt.Errorf("заведение %s, last_booking: %w", v.ID, err)
+			}
+		}
+		if v.OpenMinutes > v.LastBookingMinutes {
+			return nil, fmt.Errorf("заведение %s: open позже last_booking", v.ID)
+		}
+		if v.Confirmation == "" {
+			v.Confirmation = c.ConfirmationTemplate
+		}
+		v.TableList = c.Tables
+		if v.Tables != "" {
+			if v.TableList, err = parseTableMap(v.Tables); err != nil {
+				return nil, fmt.Errorf("заведение %s, tables: %w", v.ID, err)
+			}
+		}
+		v.WeekdayHours = c.WorkingHours
+		if v.Hours != "" {
+			if v.WeekdayHours, err = parseWorkingHours(v.Hours); err != nil {
+				return nil, fmt.Errorf("заведение %s, hours: %w", v.ID, err)
+			}
+		}
+	}
+	return venues, nil
+}
+
+func multiVenue() bool {
+	return len(cfg.Venues) > 1
+}
+
+// Неизвестный ID (в том числе пустой у старых броней) относится к первому заведению
+func venueByID(id string) Venue {
+	for _, v := range cfg.Venues {
+		if v.ID == id {
+			return v
+		}
+	}
+	return cfg.Venues[0]
+}
+
+func findVenue(id string) (Venue, bool) {
+	for _, v := range cfg.Venues {
+		if v.ID == id {
+			return v, true
+		}
+	}
+	return Venue{}, false
+}
+
+// Заведение брони, которую пользователь сейчас оформляет или редактирует
+func stateVenue(state UserState) Venue {
+	if isEditingState(state.State) && state.TempReservation != nil {
+		return venueByID(state.TempReservation.VenueID)
+	}
+	return venueByID(state.VenueID)
+}
+
+func venueAdmins(venueID string) []int64 {
+	if v := venueByID(venueID); len(v.AdminChatIDs) > 0 {
+		return v.AdminChatIDs
+	}
+	return cfg.AdminChatIDs
+}
+
+// Общие администраторы и администраторы всех заведений без повторов
+func allAdminChatIDs() []int64 {
+	seen := make(map[int64]bool)
+	var ids []int64
+	add := func(list []int64) {
+		for _, id := range list {
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+	}
+	add(cfg.AdminChatIDs)
+	for _, v := range cfg.Venues {
+		add(v.AdminChatIDs)
+	}
+	return ids
+}
+
+// Администраторы из ADMIN_CHAT_IDS видят все брони, администраторы заведения — только его
+func canSeeReservation(adminID int64, r Reservation) bool {
+	for _, id := range cfg.AdminChatIDs {
+		if id == adminID {
+			return true
+		}
+	}
+	for _, id := range venueByID(r.VenueID).AdminChatIDs {
+		if id == adminID {
+			return true
+		}
+	}
+	return false
+}
+
+func venuesWithLocation() []Venue {
+	var result []Venue
+	for _, v := range cfg.Venues {
+		if v.LocationSet {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+func venueLine(r Reservation) string {
+	if !multiVenue() {
+		return ""
+	}
+	return "\nЗаведение: " + venueByID(r.VenueID).Name
+}
+
+// Начало мастера бронирования: при нескольких заведениях сначала выбор места,
+// если его не задала метка из ссылки t.me/<bot>?start=<id заведения>
+func startBooking(bot Sender, chatID int64) {
+	state := userStates[chatID]
+	if _, ok := findVenue(state.VenueID); !ok {
+		state.VenueID = ""
+		if v, ok := findVenue(state.Source); ok {
+			state.VenueID = v.ID
+		}
+	}
+	userStates[chatID] = state
+
+	if multiVenue() && state.VenueID == "" {
+		askForVenue(bot, chatID)
+		return
+	}
+	askForName(bot, chatID)
+}
+
+func askForVenue(bot Sender, chatID int64) {
+	state := userStates[chatID]
+	state.State = stateWaitingForVenue
+	userStates[chatID] = state
+
+	msg := tgbotapi.NewMessage(chatID, t(chatID, "ask_venue"))
+	var buttons [][]tgbotapi.InlineKeyboardButton
+	for i, v := range cfg.Venues {
+		title := v.Name
+		if v.Address != "" {
+			title += ", " + v.Address
+		}
+		buttons = append(buttons, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(title, fmt.Sprintf("venue_%d", i)),
+		))
+	}
+	buttons = append(buttons, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData(t(chatID, "btn_cancel"), "cancel"),
+	))
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(buttons...)
+	deliver(bot, chatID, "выбор заведения", msg)
+}
+
+func processVenueSelection(bot Sender, chatID int64, choice string) {
+	state := userStates[chatID]
+	if state.State != stateWaitingForVenue {
+		return
+	}
+	i, err := strconv.Atoi(choice)
+	if err != nil || i < 0 || i >= len(cfg.Venues) {
+		return
+	}
+	state.VenueID = cfg.Venues[i].ID
+	userStates[chatID] = state
+	askForName(bot, chatID)
+}
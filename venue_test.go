@@ -0,0 +1,45 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestVenueSlotLimit(t *testing.T) {
+	setupTest(t, "14.10.2026 12:00", map[string]string{"MAX_GUESTS_PER_SLOT": "30"})
+	path := filepath.Join(t.TempDir(), "venues.json")
+	data := `[
+		{"id": "center", "name": "На Тверской"},
+		{"id": "park", "name": "В парке", "max_guests_per_slot": 0},
+		{"id": "bar", "name": "Бар", "max_guests_per_slot": 12}
+	]`
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	venues, err := loadVenues(path, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]int{"center": 30, "park": 0, "bar": 12}
+	for _, v := range venues {
+		if v.MaxGuestsPerSlot != want[v.ID] {
+			t.Errorf("заведение %s: вместимость слота %d, ожидалось %d", v.ID, v.MaxGuestsPerSlot, want[v.ID])
+		}
+	}
+
+	// Без ограничения слот принимает любое число гостей
+	cfg.Venues = venues
+	addReservation(t, Reservation{VenueID: "park", Date: "15.10.2026", Time: "19:00", Guests: 40})
+	if err := checkSlotCapacity(langRU, Reservation{ID: "next", VenueID: "park", Date: "15.10.2026", Time: "19:00", Guests: 20}); err != nil {
+		t.Fatalf("заведение без ограничения отказало: %v", err)
+	}
+
+	if err := os.WriteFile(path, []byte(`[{"id": "center", "name": "На Тверской", "max_guests_per_slot": -1}]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadVenues(path, cfg); err == nil {
+		t.Fatal("отрицательная вместимость принята")
+	}
+}
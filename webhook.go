@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+const (
+	webhookQueueSize  = 100
+	webhookAttempts   = 3
+	webhookRetryDelay = 2 * time.Second
+	webhookTimeout    = 10 * time.Second
+	webhookSignHeader = "X-Signature-SHA256"
+)
+
+// Отправляет события по броням во внешнюю систему (CRM), если задан RESERVATION_WEBHOOK_URL
+func startReservationWebhook(c Config) {
+	if c.WebhookURL == "" {
+		return
+	}
+
+	client := webhookClient{http: &http.Client{Timeout: webhookTimeout}, url: c.WebhookURL, secret: c.WebhookSecret}
+	queue := make(chan reservationEvent, webhookQueueSize)
+	go func() {
+		for event := range queue {
+			client.deliver(event)
+		}
+	}()
+
+	eventSinks = append(eventSinks, func(event reservationEvent) {
+		select {
+		case queue <- event:
+		default:
+			slog.Warn("Очередь вебхука переполнена, событие пропущено", "reservationID", event.Reservation.ID)
+		}
+	})
+	slog.Info("Вебхук для броней включён", "url", c.WebhookURL)
+}
+
+type webhookClient struct {
+	http   *http.Client
+	url    string
+	secret string
+}
+
+func (c webhookClient) deliver(event reservationEvent) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		slog.Error("Не удалось сериализовать событие вебхука", "reservationID", event.Reservation.ID, "err", err)
+		return
+	}
+
+	for attempt := 1; attempt <= webhookAttempts; attempt++ {
+		err = c.post(payload)
+		if err == nil {
+			return
+		}
+		slog.Warn("Ошибка отправки вебхука", "reservationID", event.Reservation.ID, "event", event.Type, "attempt", attempt, "err", err)
+		if attempt < webhookAttempts {
+			time.Sleep(webhookRetryDelay * time.Duration(attempt))
+		}
+	}
+	slog.Error("Вебхук не доставлен", "reservationID", event.Reservation.ID, "event", event.Type)
+}
+
+func (c webhookClient) post(payload []byte) error {
+	req, err := http.NewRequest(http.MethodPost, c.url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.secret != "" {
+		req.Header.Set(webhookSignHeader, signWebhook(c.secret, payload))
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1024))
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("ответ %s", resp.Status)
+	}
+	return nil
+}
+
+// Подпись тела запроса в формате "sha256=<hex HMAC-SHA256>"
+func signWebhook(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}